@@ -11,13 +11,14 @@ import (
 
 func routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
+	mux.Use(handlers.Repo.RealIP)
 	mux.Use(middleware.Logger)
 
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "X-Impersonated-By"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -30,27 +31,155 @@ func routes(app *config.AppConfig) http.Handler {
 
 			mux.Post("/signup", handlers.Repo.SignUp)
 			mux.Post("/login", handlers.Repo.Login)
+			mux.Post("/login/2fa", handlers.Repo.LoginTwoFactor)
+			mux.Get("/auth/oidc/{provider}/login", handlers.Repo.OIDCLogin)
+			mux.Get("/auth/oidc/{provider}/callback", handlers.Repo.OIDCCallback)
 		})
+		// logged in or out, so refreshing works with an expired access token
+		mux.Post("/refresh", handlers.Repo.Refresh)
+		mux.Get("/auth/oidc/providers", handlers.Repo.GetOIDCProviders)
+		mux.Get("/verify-email", handlers.Repo.VerifyEmail)
+		mux.Get("/email-change/confirm", handlers.Repo.ConfirmEmailChange)
+		mux.Post("/password/forgot", handlers.Repo.ForgotPassword)
+		mux.Post("/password/reset", handlers.Repo.ResetPassword)
 		// must but logged in
 		mux.Group(func(mux chi.Router) {
 			mux.Use(handlers.Repo.RequireAuth)
 
 			mux.Post("/logout", handlers.Repo.Logout)
+			mux.Post("/verify-email/resend", handlers.Repo.ResendVerificationEmail)
+			mux.Put("/password/change", handlers.Repo.ChangePassword)
+
+			// Account
+			mux.Get("/me", handlers.Repo.GetProfile)
+			mux.Patch("/me", handlers.Repo.UpdateProfile)
+			mux.Post("/me/email", handlers.Repo.ChangeEmail)
+			mux.Get("/me/export", handlers.Repo.ExportAccount)
+			mux.Delete("/me/delete", handlers.Repo.DeleteAccount)
+
+			// Session
+			mux.Get("/me/sessions", handlers.Repo.GetSessions)
+			mux.Delete("/me/sessions/others/delete", handlers.Repo.RevokeOtherSessions)
+			mux.Delete("/me/sessions/{session_id}/delete", handlers.Repo.RevokeSession)
+
+			// Two-Factor Authentication
+			mux.Post("/me/2fa/setup", handlers.Repo.SetupTwoFactor)
+			mux.Post("/me/2fa/enable", handlers.Repo.EnableTwoFactor)
+			mux.Post("/me/2fa/disable", handlers.Repo.DisableTwoFactor)
+			mux.Post("/me/2fa/recovery-codes", handlers.Repo.RegenerateRecoveryCodes)
 
 			// Restaurant
 			mux.Post("/restaurants/create", handlers.Repo.CreateRestaurant)
 			mux.Put("/restaurants/{restaurant_id}/update", handlers.Repo.UpdateRestaurant)
 			mux.Delete("/restaurants/{restaurant_id}/delete", handlers.Repo.DeleteRestaurant)
+			mux.Get("/restaurants/{restaurant_id}/export", handlers.Repo.ExportRestaurant)
+			mux.Post("/restaurants/import", handlers.Repo.ImportRestaurant)
+			mux.Post("/restaurants/{restaurant_id}/clone", handlers.Repo.CloneRestaurant)
 
 			// Menu
 			mux.Post("/restaurants/{restaurant_id}/menus/create", handlers.Repo.CreateMenu)
 			mux.Put("/restaurants/{restaurant_id}/menus/{menu_id}/update", handlers.Repo.UpdateMenu)
 			mux.Delete("/restaurants/{restaurant_id}/menus/{menu_id}/delete", handlers.Repo.DeleteMenu)
+			mux.Post("/restaurants/{restaurant_id}/menus/import", handlers.Repo.ImportMenus)
+			mux.Post("/restaurants/{restaurant_id}/menus/batch", handlers.Repo.BatchMenus)
+			mux.Post("/restaurants/{restaurant_id}/menus/{menu_id}/clone", handlers.Repo.CloneMenu)
 
 			// Menu Item
 			mux.Post("/restaurants/{restaurant_id}/menus/{menu_id}/create", handlers.Repo.CreateMenuItem)
 			mux.Put("/restaurants/{restaurant_id}/menus/{menu_id}/{menu_item_id}/update", handlers.Repo.UpdateMenuItem)
 			mux.Delete("/restaurants/{restaurant_id}/menus/{menu_id}/{menu_item_id}/delete", handlers.Repo.DeleteMenuItem)
+
+			// Promotion
+			mux.Post("/restaurants/{restaurant_id}/promotions/create", handlers.Repo.CreatePromotion)
+			mux.Get("/restaurants/{restaurant_id}/promotions/preview", handlers.Repo.PreviewPromotions)
+			mux.Put("/restaurants/{restaurant_id}/promotions/{promotion_id}/update", handlers.Repo.UpdatePromotion)
+			mux.Delete("/restaurants/{restaurant_id}/promotions/{promotion_id}/delete", handlers.Repo.DeletePromotion)
+
+			// Translation
+			mux.Get("/restaurants/{restaurant_id}/translations", handlers.Repo.GetTranslations)
+			mux.Put("/restaurants/{restaurant_id}/translations/{language}/update", handlers.Repo.UpdateTranslations)
+			mux.Delete("/restaurants/{restaurant_id}/translations/{language}/delete", handlers.Repo.DeleteTranslations)
+
+			// API Key
+			mux.Get("/restaurants/{restaurant_id}/api-keys", handlers.Repo.GetAPIKeys)
+			mux.Post("/restaurants/{restaurant_id}/api-keys/create", handlers.Repo.CreateAPIKey)
+			mux.Delete("/restaurants/{restaurant_id}/api-keys/{api_key_id}/delete", handlers.Repo.RevokeAPIKey)
+
+			// Price Change
+			mux.Get("/restaurants/{restaurant_id}/price-changes", handlers.Repo.GetPriceChangesReport)
+
+			// Review
+			mux.Post("/restaurants/{restaurant_id}/reviews/create", handlers.Repo.CreateReview)
+			mux.Put("/restaurants/{restaurant_id}/reviews/{review_id}/update", handlers.Repo.UpdateReview)
+			mux.Put("/restaurants/{restaurant_id}/reviews/{review_id}/reply", handlers.Repo.ReplyToReview)
+			mux.Delete("/restaurants/{restaurant_id}/reviews/{review_id}/delete", handlers.Repo.DeleteReview)
+
+			// Favourites
+			mux.Get("/favourites", handlers.Repo.GetFavouriteLists)
+			mux.Post("/favourites/create", handlers.Repo.CreateFavouriteList)
+			mux.Put("/favourites/{list_id}/update", handlers.Repo.UpdateFavouriteList)
+			mux.Put("/favourites/{list_id}/share", handlers.Repo.ShareFavouriteList)
+			mux.Put("/favourites/{list_id}/unshare", handlers.Repo.UnshareFavouriteList)
+			mux.Delete("/favourites/{list_id}/delete", handlers.Repo.DeleteFavouriteList)
+			mux.Post("/favourites/{list_id}/entries/create", handlers.Repo.CreateFavouriteEntry)
+			mux.Delete("/favourites/{list_id}/entries/{entry_id}/delete", handlers.Repo.DeleteFavouriteEntry)
+
+			// Cart
+			mux.Get("/restaurants/{restaurant_id}/cart", handlers.Repo.GetCart)
+			mux.Post("/restaurants/{restaurant_id}/cart/items/create", handlers.Repo.CreateCartItem)
+			mux.Put("/restaurants/{restaurant_id}/cart/items/{cart_item_id}/update", handlers.Repo.UpdateCartItem)
+			mux.Delete("/restaurants/{restaurant_id}/cart/items/{cart_item_id}/delete", handlers.Repo.DeleteCartItem)
+			mux.Delete("/restaurants/{restaurant_id}/cart/delete", handlers.Repo.DeleteCart)
+			mux.Post("/restaurants/{restaurant_id}/cart/checkout", handlers.Repo.Checkout)
+
+			// Order
+			mux.Get("/orders", handlers.Repo.GetOrders)
+			mux.Put("/orders/{order_id}/cancel", handlers.Repo.CancelOrder)
+			mux.Get("/restaurants/{restaurant_id}/orders", handlers.Repo.GetRestaurantOrders)
+			mux.Put("/restaurants/{restaurant_id}/orders/{order_id}/{status}", handlers.Repo.AdvanceOrder)
+
+			// Table
+			mux.Post("/restaurants/{restaurant_id}/tables/create", handlers.Repo.CreateTable)
+			mux.Put("/restaurants/{restaurant_id}/tables/{table_id}/update", handlers.Repo.UpdateTable)
+			mux.Delete("/restaurants/{restaurant_id}/tables/{table_id}/delete", handlers.Repo.DeleteTable)
+			mux.Put("/restaurants/{restaurant_id}/opening-hours/update", handlers.Repo.UpdateOpeningHours)
+
+			// QR
+			mux.Get("/restaurants/{restaurant_id}/tables/{table_id}/qr", handlers.Repo.GetTableQR)
+			mux.Get("/restaurants/{restaurant_id}/tables/qr-sheet", handlers.Repo.GetTableTents)
+
+			// Table Request
+			mux.Get("/restaurants/{restaurant_id}/table-requests", handlers.Repo.GetTableRequests)
+			mux.Get("/restaurants/{restaurant_id}/table-requests/stream", handlers.Repo.StreamTableRequests)
+			mux.Put("/restaurants/{restaurant_id}/table-requests/{request_id}/{action}", handlers.Repo.UpdateTableRequest)
+
+			// Reservation
+			mux.Get("/reservations", handlers.Repo.GetReservations)
+			mux.Put("/reservations/{reservation_id}/cancel", handlers.Repo.CancelReservation)
+			mux.Post("/restaurants/{restaurant_id}/reservations/create", handlers.Repo.CreateReservation)
+			mux.Get("/restaurants/{restaurant_id}/reservations", handlers.Repo.GetRestaurantReservations)
+			mux.Put("/restaurants/{restaurant_id}/reservations/{reservation_id}/{status}", handlers.Repo.UpdateReservationStatus)
+
+			// Admin
+			mux.Group(func(mux chi.Router) {
+				mux.Use(handlers.Repo.RequireAdmin)
+
+				mux.Get("/admin/reviews", handlers.Repo.GetModerationReviews)
+				mux.Put("/admin/reviews/{review_id}/{action}", handlers.Repo.ModerateReview)
+				mux.Delete("/admin/users/{user_id}/sessions/delete", handlers.Repo.RevokeUserSessions)
+				mux.Get("/admin/login-locks", handlers.Repo.GetLoginLocks)
+				mux.Delete("/admin/login-locks/{lock_id}/delete", handlers.Repo.ClearLoginLock)
+
+				mux.Get("/admin/users", handlers.Repo.GetUsers)
+				mux.Get("/admin/users/{user_id}", handlers.Repo.GetUser)
+				mux.Put("/admin/users/{user_id}/role", handlers.Repo.UpdateUserRole)
+				mux.Post("/admin/users/{user_id}/suspend", handlers.Repo.SuspendUser)
+				mux.Post("/admin/users/{user_id}/unsuspend", handlers.Repo.UnsuspendUser)
+				mux.Post("/admin/users/{user_id}/impersonate", handlers.Repo.ImpersonateUser)
+				mux.Delete("/admin/impersonations/{session_id}/delete", handlers.Repo.EndImpersonation)
+				mux.Put("/admin/restaurants/{restaurant_id}/owner", handlers.Repo.TransferRestaurant)
+				mux.Get("/admin/audit-log", handlers.Repo.GetAuditLog)
+			})
 		})
 
 		// Restaurant
@@ -59,9 +188,36 @@ func routes(app *config.AppConfig) http.Handler {
 
 		// Menu
 		mux.Get("/restaurants/{restaurant_id}/menus", handlers.Repo.GetMenus)
+		mux.Get("/restaurants/{restaurant_id}/menus/pdf", handlers.Repo.GetMenusPDF)
 		mux.Get("/restaurants/{restaurant_id}/menus/{menu_id}", handlers.Repo.GetMenu)
 		mux.Get("/restaurants/{restaurant_id}/menus/{menu_id}/{menu_item_id}", handlers.Repo.GetMenuItem)
 		mux.Put("/restaurants/{restaurant_id}/menus/{menu_id}/{menu_item_id}/{action}", handlers.Repo.LikeMenuItem)
+		mux.Get("/restaurants/{restaurant_id}/menus/{menu_id}/{menu_item_id}/price-history", handlers.Repo.GetPriceHistory)
+
+		// Review
+		mux.Get("/restaurants/{restaurant_id}/reviews", handlers.Repo.GetReviews)
+
+		// Favourites
+		mux.Get("/favourites/shared/{share_token}", handlers.Repo.GetSharedFavouriteList)
+
+		// Order
+		mux.Get("/orders/track/{tracking_token}", handlers.Repo.TrackOrder)
+
+		// Table
+		mux.Get("/restaurants/{restaurant_id}/tables", handlers.Repo.GetTables)
+		mux.Get("/restaurants/{restaurant_id}/opening-hours", handlers.Repo.GetOpeningHours)
+		mux.Get("/restaurants/{restaurant_id}/reservations/slots", handlers.Repo.GetReservationSlots)
+
+		// Promotion
+		mux.Get("/restaurants/{restaurant_id}/promotions", handlers.Repo.GetPromotions)
+
+		// QR
+		mux.Get("/restaurants/{restaurant_id}/qr", handlers.Repo.GetRestaurantQR)
+
+		// Table Session
+		mux.Post("/table-sessions/open", handlers.Repo.OpenTableSession)
+		mux.Get("/table-sessions/{session_token}", handlers.Repo.GetTableSession)
+		mux.Post("/table-sessions/{session_token}/requests/create", handlers.Repo.CreateTableRequest)
 
 		// Storage
 		mux.Get("/storage/images/*", handlers.Repo.GetImage)
@@ -69,6 +225,7 @@ func routes(app *config.AppConfig) http.Handler {
 
 	mux.Get("/restaurants", handlers.Repo.Restaurants)
 	mux.Get("/restaurants/{restaurant_id}", handlers.Repo.Restaurant)
+	mux.Get("/reset-password", handlers.Repo.ResetPasswordPage)
 
 	return mux
 }
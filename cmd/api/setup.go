@@ -6,12 +6,17 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/vladyslavpavlenko/peparesu/config"
 	"github.com/vladyslavpavlenko/peparesu/internal/handlers"
+	"github.com/vladyslavpavlenko/peparesu/internal/mailer"
 	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/oidclogin"
 	"github.com/vladyslavpavlenko/peparesu/internal/render"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -23,6 +28,8 @@ func setup(app *config.AppConfig) error {
 	}
 
 	app.Env = env
+	app.OIDCProviders = oidclogin.New(env.OIDCProviders)
+	app.Mailer = newMailer()
 
 	// Connect to the database and run migrations
 	db, err := connectToPostgresAndMigrate(env)
@@ -58,15 +65,119 @@ func loadEvnVariables() (*config.EnvVariables, error) {
 	postgresDBName := os.Getenv("POSTGRES_DBNAME")
 	jwtSecret := os.Getenv("JWT_SECRET")
 
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:8080"
+	}
+
+	trustedProxies, err := loadTrustedProxies()
+	if err != nil {
+		return nil, err
+	}
+
 	return &config.EnvVariables{
 		PostgresHost:   postgresHost,
 		PostgresUser:   postgresUser,
 		PostgresPass:   postgresPass,
 		PostgresDBName: postgresDBName,
 		JWTSecret:      jwtSecret,
+		AppURL:         appURL,
+		OIDCProviders:  loadOIDCProviders(appURL),
+		// Two-factor authentication is optional unless required for admins or owners
+		TwoFactorForAdmins: os.Getenv("TWO_FACTOR_ADMINS") == "required",
+		TwoFactorForOwners: os.Getenv("TWO_FACTOR_OWNERS") == "required",
+		TrustedProxies:     trustedProxies,
 	}, nil
 }
 
+// loadTrustedProxies loads TRUSTED_PROXIES, a comma-separated list of the IP addresses or CIDR ranges
+// of the reverse proxies in front of the application, such as "10.0.0.0/8,127.0.0.1".
+func loadTrustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+
+	for _, value := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %v", value, err)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+
+		proxies = append(proxies, prefix.Masked())
+	}
+
+	return proxies, nil
+}
+
+// newMailer returns the SMTP mailer configured by SMTP_HOST, SMTP_PORT, SMTP_USERNAME and SMTP_PASSWORD.
+// Without SMTP_HOST, emails are written to the MAIL_DIR directory or to the log instead of being sent.
+func newMailer() mailer.Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Peparesu <no-reply@peparesu.com>"
+	}
+
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return mailer.Log{From: from, Dir: os.Getenv("MAIL_DIR")}
+	}
+
+	port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if err != nil {
+		port = 587
+	}
+
+	return mailer.SMTP{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+}
+
+// loadOIDCProviders loads the OIDC login providers listed in OIDC_PROVIDERS, such as "google,apple".
+// Each provider is configured with OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET
+// and optionally OIDC_<NAME>_SCOPES, a comma-separated list of additional scopes.
+func loadOIDCProviders(appURL string) []oidclogin.Config {
+	var providers []oidclogin.Config
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := oidclogin.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  strings.TrimSuffix(appURL, "/") + "/api/v1/auth/oidc/" + name + "/callback",
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			provider.Scopes = strings.Split(scopes, ",")
+		}
+
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Printf("skipping OIDC provider %s: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+			continue
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers
+}
+
 // connectToPostgresAndMigrate initializes a PostgreSQL db session and runs GORM migrations.
 func connectToPostgresAndMigrate(env *config.EnvVariables) (*gorm.DB, error) {
 	dsn := fmt.Sprintf("host=%s user=%s dbname=%s password=%s sslmode=disable",
@@ -86,11 +197,28 @@ func runDatabaseMigrations(db *gorm.DB) error {
 		return err
 	}
 
+	// Users who signed up before email verification was added are grandfathered in
+	backfillEmailVerified := db.Migrator().HasTable(&models.User{}) &&
+		!db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
 	err = db.AutoMigrate(&models.User{})
 	if err != nil {
 		return err
 	}
 
+	if backfillEmailVerified {
+		err = db.Model(&models.User{}).Where("email_verified_at IS NULL").
+			Update("email_verified_at", gorm.Expr("created_at")).Error
+		if err != nil {
+			return errors.New(fmt.Sprint("error grandfathering email verification:", err))
+		}
+	}
+
+	err = normalizeUserEmails(db)
+	if err != nil {
+		return errors.New(fmt.Sprint("error normalizing user emails:", err))
+	}
+
 	err = db.AutoMigrate(&models.Restaurant{})
 	if err != nil {
 		return err
@@ -106,6 +234,130 @@ func runDatabaseMigrations(db *gorm.DB) error {
 		return err
 	}
 
+	err = db.AutoMigrate(&models.Review{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.FavouriteList{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.FavouriteListEntry{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.Cart{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.CartItem{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.Order{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.OrderItem{})
+	if err != nil {
+		return err
+	}
+
+	// Tables created before tokens were introduced get one before the column becomes not null
+	if db.Migrator().HasColumn(&models.Table{}, "Token") {
+		err = db.Model(&models.Table{}).Where("token IS NULL OR token = ''").
+			Update("token", gorm.Expr("replace(gen_random_uuid()::text, '-', '')")).Error
+		if err != nil {
+			return errors.New(fmt.Sprint("error backfilling table tokens:", err))
+		}
+	}
+
+	err = db.AutoMigrate(&models.Table{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.OpeningHours{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.Reservation{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.TableSession{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.TableRequest{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.PriceChange{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.Promotion{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.Translation{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.Session{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.RefreshToken{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.APIKey{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.OAuthIdentity{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.PasswordResetToken{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.RecoveryCode{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.LoginLock{})
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&models.AuditLog{})
+	if err != nil {
+		return err
+	}
+
 	// populate tables with initial data
 	err = createInitialUserTypes(db)
 	if err != nil {
@@ -135,6 +387,34 @@ func runDatabaseMigrations(db *gorm.DB) error {
 	return nil
 }
 
+// normalizeUserEmails stores the emails of the users trimmed and lowercased and makes them unique whatever
+// their case. Emails that differ only by case were accepted before, so when several users have such an email,
+// it is logged and left for an admin to resolve, and the unique index waits for the next start.
+func normalizeUserEmails(db *gorm.DB) error {
+	var duplicates []string
+	err := db.Model(&models.User{}).
+		Group("LOWER(TRIM(email))").
+		Having("COUNT(*) > 1").
+		Pluck("LOWER(TRIM(email))", &duplicates).Error
+	if err != nil {
+		return err
+	}
+
+	if len(duplicates) > 0 {
+		log.Printf("several users have each of the emails %s, the unique email index is not created until they are resolved",
+			strings.Join(duplicates, ", "))
+		return nil
+	}
+
+	err = db.Model(&models.User{}).Where("email <> LOWER(TRIM(email))").
+		Update("email", gorm.Expr("LOWER(TRIM(email))")).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))").Error
+}
+
 // createInitialUserTypes creates initial user types in the `user_types` table.
 func createInitialUserTypes(db *gorm.DB) error {
 	var count int64
@@ -171,33 +451,36 @@ func createInitialUsers(db *gorm.DB) error {
 		return nil
 	}
 
+	now := time.Now()
+
+	// The initial users have no password and log in after setting one with forgot-password
 	initialData := []models.User{
 		{
-			FirstName:  "Владислав",
-			LastName:   "Павленко",
-			Email:      "mail@peparesu.com",
-			Password:   "password",
-			UserTypeID: 2, // Admin
-			CreatedAt:  time.Now(),
-			UpdatedAt:  time.Now(),
-		},
-		{
-			FirstName:  "Алекс",
-			LastName:   "Купер",
-			Email:      "alex@cooper.com",
-			Password:   "password",
-			UserTypeID: 1, // User
-			CreatedAt:  time.Now(),
-			UpdatedAt:  time.Now(),
-		},
-		{
-			FirstName:  "Михайло",
-			LastName:   "Кацурін",
-			Email:      "misha@katsurin.com",
-			Password:   "password",
-			UserTypeID: 1, // User
-			CreatedAt:  time.Now(),
-			UpdatedAt:  time.Now(),
+			FirstName:       "Владислав",
+			LastName:        "Павленко",
+			Email:           "mail@peparesu.com",
+			UserTypeID:      2, // Admin
+			EmailVerifiedAt: &now,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+		},
+		{
+			FirstName:       "Алекс",
+			LastName:        "Купер",
+			Email:           "alex@cooper.com",
+			UserTypeID:      1, // User
+			EmailVerifiedAt: &now,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
+		},
+		{
+			FirstName:       "Михайло",
+			LastName:        "Кацурін",
+			Email:           "misha@katsurin.com",
+			UserTypeID:      1, // User
+			EmailVerifiedAt: &now,
+			CreatedAt:       time.Now(),
+			UpdatedAt:       time.Now(),
 		},
 	}
 
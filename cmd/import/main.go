@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/vladyslavpavlenko/peparesu/internal/menuimport"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"strings"
+)
+
+// options are the command line options of an import.
+type options struct {
+	restaurantID uint
+	filePath     string
+	userID       uint
+	dryRun       bool
+	imagesDir    string
+}
+
+// import loads menus and menu items of a restaurant from a CSV or XLSX sheet.
+//
+//	go run ./cmd/import -restaurant 1 -file menu.xlsx -dry-run
+func main() {
+	restaurantID := flag.Uint("restaurant", 0, "the ID of the restaurant to import into")
+	filePath := flag.String("file", "", "the CSV or XLSX sheet to import")
+	userID := flag.Uint("user", 0, "the ID of the user recorded as the author of the prices")
+	dryRun := flag.Bool("dry-run", false, "validate and preview the import without saving it")
+	imagesDir := flag.String("images", "storage/images", "the directory picture file names are resolved in")
+	flag.Parse()
+
+	if *restaurantID == 0 || *filePath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(options{
+		restaurantID: *restaurantID,
+		filePath:     *filePath,
+		userID:       *userID,
+		dryRun:       *dryRun,
+		imagesDir:    *imagesDir,
+	})
+	if errors.Is(err, menuimport.ErrInvalidRows) {
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run imports the sheet and prints the report. It returns menuimport.ErrInvalidRows after printing
+// the report of a sheet with invalid rows.
+func run(opts options) error {
+	if err := godotenv.Load(); err != nil {
+		return fmt.Errorf("error getting environment variables: %v", err)
+	}
+
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:8080"
+	}
+	appURL = strings.TrimSuffix(appURL, "/")
+
+	dsn := fmt.Sprintf("host=%s user=%s dbname=%s password=%s sslmode=disable",
+		os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_USER"), os.Getenv("POSTGRES_DBNAME"), os.Getenv("POSTGRES_PASS"))
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("could not connect: %v", err)
+	}
+
+	format, err := menuimport.FormatFromFilename(opts.filePath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(opts.filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := menuimport.Import(db, opts.restaurantID, file, format, menuimport.Options{
+		ImagesDir:      opts.imagesDir,
+		ImagesURL:      appURL + "/api/v1/storage/images",
+		DefaultPicture: appURL + "/api/v1/storage/images/menuitem-default.jpeg",
+		ActorID:        opts.userID,
+		DryRun:         opts.dryRun,
+	})
+	if err != nil && !errors.Is(err, menuimport.ErrInvalidRows) {
+		return err
+	}
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+
+	return err
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"github.com/vladyslavpavlenko/peparesu/internal/mockoidc"
+	"log"
+	"net/http"
+)
+
+// mockoidc runs a local OpenID Connect provider that logs in anyone, for developing and testing the OIDC login.
+//
+//	go run ./cmd/mockoidc -addr :9090
+//
+// and configure the API with
+//
+//	OIDC_PROVIDERS=mock
+//	OIDC_MOCK_ISSUER=http://localhost:9090
+//	OIDC_MOCK_CLIENT_ID=peparesu
+func main() {
+	addr := flag.String("addr", ":9090", "the address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9090", "the issuer URL the provider is reachable at")
+	flag.Parse()
+
+	server, err := mockoidc.New(*issuer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("mock OIDC provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
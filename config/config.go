@@ -1,8 +1,11 @@
 package config
 
 import (
+	"github.com/vladyslavpavlenko/peparesu/internal/mailer"
+	"github.com/vladyslavpavlenko/peparesu/internal/oidclogin"
 	"gorm.io/gorm"
 	"html/template"
+	"net/netip"
 )
 
 // AppConfig holds the application config.
@@ -11,6 +14,8 @@ type AppConfig struct {
 	Env           *EnvVariables
 	UseCache      bool
 	TemplateCache map[string]*template.Template
+	OIDCProviders *oidclogin.Providers
+	Mailer        mailer.Mailer
 }
 
 // EnvVariables holds environment variables used in the application.
@@ -20,4 +25,13 @@ type EnvVariables struct {
 	PostgresPass   string
 	PostgresDBName string
 	JWTSecret      string
+	AppURL         string
+	OIDCProviders  []oidclogin.Config
+	// TwoFactorForAdmins and TwoFactorForOwners make two-factor authentication mandatory
+	// for admins and restaurant owners.
+	TwoFactorForAdmins bool
+	TwoFactorForOwners bool
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header tells the client address.
+	// Without them, the application is expected to be exposed directly.
+	TrustedProxies []netip.Prefix
 }
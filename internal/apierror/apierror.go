@@ -0,0 +1,252 @@
+// Package apierror defines the catalogue of API error codes and renders errors as
+// RFC 7807 problem details with messages in Ukrainian or English.
+//
+// Codes are stable and safe for clients to branch on; messages may change.
+package apierror
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Code is a stable, machine-readable error code.
+type Code string
+
+const (
+	BadRequest         Code = "bad_request"
+	InvalidBody        Code = "invalid_body"
+	InvalidParameter   Code = "invalid_parameter"
+	ValidationFailed   Code = "validation_failed"
+	Unauthorized       Code = "unauthorized"
+	InvalidCredentials Code = "invalid_credentials"
+	Forbidden          Code = "forbidden"
+	EmailNotVerified   Code = "email_not_verified"
+	TwoFactorRequired  Code = "two_factor_required"
+	AccountSuspended   Code = "account_suspended"
+	NotFound           Code = "not_found"
+	Conflict           Code = "conflict"
+	InvalidTransition  Code = "invalid_transition"
+	PayloadTooLarge    Code = "payload_too_large"
+	Unprocessable      Code = "unprocessable_entity"
+	TooManyRequests    Code = "too_many_requests"
+	Internal           Code = "internal_error"
+	Unavailable        Code = "service_unavailable"
+)
+
+// Reason is a stable, machine-readable reason a field is invalid.
+type Reason string
+
+const (
+	Required   Reason = "required"
+	Invalid    Reason = "invalid"
+	TooLong    Reason = "too_long"
+	OutOfRange Reason = "out_of_range"
+	Taken      Reason = "taken"
+)
+
+// Supported languages of the messages.
+const (
+	English   = "en"
+	Ukrainian = "uk"
+)
+
+// entry is a catalogue entry of an error code.
+type entry struct {
+	status int
+	titles map[string]string
+}
+
+var catalogue = map[Code]entry{
+	BadRequest:         {http.StatusBadRequest, map[string]string{English: "The request is invalid.", Ukrainian: "Некоректний запит."}},
+	InvalidBody:        {http.StatusBadRequest, map[string]string{English: "The request body cannot be read.", Ukrainian: "Не вдалося прочитати тіло запиту."}},
+	InvalidParameter:   {http.StatusBadRequest, map[string]string{English: "A request parameter is invalid.", Ukrainian: "Некоректний параметр запиту."}},
+	ValidationFailed:   {http.StatusBadRequest, map[string]string{English: "Some fields are invalid.", Ukrainian: "Деякі поля заповнено некоректно."}},
+	Unauthorized:       {http.StatusUnauthorized, map[string]string{English: "Authentication is required.", Ukrainian: "Потрібна автентифікація."}},
+	InvalidCredentials: {http.StatusUnauthorized, map[string]string{English: "The email or password is incorrect.", Ukrainian: "Неправильна електронна пошта або пароль."}},
+	Forbidden:          {http.StatusForbidden, map[string]string{English: "You are not allowed to do this.", Ukrainian: "У вас немає дозволу на цю дію."}},
+	EmailNotVerified:   {http.StatusForbidden, map[string]string{English: "Verify your email address first.", Ukrainian: "Спершу підтвердьте електронну пошту."}},
+	TwoFactorRequired:  {http.StatusForbidden, map[string]string{English: "Set up two-factor authentication first.", Ukrainian: "Спершу налаштуйте двофакторну автентифікацію."}},
+	AccountSuspended:   {http.StatusForbidden, map[string]string{English: "The account is suspended.", Ukrainian: "Обліковий запис заблоковано."}},
+	NotFound:           {http.StatusNotFound, map[string]string{English: "The resource was not found.", Ukrainian: "Ресурс не знайдено."}},
+	Conflict:           {http.StatusConflict, map[string]string{English: "The request conflicts with the current state.", Ukrainian: "Запит суперечить поточному стану."}},
+	InvalidTransition:  {http.StatusConflict, map[string]string{English: "The status change is not allowed.", Ukrainian: "Така зміна статусу неможлива."}},
+	PayloadTooLarge:    {http.StatusRequestEntityTooLarge, map[string]string{English: "The request is too large.", Ukrainian: "Запит завеликий."}},
+	Unprocessable:      {http.StatusUnprocessableEntity, map[string]string{English: "The request cannot be processed.", Ukrainian: "Запит неможливо обробити."}},
+	TooManyRequests:    {http.StatusTooManyRequests, map[string]string{English: "Too many requests, try again later.", Ukrainian: "Забагато запитів, спробуйте пізніше."}},
+	Internal:           {http.StatusInternalServerError, map[string]string{English: "Something went wrong on our side.", Ukrainian: "Сталася внутрішня помилка."}},
+	Unavailable:        {http.StatusServiceUnavailable, map[string]string{English: "The service is temporarily unavailable.", Ukrainian: "Сервіс тимчасово недоступний."}},
+}
+
+var reasons = map[Reason]map[string]string{
+	Required:   {English: "This field is required.", Ukrainian: "Це поле обов'язкове."},
+	Invalid:    {English: "This value is invalid.", Ukrainian: "Некоректне значення."},
+	TooLong:    {English: "This value is too long.", Ukrainian: "Значення задовге."},
+	OutOfRange: {English: "This value is out of range.", Ukrainian: "Значення поза допустимими межами."},
+	Taken:      {English: "This value is already taken.", Ukrainian: "Це значення вже використовується."},
+}
+
+// codesByStatus is the code of errors that are not in the catalogue, by HTTP status.
+var codesByStatus = map[int]Code{
+	http.StatusBadRequest:            BadRequest,
+	http.StatusUnauthorized:          Unauthorized,
+	http.StatusForbidden:             Forbidden,
+	http.StatusNotFound:              NotFound,
+	http.StatusConflict:              Conflict,
+	http.StatusRequestEntityTooLarge: PayloadTooLarge,
+	http.StatusUnprocessableEntity:   Unprocessable,
+	http.StatusTooManyRequests:       TooManyRequests,
+	http.StatusServiceUnavailable:    Unavailable,
+}
+
+// FieldError describes why a single field or parameter is invalid.
+type FieldError struct {
+	Field  string
+	Reason Reason
+}
+
+// Error is an API error with a catalogue code.
+type Error struct {
+	Code Code
+	// Detail explains this occurrence of the error in English.
+	Detail string
+	Fields []FieldError
+	// Err is the underlying cause. It is never shown to clients.
+	Err error
+}
+
+// New returns an error with the code and detail.
+func New(code Code, detail string, fields ...FieldError) *Error {
+	return &Error{Code: code, Detail: detail, Fields: fields}
+}
+
+// Wrap returns an error with the code that keeps err as its cause.
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+// InvalidParam returns an invalid_parameter error for the URL or query parameter.
+func InvalidParam(param string) *Error {
+	return New(InvalidParameter, "invalid "+strings.ReplaceAll(param, "_", " "), FieldError{Field: param, Reason: Invalid})
+}
+
+// Field returns a validation_failed error for the body field.
+func Field(field string, reason Reason, detail string) *Error {
+	return New(ValidationFailed, detail, FieldError{Field: field, Reason: reason})
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Detail != "":
+		return e.Detail
+	case e.Err != nil:
+		return e.Err.Error()
+	default:
+		return string(e.Code)
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status of the error code.
+func (e *Error) Status() int {
+	if entry, ok := catalogue[e.Code]; ok {
+		return entry.status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// From returns err as an API error. Errors outside the catalogue get a code matching
+// the status; their message becomes the detail unless the status is a server error,
+// so that database and other internal messages do not leak.
+func From(err error, status int) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	if status == http.StatusServiceUnavailable {
+		return Wrap(Unavailable, err)
+	}
+	if status >= http.StatusInternalServerError {
+		return Wrap(Internal, err)
+	}
+
+	code, ok := codesByStatus[status]
+	if !ok {
+		code = BadRequest
+	}
+
+	return &Error{Code: code, Detail: err.Error(), Err: err}
+}
+
+// FieldProblem is a field-level entry of a problem.
+type FieldProblem struct {
+	Field   string `json:"field"`
+	Reason  Reason `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Code     Code           `json:"code"`
+	Errors   []FieldProblem `json:"errors,omitempty"`
+	// Error and Message keep the body readable by clients of the plain JSON responses.
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+}
+
+// Problem renders the error in the language for the request path.
+func (e *Error) Problem(lang, instance string) Problem {
+	if lang != Ukrainian {
+		lang = English
+	}
+
+	entry, ok := catalogue[e.Code]
+	if !ok {
+		entry = catalogue[Internal]
+	}
+
+	problem := Problem{
+		Type:     "urn:peparesu:error:" + string(e.Code),
+		Title:    entry.titles[lang],
+		Status:   e.Status(),
+		Detail:   e.Detail,
+		Instance: instance,
+		Code:     e.Code,
+		Error:    true,
+		Message:  entry.titles[lang],
+	}
+	if lang == English && e.Detail != "" {
+		problem.Message = e.Detail
+	}
+
+	for _, field := range e.Fields {
+		problem.Errors = append(problem.Errors, FieldProblem{
+			Field:   field.Field,
+			Reason:  field.Reason,
+			Message: reasons[field.Reason][lang],
+		})
+	}
+
+	return problem
+}
+
+// Language picks the language of the messages from the preferred languages, defaulting to English.
+func Language(preferred []string) string {
+	for _, lang := range preferred {
+		if lang == English || lang == Ukrainian {
+			return lang
+		}
+	}
+
+	return English
+}
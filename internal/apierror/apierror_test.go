@@ -0,0 +1,98 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFrom(t *testing.T) {
+	cause := errors.New(`pq: duplicate key value violates unique constraint "users_email_key"`)
+
+	tests := []struct {
+		name       string
+		err        error
+		status     int
+		wantCode   Code
+		wantStatus int
+		wantDetail string
+	}{
+		{name: "internal error", err: cause, status: http.StatusInternalServerError, wantCode: Internal, wantStatus: http.StatusInternalServerError},
+		{name: "bad gateway", err: cause, status: http.StatusBadGateway, wantCode: Internal, wantStatus: http.StatusInternalServerError},
+		{name: "unavailable", err: cause, status: http.StatusServiceUnavailable, wantCode: Unavailable, wantStatus: http.StatusServiceUnavailable},
+		{name: "wrapped internal error", err: fmt.Errorf("error saving user: %w", cause), status: http.StatusInternalServerError, wantCode: Internal, wantStatus: http.StatusInternalServerError},
+		{name: "not found", err: errors.New("menu not found"), status: http.StatusNotFound, wantCode: NotFound, wantStatus: http.StatusNotFound, wantDetail: "menu not found"},
+		{name: "conflict", err: errors.New("title is taken"), status: http.StatusConflict, wantCode: Conflict, wantStatus: http.StatusConflict, wantDetail: "title is taken"},
+		{name: "status outside the catalogue", err: errors.New("teapot"), status: http.StatusTeapot, wantCode: BadRequest, wantStatus: http.StatusBadRequest, wantDetail: "teapot"},
+		{name: "catalogue error keeps its code", err: New(Forbidden, "not yours"), status: http.StatusInternalServerError, wantCode: Forbidden, wantStatus: http.StatusForbidden, wantDetail: "not yours"},
+		{name: "wrapped catalogue error", err: fmt.Errorf("checking: %w", Field("title", Required, "title cannot be empty")), status: http.StatusBadRequest, wantCode: ValidationFailed, wantStatus: http.StatusBadRequest, wantDetail: "title cannot be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := From(tt.err, tt.status)
+
+			if apiErr.Code != tt.wantCode || apiErr.Status() != tt.wantStatus || apiErr.Detail != tt.wantDetail {
+				t.Errorf("From = %s %d %q, want %s %d %q", apiErr.Code, apiErr.Status(), apiErr.Detail, tt.wantCode, tt.wantStatus, tt.wantDetail)
+			}
+
+			// The cause of a server error is kept to be logged
+			if tt.wantStatus >= http.StatusInternalServerError && !errors.Is(apiErr, cause) {
+				t.Errorf("From does not keep the cause %v", tt.err)
+			}
+		})
+	}
+}
+
+func TestFromServerErrorsDoNotLeak(t *testing.T) {
+	secret := "pq: password authentication failed for user \"peparesu\""
+
+	for _, status := range []int{
+		http.StatusInternalServerError,
+		http.StatusNotImplemented,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	} {
+		for _, lang := range []string{English, Ukrainian} {
+			problem := From(errors.New(secret), status).Problem(lang, "/api/v1/restaurants")
+
+			if problem.Status < http.StatusInternalServerError {
+				t.Errorf("status %d: problem status = %d, want a server error", status, problem.Status)
+			}
+			if strings.Contains(problem.Detail, "pq:") || strings.Contains(problem.Message, "pq:") || strings.Contains(problem.Title, "pq:") {
+				t.Errorf("status %d, %s: problem leaks the error: %+v", status, lang, problem)
+			}
+		}
+	}
+}
+
+func TestProblem(t *testing.T) {
+	err := Field("email", Invalid, "invalid email address")
+
+	tests := []struct {
+		lang        string
+		wantMessage string
+		wantField   string
+	}{
+		{English, "invalid email address", "This value is invalid."},
+		{Ukrainian, "Деякі поля заповнено некоректно.", "Некоректне значення."},
+		{"de", "invalid email address", "This value is invalid."},
+	}
+
+	for _, tt := range tests {
+		problem := err.Problem(tt.lang, "/api/v1/user/register")
+
+		if problem.Status != http.StatusBadRequest || problem.Code != ValidationFailed || !problem.Error {
+			t.Errorf("%s: problem = %+v", tt.lang, problem)
+		}
+		if problem.Message != tt.wantMessage {
+			t.Errorf("%s: Message = %q, want %q", tt.lang, problem.Message, tt.wantMessage)
+		}
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "email" || problem.Errors[0].Message != tt.wantField {
+			t.Errorf("%s: Errors = %+v", tt.lang, problem.Errors)
+		}
+	}
+}
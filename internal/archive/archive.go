@@ -0,0 +1,538 @@
+// Package archive exports restaurants into portable zip archives and imports them back.
+//
+// An archive holds a manifest.json with the restaurant, its menus and menu items and their
+// translations, and an images directory with the pictures the menu items use from the application storage.
+// Pictures hosted elsewhere are kept as URLs, and the default picture is not archived.
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/pricehistory"
+	"github.com/vladyslavpavlenko/peparesu/internal/storage"
+	"gorm.io/gorm"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Version is the version of the archive format written by Export.
+	Version = 1
+
+	manifestName = "manifest.json"
+	imagesDir    = "images/"
+
+	// maxImageSize limits the size of a single unpacked image.
+	maxImageSize = 10 << 20
+)
+
+// imageFormats maps the extensions of the archived pictures to the formats their content must have.
+// Other files are refused, as the storage serves them by their extension.
+var imageFormats = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".png":  "png",
+	".gif":  "gif",
+}
+
+// Manifest is the content of the manifest.json file of an archive.
+type Manifest struct {
+	Version    int        `json:"version"`
+	ExportedAt time.Time  `json:"exportedAt"`
+	Restaurant Restaurant `json:"restaurant"`
+}
+
+// Restaurant is an archived restaurant.
+type Restaurant struct {
+	Title       string `json:"title"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Address     string `json:"address"`
+	Phone       string `json:"phone"`
+	// DefaultLanguage is the language of the texts.
+	DefaultLanguage string        `json:"defaultLanguage,omitempty"`
+	Translations    []Translation `json:"translations,omitempty"`
+	Menus           []Menu        `json:"menus"`
+}
+
+// Menu is an archived menu.
+type Menu struct {
+	Title        string        `json:"title"`
+	Translations []Translation `json:"translations,omitempty"`
+	MenuItems    []MenuItem    `json:"menuItems"`
+}
+
+// MenuItem is an archived menu item.
+type MenuItem struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	PriceUAH    uint   `json:"priceUAH"`
+	// Picture is a path in the archive images directory, an absolute URL,
+	// or empty for the default picture.
+	Picture      string        `json:"picture"`
+	Translations []Translation `json:"translations,omitempty"`
+}
+
+// Translation is an archived translation of the texts of a restaurant, menu or menu item.
+type Translation struct {
+	Language    string `json:"language"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Options configures the application storage the pictures are read from and written to.
+type Options struct {
+	// ImagesDir is the directory of the stored images.
+	ImagesDir string
+	// ImagesURL is the public URL of ImagesDir.
+	ImagesURL string
+	// DefaultPicture is the picture of menu items without one.
+	DefaultPicture string
+}
+
+// Export writes the archive of the restaurant to w.
+func Export(w io.Writer, db *gorm.DB, restaurantID uint, opts Options) error {
+	var restaurant models.Restaurant
+	err := db.Preload("Menus", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Menus.MenuItems", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&restaurant, "id = ?", restaurantID).Error
+	if err != nil {
+		return err
+	}
+
+	var translations []models.Translation
+	if err := db.Where("restaurant_id = ?", restaurantID).Order("language").Find(&translations).Error; err != nil {
+		return err
+	}
+
+	restaurantTranslations, menuTranslations, menuItemTranslations := groupTranslations(translations)
+
+	manifest := Manifest{
+		Version:    Version,
+		ExportedAt: time.Now(),
+		Restaurant: Restaurant{
+			Title:           restaurant.Title,
+			Type:            restaurant.Type,
+			Description:     restaurant.Description,
+			Address:         restaurant.Address,
+			Phone:           restaurant.Phone,
+			DefaultLanguage: restaurant.DefaultLanguage,
+			Translations:    restaurantTranslations,
+			Menus:           []Menu{},
+		},
+	}
+
+	zw := zip.NewWriter(w)
+	written := make(map[string]bool)
+
+	for _, menu := range restaurant.Menus {
+		archivedMenu := Menu{Title: menu.Title, Translations: menuTranslations[menu.ID], MenuItems: []MenuItem{}}
+
+		for _, menuItem := range menu.MenuItems {
+			archivedItem := MenuItem{
+				Title:        menuItem.Title,
+				Description:  menuItem.Description,
+				PriceUAH:     menuItem.PriceUAH,
+				Picture:      menuItem.Picture,
+				Translations: menuItemTranslations[menuItem.ID],
+			}
+
+			name, stored := storedImage(menuItem.Picture, opts)
+
+			switch {
+			case menuItem.Picture == opts.DefaultPicture || (stored && name == path.Base(opts.DefaultPicture)):
+				archivedItem.Picture = ""
+			case stored:
+				archivedItem.Picture = imagesDir + name
+
+				if !written[name] {
+					if err := addFile(zw, archivedItem.Picture, filepath.Join(opts.ImagesDir, name)); err != nil {
+						return err
+					}
+					written[name] = true
+				}
+			}
+
+			archivedMenu.MenuItems = append(archivedMenu.MenuItems, archivedItem)
+		}
+
+		manifest.Restaurant.Menus = append(manifest.Restaurant.Menus, archivedMenu)
+	}
+
+	mw, err := zw.Create(manifestName)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(mw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// Import recreates the archived restaurant under the owner with new IDs.
+// Archived images are copied into the storage under new names and the menu item
+// pictures are rewritten to point at them.
+func Import(db *gorm.DB, r io.ReaderAt, size int64, ownerID uint, opts Options) (models.Restaurant, error) {
+	var restaurant models.Restaurant
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return restaurant, fmt.Errorf("error reading archive: %v", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, file := range zr.File {
+		files[file.Name] = file
+	}
+
+	manifest, err := readManifest(files[manifestName])
+	if err != nil {
+		return restaurant, err
+	}
+
+	if err := validate(manifest, files); err != nil {
+		return restaurant, err
+	}
+
+	// written keeps the stored files so they can be removed if the import fails
+	var written []string
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		restaurant = models.Restaurant{
+			OwnerID:         ownerID,
+			Title:           manifest.Restaurant.Title,
+			Type:            manifest.Restaurant.Type,
+			Description:     manifest.Restaurant.Description,
+			Address:         manifest.Restaurant.Address,
+			Phone:           manifest.Restaurant.Phone,
+			DefaultLanguage: manifest.Restaurant.DefaultLanguage,
+		}
+		if restaurant.DefaultLanguage == "" {
+			restaurant.DefaultLanguage = "uk"
+		}
+		if err := tx.Create(&restaurant).Error; err != nil {
+			return err
+		}
+
+		if err := createTranslations(tx, manifest.Restaurant.Translations, restaurant.ID, nil, nil); err != nil {
+			return err
+		}
+
+		for _, archivedMenu := range manifest.Restaurant.Menus {
+			menu := models.Menu{RestaurantID: restaurant.ID, Title: archivedMenu.Title}
+			if err := tx.Create(&menu).Error; err != nil {
+				return err
+			}
+
+			if err := createTranslations(tx, archivedMenu.Translations, restaurant.ID, &menu.ID, nil); err != nil {
+				return err
+			}
+
+			for _, archivedItem := range archivedMenu.MenuItems {
+				menuItem := models.MenuItem{
+					MenuID:      menu.ID,
+					Picture:     opts.DefaultPicture,
+					Title:       archivedItem.Title,
+					Description: archivedItem.Description,
+					PriceUAH:    archivedItem.PriceUAH,
+				}
+				if archivedItem.Picture != "" && !strings.HasPrefix(archivedItem.Picture, imagesDir) {
+					menuItem.Picture = archivedItem.Picture
+				}
+
+				if err := tx.Create(&menuItem).Error; err != nil {
+					return err
+				}
+
+				if strings.HasPrefix(archivedItem.Picture, imagesDir) {
+					name := fmt.Sprintf("menuitem-%d%s", menuItem.ID, strings.ToLower(path.Ext(archivedItem.Picture)))
+					target := filepath.Join(opts.ImagesDir, name)
+
+					if err := extractFile(files[archivedItem.Picture], target); err != nil {
+						return err
+					}
+					written = append(written, target)
+
+					menuItem.Picture = strings.TrimSuffix(opts.ImagesURL, "/") + "/" + name
+					if err := tx.Model(&menuItem).Update("picture", menuItem.Picture).Error; err != nil {
+						return err
+					}
+				}
+
+				if err := pricehistory.Record(tx, menuItem, restaurant.ID, 0, ownerID); err != nil {
+					return err
+				}
+
+				if err := createTranslations(tx, archivedItem.Translations, restaurant.ID, nil, &menuItem.ID); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		for _, file := range written {
+			_ = os.Remove(file)
+		}
+		return models.Restaurant{}, err
+	}
+
+	return restaurant, nil
+}
+
+// readManifest decodes the manifest file of an archive.
+func readManifest(file *zip.File) (Manifest, error) {
+	var manifest Manifest
+
+	if file == nil {
+		return manifest, errors.New("the archive has no manifest.json")
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return manifest, err
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("error decoding manifest.json: %v", err)
+	}
+
+	if manifest.Version != Version {
+		return manifest, fmt.Errorf("unsupported archive version %d, expected %d", manifest.Version, Version)
+	}
+
+	return manifest, nil
+}
+
+// validate checks the manifest before anything is imported.
+func validate(manifest Manifest, files map[string]*zip.File) error {
+	if manifest.Restaurant.Title == "" {
+		return errors.New("restaurant title cannot be empty")
+	}
+
+	if len(manifest.Restaurant.DefaultLanguage) > 8 {
+		return fmt.Errorf("invalid default language %q", manifest.Restaurant.DefaultLanguage)
+	}
+
+	if err := validateTranslations(manifest.Restaurant.Translations, "restaurant"); err != nil {
+		return err
+	}
+
+	menuTitles := make(map[string]bool)
+	for _, menu := range manifest.Restaurant.Menus {
+		if menu.Title == "" {
+			return errors.New("menu title cannot be empty")
+		}
+		if menuTitles[strings.ToLower(menu.Title)] {
+			return fmt.Errorf("duplicate menu %q", menu.Title)
+		}
+		menuTitles[strings.ToLower(menu.Title)] = true
+
+		if err := validateTranslations(menu.Translations, fmt.Sprintf("menu %q", menu.Title)); err != nil {
+			return err
+		}
+
+		for _, menuItem := range menu.MenuItems {
+			if menuItem.Title == "" {
+				return fmt.Errorf("menu item title in menu %q cannot be empty", menu.Title)
+			}
+
+			if err := validateTranslations(menuItem.Translations, fmt.Sprintf("menu item %q", menuItem.Title)); err != nil {
+				return err
+			}
+
+			if menuItem.Picture == "" {
+				continue
+			}
+
+			if strings.HasPrefix(menuItem.Picture, imagesDir) {
+				name := strings.TrimPrefix(menuItem.Picture, imagesDir)
+				if name == "" || path.Base(name) != name || strings.HasPrefix(name, ".") {
+					return fmt.Errorf("invalid picture path %q", menuItem.Picture)
+				}
+				if files[menuItem.Picture] == nil {
+					return fmt.Errorf("picture %q is missing from the archive", menuItem.Picture)
+				}
+				if err := checkImage(files[menuItem.Picture]); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if u, err := url.Parse(menuItem.Picture); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid picture %q, expected an image path or a URL", menuItem.Picture)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateTranslations checks that the translations of the owner each have a distinct language.
+func validateTranslations(translations []Translation, owner string) error {
+	languages := make(map[string]bool)
+	for _, translation := range translations {
+		if translation.Language == "" || len(translation.Language) > 8 {
+			return fmt.Errorf("invalid translation language %q of %s", translation.Language, owner)
+		}
+		if languages[translation.Language] {
+			return fmt.Errorf("duplicate %q translation of %s", translation.Language, owner)
+		}
+		languages[translation.Language] = true
+	}
+
+	return nil
+}
+
+// groupTranslations splits the translations of a restaurant into the restaurant ones
+// and the ones of its menus and menu items by their IDs.
+func groupTranslations(translations []models.Translation) ([]Translation, map[uint][]Translation, map[uint][]Translation) {
+	var restaurantTranslations []Translation
+	menuTranslations := make(map[uint][]Translation)
+	menuItemTranslations := make(map[uint][]Translation)
+
+	for _, translation := range translations {
+		archived := Translation{
+			Language:    translation.Language,
+			Title:       translation.Title,
+			Description: translation.Description,
+		}
+
+		switch {
+		case translation.MenuItemID != nil:
+			menuItemTranslations[*translation.MenuItemID] = append(menuItemTranslations[*translation.MenuItemID], archived)
+		case translation.MenuID != nil:
+			menuTranslations[*translation.MenuID] = append(menuTranslations[*translation.MenuID], archived)
+		default:
+			restaurantTranslations = append(restaurantTranslations, archived)
+		}
+	}
+
+	return restaurantTranslations, menuTranslations, menuItemTranslations
+}
+
+// createTranslations stores the archived translations of the restaurant, or of its menu or menu item if given.
+func createTranslations(tx *gorm.DB, archived []Translation, restaurantID uint, menuID, menuItemID *uint) error {
+	if len(archived) == 0 {
+		return nil
+	}
+
+	translations := make([]models.Translation, 0, len(archived))
+	for _, translation := range archived {
+		translations = append(translations, models.Translation{
+			RestaurantID: restaurantID,
+			MenuID:       menuID,
+			MenuItemID:   menuItemID,
+			Language:     translation.Language,
+			Title:        translation.Title,
+			Description:  translation.Description,
+		})
+	}
+
+	return tx.Omit("Restaurant", "Menu", "MenuItem").Create(&translations).Error
+}
+
+// checkImage checks that the archived picture is a JPEG, PNG or GIF image matching its extension.
+func checkImage(file *zip.File) error {
+	format, ok := imageFormats[strings.ToLower(path.Ext(file.Name))]
+	if !ok {
+		return fmt.Errorf("picture %q is not a JPEG, PNG or GIF image", file.Name)
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, decoded, err := image.DecodeConfig(rc)
+	if err != nil || decoded != format {
+		return fmt.Errorf("picture %q is not a valid %s image", file.Name, strings.ToUpper(format))
+	}
+
+	return nil
+}
+
+// storedImage returns the file name of a picture served from the application storage,
+// if the file exists in the images directory.
+func storedImage(picture string, opts Options) (string, bool) {
+	imagesURL, err := url.Parse(opts.ImagesURL)
+	if err != nil {
+		return "", false
+	}
+
+	name, ok := storage.ImageName(picture, imagesURL.Path)
+	if !ok {
+		return "", false
+	}
+
+	if _, err := os.Stat(filepath.Join(opts.ImagesDir, name)); err != nil {
+		return "", false
+	}
+
+	return name, true
+}
+
+// addFile copies the file at source into the archive under the given name.
+func addFile(zw *zip.Writer, name, source string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(fw, file)
+	return err
+}
+
+// extractFile copies the archived file to target.
+func extractFile(file *zip.File, target string) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	n, err := io.Copy(out, io.LimitReader(rc, maxImageSize+1))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxImageSize {
+		err = fmt.Errorf("image %q is larger than %d MB", file.Name, maxImageSize>>20)
+	}
+	if err != nil {
+		_ = os.Remove(target)
+	}
+
+	return err
+}
@@ -0,0 +1,228 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPNG returns a small PNG image.
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// zipFiles packs the contents into an in-memory archive and returns its files by name.
+func zipFiles(t *testing.T, contents map[string][]byte) map[string]*zip.File {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for name, content := range contents {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, file := range zr.File {
+		files[file.Name] = file
+	}
+
+	return files
+}
+
+func TestReadManifest(t *testing.T) {
+	current, err := json.Marshal(Manifest{Version: Version, Restaurant: Restaurant{Title: "Пузата хата"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	future, err := json.Marshal(Manifest{Version: Version + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := zipFiles(t, map[string][]byte{
+		"current.json": current,
+		"future.json":  future,
+		"broken.json":  []byte("{"),
+	})
+
+	manifest, err := readManifest(files["current.json"])
+	if err != nil || manifest.Restaurant.Title != "Пузата хата" {
+		t.Errorf("readManifest = %+v, %v", manifest, err)
+	}
+
+	for _, name := range []string{"future.json", "broken.json", "missing.json"} {
+		if _, err := readManifest(files[name]); err == nil {
+			t.Errorf("readManifest(%s) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	files := zipFiles(t, map[string][]byte{
+		"images/borshch.png":  testPNG(t),
+		"images/fake.png":     []byte("not an image"),
+		"images/mislabel.jpg": testPNG(t),
+		"images/script.svg":   []byte("<svg/>"),
+	})
+
+	withPicture := func(picture string) Manifest {
+		return Manifest{Restaurant: Restaurant{Title: "Пузата хата", Menus: []Menu{{
+			Title:     "Обід",
+			MenuItems: []MenuItem{{Title: "Борщ", Picture: picture}},
+		}}}}
+	}
+
+	tests := []struct {
+		name     string
+		manifest Manifest
+		wantErr  string
+	}{
+		{name: "archived picture", manifest: withPicture("images/borshch.png")},
+		{name: "picture URL", manifest: withPicture("https://cdn.test/borshch.png")},
+		{name: "default picture", manifest: withPicture("")},
+		{name: "no restaurant title", manifest: Manifest{}, wantErr: "restaurant title"},
+		{
+			name:     "too long default language",
+			manifest: Manifest{Restaurant: Restaurant{Title: "Пузата хата", DefaultLanguage: "uk-UA-x-kyiv"}},
+			wantErr:  "default language",
+		},
+		{
+			name:     "duplicate menu in a different case",
+			manifest: Manifest{Restaurant: Restaurant{Title: "Пузата хата", Menus: []Menu{{Title: "Обід"}, {Title: "ОБІД"}}}},
+			wantErr:  "duplicate menu",
+		},
+		{
+			name:     "no menu item title",
+			manifest: Manifest{Restaurant: Restaurant{Title: "Пузата хата", Menus: []Menu{{Title: "Обід", MenuItems: []MenuItem{{}}}}}},
+			wantErr:  "menu item title",
+		},
+		{name: "picture path outside the images", manifest: withPicture("images/../manifest.json"), wantErr: "invalid picture path"},
+		{name: "missing picture", manifest: withPicture("images/missing.png"), wantErr: "missing from the archive"},
+		{name: "picture that is not an image", manifest: withPicture("images/fake.png"), wantErr: "not a valid PNG"},
+		{name: "picture not matching its extension", manifest: withPicture("images/mislabel.jpg"), wantErr: "not a valid JPEG"},
+		{name: "picture of another type", manifest: withPicture("images/script.svg"), wantErr: "not a JPEG, PNG or GIF"},
+		{name: "picture URL of another scheme", manifest: withPicture("javascript:alert(1)"), wantErr: "invalid picture"},
+		{
+			name: "translations",
+			manifest: Manifest{Restaurant: Restaurant{
+				Title:        "Пузата хата",
+				Translations: []Translation{{Language: "en", Title: "Potato House"}, {Language: "pl"}},
+				Menus: []Menu{{
+					Title:        "Обід",
+					Translations: []Translation{{Language: "en", Title: "Lunch"}},
+					MenuItems:    []MenuItem{{Title: "Борщ", Translations: []Translation{{Language: "en", Title: "Borscht"}}}},
+				}},
+			}},
+		},
+		{
+			name:     "translation without a language",
+			manifest: Manifest{Restaurant: Restaurant{Title: "Пузата хата", Translations: []Translation{{Title: "Potato House"}}}},
+			wantErr:  "invalid translation language",
+		},
+		{
+			name: "duplicate menu item translation",
+			manifest: Manifest{Restaurant: Restaurant{Title: "Пузата хата", Menus: []Menu{{
+				Title:     "Обід",
+				MenuItems: []MenuItem{{Title: "Борщ", Translations: []Translation{{Language: "en"}, {Language: "en"}}}},
+			}}}},
+			wantErr: `duplicate "en" translation of menu item "Борщ"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(tt.manifest, files)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGroupTranslations(t *testing.T) {
+	id := func(id uint) *uint {
+		return &id
+	}
+
+	restaurantTranslations, menuTranslations, menuItemTranslations := groupTranslations([]models.Translation{
+		{RestaurantID: 1, Language: "en", Title: "Potato House", Description: "Ukrainian food"},
+		{RestaurantID: 1, MenuID: id(3), Language: "en", Title: "Lunch"},
+		{RestaurantID: 1, MenuItemID: id(10), Language: "en", Title: "Borscht"},
+		{RestaurantID: 1, MenuItemID: id(10), Language: "pl", Title: "Barszcz"},
+	})
+
+	if want := []Translation{{Language: "en", Title: "Potato House", Description: "Ukrainian food"}}; !reflect.DeepEqual(restaurantTranslations, want) {
+		t.Errorf("restaurant translations = %+v, want %+v", restaurantTranslations, want)
+	}
+
+	if want := map[uint][]Translation{3: {{Language: "en", Title: "Lunch"}}}; !reflect.DeepEqual(menuTranslations, want) {
+		t.Errorf("menu translations = %+v, want %+v", menuTranslations, want)
+	}
+
+	want := map[uint][]Translation{10: {{Language: "en", Title: "Borscht"}, {Language: "pl", Title: "Barszcz"}}}
+	if !reflect.DeepEqual(menuItemTranslations, want) {
+		t.Errorf("menu item translations = %+v, want %+v", menuItemTranslations, want)
+	}
+}
+
+func TestStoredImage(t *testing.T) {
+	imagesDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(imagesDir, "menuitem-1.png"), testPNG(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{ImagesDir: imagesDir, ImagesURL: "http://app.test/api/v1/storage/images"}
+
+	tests := []struct {
+		picture string
+		want    string
+		wantOK  bool
+	}{
+		{picture: "http://app.test/api/v1/storage/images/menuitem-1.png", want: "menuitem-1.png", wantOK: true},
+		{picture: "http://app.test/api/v1/storage/images/menuitem-2.png"},
+		{picture: "https://cdn.test/menuitem-1.png"},
+	}
+
+	for _, tt := range tests {
+		got, ok := storedImage(tt.picture, opts)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("storedImage(%q) = %q, %v, want %q, %v", tt.picture, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/mailer"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	purposeChangeEmail = "change_email"
+
+	// Ways to handle the restaurants of a deleted account.
+	restaurantsTransfer = "transfer"
+	restaurantsDelete   = "delete"
+)
+
+// updateProfileBody is the update profile request body structure. Omitted fields are not changed.
+type updateProfileBody struct {
+	FirstName *string `json:"firstName"`
+	LastName  *string `json:"lastName"`
+}
+
+// changeEmailBody is the change email request body structure. Users without a password
+// confirm the change with the second factor.
+type changeEmailBody struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	twoFactorCodeBody
+}
+
+// deleteAccountBody is the delete account request body structure. Users who own restaurants choose
+// whether they are transferred to the user with the TransferTo email or deleted with the account.
+type deleteAccountBody struct {
+	Password string `json:"password"`
+	twoFactorCodeBody
+	Restaurants string `json:"restaurants"`
+	TransferTo  string `json:"transferTo"`
+}
+
+// profileResponse is the profile of the current user.
+type profileResponse struct {
+	ID               uint
+	FirstName        string
+	LastName         string
+	Email            string
+	EmailVerified    bool
+	Admin            bool
+	TwoFactorEnabled bool
+	CreatedAt        time.Time
+}
+
+// accountExport is the personal data export of a user.
+type accountExport struct {
+	ExportedAt      time.Time
+	Profile         profileResponse
+	Restaurants     []models.Restaurant
+	Reviews         []models.Review
+	FavouriteLists  []models.FavouriteList
+	Carts           []models.Cart
+	Orders          []models.Order
+	Reservations    []models.Reservation
+	Sessions        []models.Session
+	OAuthIdentities []models.OAuthIdentity
+}
+
+// GetProfile returns the profile of the current user.
+func (m *Repository) GetProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  newProfileResponse(user),
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// UpdateProfile changes the name of the current user.
+func (m *Repository) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body updateProfileBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding profile data"), http.StatusBadRequest)
+		return
+	}
+
+	updates := map[string]any{}
+	for _, field := range []struct {
+		name, column string
+		value        *string
+		target       *string
+	}{
+		{"firstName", "first_name", body.FirstName, &user.FirstName},
+		{"lastName", "last_name", body.LastName, &user.LastName},
+	} {
+		if field.value == nil {
+			continue
+		}
+
+		value := strings.TrimSpace(*field.value)
+		if value == "" || len(value) > 255 {
+			_ = m.errorJSON(w, r, apierror.Field(field.name, apierror.Invalid, "the name must be 1 to 255 characters long"), http.StatusBadRequest)
+			return
+		}
+
+		updates[field.column] = value
+		*field.target = value
+	}
+
+	if len(updates) > 0 {
+		if err := m.App.DB.Model(&user).Updates(updates).Error; err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "profile updated",
+		Data:    newProfileResponse(user),
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ChangeEmail sends a confirmation link to the new email address of the current user.
+// The email is only changed once the link is opened.
+func (m *Repository) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body changeEmailBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding change email data"), http.StatusBadRequest)
+		return
+	}
+
+	email := normalizeEmail(body.Email)
+	if !validateEmail(email) {
+		_ = m.errorJSON(w, r, apierror.Field("email", apierror.Invalid, "invalid email"), http.StatusBadRequest)
+		return
+	}
+
+	if strings.EqualFold(email, user.Email) {
+		_ = m.errorJSON(w, r, errors.New("this is the current email address"), http.StatusConflict)
+		return
+	}
+
+	if err := confirmPassword(user, body.Password); err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	taken, err := m.emailTaken(email)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		_ = m.errorJSON(w, r, errors.New("the email address is already in use"), http.StatusConflict)
+		return
+	}
+
+	if user.Password == "" {
+		err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+			return verifySecondFactor(tx, user, body.twoFactorCodeBody)
+		})
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := m.sendEmailChangeEmail(user, email); err != nil {
+		_ = m.errorJSON(w, r, apierror.Wrap(apierror.Unavailable, err))
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "a confirmation link has been sent to the new email address",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ConfirmEmailChange changes the email of a user with the token of the link sent to the new address,
+// which also verifies it, and tells the old address about the change. Password reset links sent
+// before the change can no longer be used. The link works only while the user has the email it changes
+// from, so it cannot be used twice or after another change.
+func (m *Repository) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	user, claims, err := m.parseLinkToken(r.URL.Query().Get("token"), purposeChangeEmail)
+	if err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	oldEmail := user.Email
+
+	taken, err := m.emailTaken(claims.Email)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		_ = m.errorJSON(w, r, errors.New("the email address is already in use"), http.StatusConflict)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Another request may have changed the email since the link was checked
+		result := tx.Model(&user).Where("email = ?", oldEmail).
+			Updates(map[string]any{"email": normalizeEmail(claims.Email), "email_verified_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return apierror.New(apierror.BadRequest, "the link is invalid or has expired")
+		}
+
+		return tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	logMailError(m.App.Mailer.Send(mailer.Message{
+		To:      oldEmail,
+		Subject: "Your email address has been changed",
+		Text: fmt.Sprintf("Hi %s,\n\nthe email address of your Peparesu account has been changed to %s.\n\n"+
+			"If you did not change it, reset your password and contact us.\n",
+			user.FirstName, claims.Email),
+	}), user)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "email changed",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteAccount deletes the current user with all their data. The password, and the second factor
+// when it is enabled, confirm the request; users without a password confirm it with the second factor
+// only. Owned restaurants are transferred or deleted as chosen.
+func (m *Repository) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body deleteAccountBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding delete account data"), http.StatusBadRequest)
+		return
+	}
+
+	if err := confirmPassword(user, body.Password); err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	// The last admin cannot leave the platform without admins
+	if user.UserTypeID == 2 {
+		var admins int64
+		if err := m.App.DB.Model(&models.User{}).Where("user_type_id = ?", 2).Count(&admins).Error; err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		if admins <= 1 {
+			_ = m.errorJSON(w, r, errors.New("the last admin account cannot be deleted"), http.StatusConflict)
+			return
+		}
+	}
+
+	var restaurantIDs []uint
+	if err := m.App.DB.Model(&models.Restaurant{}).Where("owner_id = ?", user.ID).Pluck("id", &restaurantIDs).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	var newOwner models.User
+	if len(restaurantIDs) > 0 {
+		switch body.Restaurants {
+		case restaurantsDelete:
+		case restaurantsTransfer:
+			var err error
+			newOwner, err = userByEmail(m.App.DB, body.TransferTo)
+			if errors.Is(err, errEmailAmbiguous) {
+				_ = m.errorJSON(w, r, apierror.Field("transferTo", apierror.Invalid, "several users have this email"))
+				return
+			}
+			if err != nil || newOwner.ID == user.ID {
+				_ = m.errorJSON(w, r, apierror.Field("transferTo", apierror.Invalid, "no other user with this email"), http.StatusBadRequest)
+				return
+			}
+			if newOwner.EmailVerifiedAt == nil {
+				_ = m.errorJSON(w, r, apierror.New(apierror.EmailNotVerified, "the new owner has not verified the email address"))
+				return
+			}
+		default:
+			_ = m.errorJSON(w, r, apierror.Field("restaurants", apierror.Invalid,
+				fmt.Sprintf("the account owns %d restaurants, choose to %s or %s them", len(restaurantIDs), restaurantsTransfer, restaurantsDelete)), http.StatusConflict)
+			return
+		}
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if user.TOTPEnabledAt != nil {
+			if err := verifySecondFactor(tx, user, body.twoFactorCodeBody); err != nil {
+				return err
+			}
+		}
+
+		if newOwner.ID != 0 {
+			if err := transferRestaurants(tx, restaurantIDs, newOwner.ID); err != nil {
+				return err
+			}
+		}
+
+		// The ratings of the restaurants the user reviewed change with the reviews
+		var reviewedIDs []uint
+		if err := tx.Model(&models.Review{}).Where("user_id = ?", user.ID).Pluck("restaurant_id", &reviewedIDs).Error; err != nil {
+			return err
+		}
+
+		// Everything else of the user is deleted by the foreign keys
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+
+		err := tx.Where("kind = ? AND key = ?", models.LoginLockAccount, normalizeEmail(user.Email)).
+			Delete(&models.LoginLock{}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, restaurantID := range reviewedIDs {
+			if err := refreshRestaurantRating(tx, restaurantID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	clearAuthCookies(w)
+
+	logMailError(m.App.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your account has been deleted",
+		Text:    fmt.Sprintf("Hi %s,\n\nyour Peparesu account and its data have been deleted.\n", user.FirstName),
+	}), user)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "account deleted",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ExportAccount downloads the personal data of the current user as a JSON document.
+func (m *Repository) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	export := accountExport{
+		ExportedAt: time.Now(),
+		Profile:    newProfileResponse(user),
+	}
+
+	db := m.App.DB
+	for _, query := range []*gorm.DB{
+		db.Where("owner_id = ?", user.ID).Find(&export.Restaurants),
+		db.Preload("MenuItems").Where("user_id = ?", user.ID).Find(&export.Reviews),
+		db.Preload("Entries").Where("user_id = ?", user.ID).Find(&export.FavouriteLists),
+		db.Preload("Items").Where("user_id = ?", user.ID).Find(&export.Carts),
+		db.Preload("Items").Where("user_id = ?", user.ID).Order("created_at").Find(&export.Orders),
+		db.Where("user_id = ?", user.ID).Order("starts_at").Find(&export.Reservations),
+		db.Where("user_id = ?", user.ID).Order("created_at").Find(&export.Sessions),
+		db.Where("user_id = ?", user.ID).Find(&export.OAuthIdentities),
+	} {
+		if query.Error != nil {
+			_ = m.errorJSON(w, r, query.Error, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	out, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="peparesu-account-%d.json"`, user.ID))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(out)
+}
+
+// sendEmailChangeEmail sends the link that confirms the new email address of the user to that address.
+func (m *Repository) sendEmailChangeEmail(user models.User, email string) error {
+	token, err := m.signLinkToken(user, purposeChangeEmail, email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := m.appURL("/api/v1/email-change/confirm?token=" + url.QueryEscape(token))
+
+	return m.App.Mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Confirm your new email address",
+		Text: fmt.Sprintf("Hi %s,\n\nconfirm the new email address of your Peparesu account by opening this link:\n\n%s\n\n"+
+			"The link is valid for %d hours. If you did not ask to change the email, ignore this email.\n",
+			user.FirstName, link, int(emailVerificationTTL.Hours())),
+	})
+}
+
+// emailTaken reports whether a user has the email address.
+func (m *Repository) emailTaken(email string) (bool, error) {
+	var count int64
+	err := m.App.DB.Model(&models.User{}).Where("LOWER(email) = LOWER(?)", email).Count(&count).Error
+
+	return count > 0, err
+}
+
+// newProfileResponse returns the profile of the user.
+func newProfileResponse(user models.User) profileResponse {
+	return profileResponse{
+		ID:               user.ID,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerifiedAt != nil,
+		Admin:            user.UserTypeID == 2,
+		TwoFactorEnabled: user.TOTPEnabledAt != nil,
+		CreatedAt:        user.CreatedAt,
+	}
+}
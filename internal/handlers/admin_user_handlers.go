@@ -0,0 +1,704 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// impersonationTTL is how long an impersonation session lasts. It cannot be refreshed.
+	impersonationTTL = accessTokenTTL
+	// impersonationHeader marks the responses to impersonation sessions with the ID of the admin.
+	impersonationHeader = "X-Impersonated-By"
+
+	defaultPerPage  = 20
+	maxPerPage      = 100
+	maxReasonLength = 1000
+
+	revokedSuspended = "suspended"
+
+	auditRoleChange          = "role_change"
+	auditSuspend             = "suspend"
+	auditUnsuspend           = "unsuspend"
+	auditRestaurantTransfer  = "restaurant_transfer"
+	auditImpersonationStart  = "impersonation_start"
+	auditImpersonationEnd    = "impersonation_end"
+	auditImpersonatedRequest = "impersonated_request"
+
+	revokedImpersonationEnd = "impersonation_end"
+)
+
+// roles maps the role names of the API to the user types.
+var roles = map[string]uint{
+	"user":  1,
+	"admin": 2,
+}
+
+// userRoleBody is the change role request body structure.
+type userRoleBody struct {
+	Role string `json:"role"`
+}
+
+// adminReasonBody is the request body structure of the admin actions that need a reason.
+type adminReasonBody struct {
+	Reason string `json:"reason"`
+}
+
+// restaurantOwnerBody is the transfer restaurant request body structure.
+type restaurantOwnerBody struct {
+	OwnerID uint `json:"ownerId"`
+}
+
+// adminUserResponse is a user as admins see it.
+type adminUserResponse struct {
+	profileResponse
+	Role             string
+	SuspendedAt      *time.Time
+	SuspendedReason  string
+	RestaurantsCount int64
+}
+
+// usersPage is a page of the user list.
+type usersPage struct {
+	Users   []adminUserResponse
+	Total   int64
+	Page    int
+	PerPage int
+}
+
+// auditLogPage is a page of the audit log.
+type auditLogPage struct {
+	Entries []models.AuditLog
+	Total   int64
+	Page    int
+	PerPage int
+}
+
+// impersonationResponse is the access token of an impersonation session.
+type impersonationResponse struct {
+	SessionID   uint
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// GetUsers lets an admin search the users. The q parameter matches the name and the email, role and
+// suspended filter the users, and page and perPage paginate them.
+func (m *Repository) GetUsers(w http.ResponseWriter, r *http.Request) {
+	urlQuery := r.URL.Query()
+
+	page, perPage, err := pagination(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	query := m.App.DB.Model(&models.User{})
+
+	if q := strings.TrimSpace(urlQuery.Get("q")); q != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+		query = query.Where("email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ? OR CONCAT(first_name, ' ', last_name) ILIKE ?",
+			pattern, pattern, pattern, pattern)
+	}
+
+	if role := urlQuery.Get("role"); role != "" {
+		userTypeID, ok := roles[role]
+		if !ok {
+			_ = m.errorJSON(w, r, apierror.InvalidParam("role"), http.StatusBadRequest)
+			return
+		}
+
+		query = query.Where("user_type_id = ?", userTypeID)
+	}
+
+	if value := urlQuery.Get("suspended"); value != "" {
+		suspended, err := strconv.ParseBool(value)
+		if err != nil {
+			_ = m.errorJSON(w, r, apierror.InvalidParam("suspended"), http.StatusBadRequest)
+			return
+		}
+
+		if suspended {
+			query = query.Where("suspended_at IS NOT NULL")
+		} else {
+			query = query.Where("suspended_at IS NULL")
+		}
+	}
+
+	// A new session for each of the count and the page queries
+	query = query.Session(&gorm.Session{})
+
+	result := usersPage{Users: []adminUserResponse{}, Page: page, PerPage: perPage}
+	if err := query.Count(&result.Total).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	var users []models.User
+	err = query.Order("id").Offset((page - 1) * perPage).Limit(perPage).Find(&users).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	for _, user := range users {
+		response, err := m.newAdminUserResponse(user)
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		result.Users = append(result.Users, response)
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  result,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetUser lets an admin view a user.
+func (m *Repository) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := m.newAdminUserResponse(user)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  response,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// UpdateUserRole lets an admin promote a user to admin or demote an admin. Admins cannot change
+// their own role, so there is always an admin left.
+func (m *Repository) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	admin, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, ok := m.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body userRoleBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding role data"), http.StatusBadRequest)
+		return
+	}
+
+	userTypeID, ok := roles[body.Role]
+	if !ok {
+		_ = m.errorJSON(w, r, apierror.Field("role", apierror.Invalid, "expected user or admin"), http.StatusBadRequest)
+		return
+	}
+
+	if user.ID == admin.ID {
+		_ = m.errorJSON(w, r, errors.New("admins cannot change their own role"), http.StatusForbidden)
+		return
+	}
+
+	if user.UserTypeID != userTypeID {
+		err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Update("user_type_id", userTypeID).Error; err != nil {
+				return err
+			}
+
+			return audit(tx, r, models.AuditLog{
+				ActorID:      &admin.ID,
+				Action:       auditRoleChange,
+				TargetUserID: &user.ID,
+				Details:      "role: " + body.Role,
+			})
+		})
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "the user is now " + body.Role,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// SuspendUser lets an admin suspend a user, such as a spammer. The sessions of the user are revoked,
+// and RequireAuth refuses the user and the API keys of their restaurants until they are unsuspended.
+func (m *Repository) SuspendUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, ok := m.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body adminReasonBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding suspension data"), http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" || len(reason) > maxReasonLength {
+		_ = m.errorJSON(w, r, apierror.Field("reason", apierror.Invalid, fmt.Sprintf("the reason must be 1 to %d characters long", maxReasonLength)), http.StatusBadRequest)
+		return
+	}
+
+	if user.UserTypeID == roles["admin"] {
+		_ = m.errorJSON(w, r, errors.New("admins cannot be suspended, change the role first"), http.StatusForbidden)
+		return
+	}
+
+	if user.SuspendedAt != nil {
+		_ = m.errorJSON(w, r, errors.New("the user is already suspended"), http.StatusConflict)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]any{"suspended_at": time.Now(), "suspended_reason": reason}).Error
+		if err != nil {
+			return err
+		}
+
+		if _, err := revokeUserSessions(tx, user.ID, 0, revokedSuspended); err != nil {
+			return err
+		}
+
+		return audit(tx, r, models.AuditLog{
+			ActorID:      &admin.ID,
+			Action:       auditSuspend,
+			TargetUserID: &user.ID,
+			Details:      reason,
+		})
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "user suspended",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// UnsuspendUser lets an admin lift the suspension of a user.
+func (m *Repository) UnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, ok := m.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.SuspendedAt == nil {
+		_ = m.errorJSON(w, r, errors.New("the user is not suspended"), http.StatusConflict)
+		return
+	}
+
+	err := m.App.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]any{"suspended_at": nil, "suspended_reason": ""}).Error
+		if err != nil {
+			return err
+		}
+
+		return audit(tx, r, models.AuditLog{
+			ActorID:      &admin.ID,
+			Action:       auditUnsuspend,
+			TargetUserID: &user.ID,
+		})
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "user unsuspended",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// TransferRestaurant lets an admin make another user the owner of a restaurant.
+func (m *Repository) TransferRestaurant(w http.ResponseWriter, r *http.Request) {
+	admin, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
+		return
+	}
+
+	var body restaurantOwnerBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding owner data"), http.StatusBadRequest)
+		return
+	}
+
+	var restaurant models.Restaurant
+	if err := m.App.DB.First(&restaurant, restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
+		return
+	}
+
+	var owner models.User
+	if err := m.App.DB.First(&owner, "id = ?", body.OwnerID).Error; err != nil {
+		_ = m.errorJSON(w, r, apierror.Field("ownerId", apierror.Invalid, "user not found"), http.StatusBadRequest)
+		return
+	}
+
+	if owner.ID == restaurant.OwnerID {
+		_ = m.errorJSON(w, r, errors.New("the user already owns the restaurant"), http.StatusConflict)
+		return
+	}
+
+	if owner.SuspendedAt != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.AccountSuspended, "the new owner is suspended"))
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := transferRestaurants(tx, []uint{restaurant.ID}, owner.ID); err != nil {
+			return err
+		}
+
+		return audit(tx, r, models.AuditLog{
+			ActorID:      &admin.ID,
+			Action:       auditRestaurantTransfer,
+			TargetUserID: &owner.ID,
+			RestaurantID: &restaurant.ID,
+			Details:      fmt.Sprintf("from user %d to user %d", restaurant.OwnerID, owner.ID),
+		})
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("restaurant transferred to %s %s", owner.FirstName, owner.LastName),
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ImpersonateUser lets an admin act as a user, to see what the user sees. It returns the access token
+// of a new session of the user for the Authorization header, so the session of the admin is kept.
+// The session is marked with the admin, cannot be refreshed and cannot manage the account, and
+// the requests that change anything are written to the audit log.
+func (m *Repository) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, ok := m.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body adminReasonBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding impersonation data"), http.StatusBadRequest)
+		return
+	}
+
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" || len(reason) > maxReasonLength {
+		_ = m.errorJSON(w, r, apierror.Field("reason", apierror.Invalid, fmt.Sprintf("the reason must be 1 to %d characters long", maxReasonLength)), http.StatusBadRequest)
+		return
+	}
+
+	if user.UserTypeID == roles["admin"] {
+		_ = m.errorJSON(w, r, errors.New("admins cannot be impersonated"), http.StatusForbidden)
+		return
+	}
+
+	if user.SuspendedAt != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.AccountSuspended, "suspended users cannot be impersonated"))
+		return
+	}
+
+	now := time.Now()
+	client := sessionClient(r, now)
+	session := models.Session{
+		UserID:         user.ID,
+		ImpersonatorID: &admin.ID,
+		Device:         fmt.Sprintf("Impersonation by %s %s", admin.FirstName, admin.LastName),
+		IP:             client.IP,
+		UserAgent:      client.UserAgent,
+		LastSeenAt:     now,
+		ExpiresAt:      now.Add(impersonationTTL),
+	}
+
+	var accessToken string
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		err := audit(tx, r, models.AuditLog{
+			ActorID:      &admin.ID,
+			Action:       auditImpersonationStart,
+			TargetUserID: &user.ID,
+			Details:      fmt.Sprintf("session %d: %s", session.ID, reason),
+		})
+		if err != nil {
+			return err
+		}
+
+		accessToken, err = m.signAccessToken(session, now)
+		return err
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("impersonating %s %s", user.FirstName, user.LastName),
+		Data: impersonationResponse{
+			SessionID:   session.ID,
+			AccessToken: accessToken,
+			ExpiresAt:   session.ExpiresAt,
+		},
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// EndImpersonation lets an admin end an impersonation session before it expires.
+func (m *Repository) EndImpersonation(w http.ResponseWriter, r *http.Request) {
+	admin, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := strconv.Atoi(chi.URLParam(r, "session_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("session_id"), http.StatusBadRequest)
+		return
+	}
+
+	var session models.Session
+	err = m.App.DB.First(&session, "id = ? AND impersonator_id IS NOT NULL", sessionID).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("impersonation session not found"), http.StatusNotFound)
+		return
+	}
+
+	if session.Active(time.Now()) {
+		err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+			if err := revokeSession(tx, session.ID, revokedImpersonationEnd); err != nil {
+				return err
+			}
+
+			return audit(tx, r, models.AuditLog{
+				ActorID:      &admin.ID,
+				Action:       auditImpersonationEnd,
+				TargetUserID: &session.UserID,
+				Details:      fmt.Sprintf("session %d", session.ID),
+			})
+		})
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "impersonation ended",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetAuditLog lets an admin read the audit log, newest first. The userId parameter filters
+// the entries of an admin or about a user, and action filters the action.
+func (m *Repository) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	urlQuery := r.URL.Query()
+
+	page, perPage, err := pagination(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	query := m.App.DB.Model(&models.AuditLog{})
+
+	if value := urlQuery.Get("userId"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			_ = m.errorJSON(w, r, apierror.InvalidParam("userId"), http.StatusBadRequest)
+			return
+		}
+
+		query = query.Where("actor_id = ? OR target_user_id = ?", userID, userID)
+	}
+
+	if action := urlQuery.Get("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	query = query.Session(&gorm.Session{})
+
+	result := auditLogPage{Entries: []models.AuditLog{}, Page: page, PerPage: perPage}
+	if err := query.Count(&result.Total).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = query.Order("created_at DESC, id DESC").Offset((page - 1) * perPage).Limit(perPage).Find(&result.Entries).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  result,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// requireActiveAccount writes an account_suspended error if the user is suspended.
+func (m *Repository) requireActiveAccount(w http.ResponseWriter, r *http.Request, user models.User) bool {
+	if user.SuspendedAt != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.AccountSuspended, "the account is suspended"))
+		return false
+	}
+
+	return true
+}
+
+// auditImpersonatedRequest writes the requests of an impersonation session that change anything
+// to the audit log, with the admin as the actor.
+func (m *Repository) auditImpersonatedRequest(r *http.Request, session models.Session) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return
+	}
+
+	err := audit(m.App.DB, r, models.AuditLog{
+		ActorID:      session.ImpersonatorID,
+		Action:       auditImpersonatedRequest,
+		TargetUserID: &session.UserID,
+		Details:      fmt.Sprintf("session %d: %s %s", session.ID, r.Method, r.URL.Path),
+	})
+	if err != nil {
+		log.Printf("error auditing impersonated request of session %d: %v", session.ID, err)
+	}
+}
+
+// adminTargetUser loads the user of the user_id URL parameter.
+func (m *Repository) adminTargetUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	var user models.User
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "user_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("user_id"), http.StatusBadRequest)
+		return user, false
+	}
+
+	if err := m.App.DB.First(&user, "id = ?", userID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("user not found"), http.StatusNotFound)
+		return user, false
+	}
+
+	return user, true
+}
+
+// newAdminUserResponse returns the user as admins see it.
+func (m *Repository) newAdminUserResponse(user models.User) (adminUserResponse, error) {
+	response := adminUserResponse{
+		profileResponse: newProfileResponse(user),
+		Role:            "user",
+		SuspendedAt:     user.SuspendedAt,
+		SuspendedReason: user.SuspendedReason,
+	}
+
+	for name, userTypeID := range roles {
+		if user.UserTypeID == userTypeID {
+			response.Role = name
+		}
+	}
+
+	err := m.App.DB.Model(&models.Restaurant{}).Where("owner_id = ?", user.ID).Count(&response.RestaurantsCount).Error
+
+	return response, err
+}
+
+// audit writes the entry to the audit log with the IP address of the request.
+func audit(tx *gorm.DB, r *http.Request, entry models.AuditLog) error {
+	entry.IP = clientIP(r)
+
+	return tx.Create(&entry).Error
+}
+
+// pagination returns the page and perPage query parameters, which default to the first page
+// of defaultPerPage items.
+func pagination(r *http.Request) (int, int, error) {
+	page, perPage := 1, defaultPerPage
+
+	if value := r.URL.Query().Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return 0, 0, apierror.InvalidParam("page")
+		}
+		page = n
+	}
+
+	if value := r.URL.Query().Get("perPage"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPerPage {
+			return 0, 0, apierror.InvalidParam("perPage")
+		}
+		perPage = n
+	}
+
+	return page, perPage, nil
+}
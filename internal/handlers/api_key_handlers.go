@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// apiKeyPrefix starts every API key, which tells API keys apart from access JWTs.
+	apiKeyPrefix = "pk_"
+	// apiKeyDisplayLength is the length of the start of a key kept to tell the keys apart.
+	apiKeyDisplayLength = 11
+)
+
+// apiKeyBody is the API key request body structure.
+type apiKeyBody struct {
+	Name      string             `json:"name"`
+	Scope     models.APIKeyScope `json:"scope"`
+	ExpiresAt *time.Time         `json:"expiresAt"`
+}
+
+// createdAPIKey is the response of the API key creation. Key is shown only once.
+type createdAPIKey struct {
+	models.APIKey
+	Key string
+}
+
+// GetAPIKeys returns the API keys of a restaurant that have not been revoked.
+func (m *Repository) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	var keys []models.APIKey
+	err := m.App.DB.Where("restaurant_id = ? AND revoked_at IS NULL", restaurantID).Order("id").Find(&keys).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  keys,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateAPIKey creates an API key of a restaurant. The key is returned only in this response.
+func (m *Repository) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	var body apiKeyBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding API key data"), http.StatusBadRequest)
+		return
+	}
+
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		_ = m.errorJSON(w, r, apierror.Field("name", apierror.Required, "name cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	if body.Scope != models.APIKeyScopeRead && body.Scope != models.APIKeyScopeWrite {
+		_ = m.errorJSON(w, r, apierror.Field("scope", apierror.Invalid, "invalid scope, expected 'read' or 'write'"), http.StatusBadRequest)
+		return
+	}
+
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		_ = m.errorJSON(w, r, apierror.Field("expiresAt", apierror.OutOfRange, "expiresAt must be in the future"), http.StatusBadRequest)
+		return
+	}
+
+	value, err := randomToken(32)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	value = apiKeyPrefix + value
+
+	key := models.APIKey{
+		RestaurantID: restaurantID,
+		CreatedByID:  &userID,
+		Name:         body.Name,
+		Prefix:       value[:apiKeyDisplayLength],
+		KeyHash:      hashToken(value),
+		Scope:        body.Scope,
+		ExpiresAt:    body.ExpiresAt,
+	}
+
+	err = m.App.DB.Create(&key).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  createdAPIKey{APIKey: key, Key: value},
+	}
+
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// RevokeAPIKey revokes an API key of a restaurant.
+func (m *Repository) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.Atoi(chi.URLParam(r, "api_key_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("api_key_id"), http.StatusBadRequest)
+		return
+	}
+
+	result := m.App.DB.Model(&models.APIKey{}).
+		Where("id = ? AND restaurant_id = ? AND revoked_at IS NULL", keyID, restaurantID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		_ = m.errorJSON(w, r, result.Error, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		_ = m.errorJSON(w, r, errors.New("API key not found"), http.StatusNotFound)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "API key revoked",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// authenticateAPIKey returns the active API key of the Authorization header with its restaurant.
+func (m *Repository) authenticateAPIKey(r *http.Request) (models.APIKey, error) {
+	var key models.APIKey
+
+	token, ok := bearerToken(r)
+	if !ok || !isAPIKey(token) {
+		return key, errors.New("no API key found")
+	}
+
+	err := m.App.DB.Preload("Restaurant").First(&key, "key_hash = ?", hashToken(token)).Error
+	if err != nil || !key.Active(time.Now()) {
+		return key, apierror.New(apierror.Unauthorized, "API key is invalid, revoked or expired")
+	}
+
+	return key, nil
+}
+
+// apiKeyRoutes are the patterns of the integration routes that API keys can be used with: the menus,
+// the menu items, the orders and the table requests of a restaurant. Any other route, such as deleting,
+// cloning or exporting the restaurant, managing its API keys or the customer routes, needs the session
+// of a user.
+var apiKeyRoutes = map[string]bool{
+	"/api/v1/restaurants/{restaurant_id}/menus/create":                          true,
+	"/api/v1/restaurants/{restaurant_id}/menus/{menu_id}/update":                true,
+	"/api/v1/restaurants/{restaurant_id}/menus/{menu_id}/delete":                true,
+	"/api/v1/restaurants/{restaurant_id}/menus/import":                          true,
+	"/api/v1/restaurants/{restaurant_id}/menus/batch":                           true,
+	"/api/v1/restaurants/{restaurant_id}/menus/{menu_id}/create":                true,
+	"/api/v1/restaurants/{restaurant_id}/menus/{menu_id}/{menu_item_id}/update": true,
+	"/api/v1/restaurants/{restaurant_id}/menus/{menu_id}/{menu_item_id}/delete": true,
+	"/api/v1/restaurants/{restaurant_id}/orders":                                true,
+	"/api/v1/restaurants/{restaurant_id}/orders/{order_id}/{status}":            true,
+	"/api/v1/restaurants/{restaurant_id}/table-requests":                        true,
+	"/api/v1/restaurants/{restaurant_id}/table-requests/stream":                 true,
+	"/api/v1/restaurants/{restaurant_id}/table-requests/{request_id}/{action}":  true,
+}
+
+// apiKeyAllows checks that the request is to an integration route of the key's restaurant and that
+// the key scope allows its method. Read keys can only make GET and HEAD requests.
+func apiKeyAllows(key models.APIKey, r *http.Request) error {
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil || uint(restaurantID) != key.RestaurantID || !apiKeyRoutes[chi.RouteContext(r.Context()).RoutePattern()] {
+		return apierror.New(apierror.Forbidden, "API key is not valid for this route")
+	}
+
+	if key.Scope != models.APIKeyScopeWrite && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return apierror.New(apierror.Forbidden, "API key scope does not allow this request")
+	}
+
+	return nil
+}
+
+// touchAPIKey records that the key was used now, at most once per lastSeenInterval.
+func (m *Repository) touchAPIKey(key *models.APIKey) {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < lastSeenInterval {
+		return
+	}
+
+	if err := m.App.DB.Model(key).Update("last_used_at", now).Error; err != nil {
+		log.Printf("error updating API key %d: %v", key.ID, err)
+	}
+}
+
+// isAPIKey reports whether a bearer token is an API key rather than an access JWT.
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
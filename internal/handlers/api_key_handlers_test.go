@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyAllows(t *testing.T) {
+	readKey := models.APIKey{RestaurantID: 7, Scope: models.APIKeyScopeRead}
+	writeKey := models.APIKey{RestaurantID: 7, Scope: models.APIKeyScopeWrite}
+
+	tests := []struct {
+		name         string
+		key          models.APIKey
+		method       string
+		pattern      string
+		restaurantID string
+		wantErr      bool
+	}{
+		{name: "read key lists orders", key: readKey, method: http.MethodGet, pattern: "/api/v1/restaurants/{restaurant_id}/orders", restaurantID: "7"},
+		{name: "read key streams table requests", key: readKey, method: http.MethodHead, pattern: "/api/v1/restaurants/{restaurant_id}/table-requests/stream", restaurantID: "7"},
+		{name: "read key creates a menu", key: readKey, method: http.MethodPost, pattern: "/api/v1/restaurants/{restaurant_id}/menus/create", restaurantID: "7", wantErr: true},
+		{name: "write key creates a menu", key: writeKey, method: http.MethodPost, pattern: "/api/v1/restaurants/{restaurant_id}/menus/create", restaurantID: "7"},
+		{name: "write key updates an order", key: writeKey, method: http.MethodPut, pattern: "/api/v1/restaurants/{restaurant_id}/orders/{order_id}/{status}", restaurantID: "7"},
+		{name: "other restaurant", key: writeKey, method: http.MethodGet, pattern: "/api/v1/restaurants/{restaurant_id}/orders", restaurantID: "8", wantErr: true},
+		{name: "invalid restaurant", key: writeKey, method: http.MethodGet, pattern: "/api/v1/restaurants/{restaurant_id}/orders", restaurantID: "seven", wantErr: true},
+		{name: "API keys", key: writeKey, method: http.MethodGet, pattern: "/api/v1/restaurants/{restaurant_id}/api-keys", restaurantID: "7", wantErr: true},
+		{name: "API key creation", key: writeKey, method: http.MethodPost, pattern: "/api/v1/restaurants/{restaurant_id}/api-keys/create", restaurantID: "7", wantErr: true},
+		{name: "restaurant deletion", key: writeKey, method: http.MethodDelete, pattern: "/api/v1/restaurants/{restaurant_id}/delete", restaurantID: "7", wantErr: true},
+		{name: "restaurant export", key: writeKey, method: http.MethodGet, pattern: "/api/v1/restaurants/{restaurant_id}/export", restaurantID: "7", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rctx := chi.NewRouteContext()
+			rctx.RoutePatterns = []string{tt.pattern}
+			rctx.URLParams.Add("restaurant_id", tt.restaurantID)
+
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			err := apiKeyAllows(tt.key, r)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("apiKeyAllows() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsAPIKey(t *testing.T) {
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{token: apiKeyPrefix + "0123456789abcdef", want: true},
+		{token: "eyJhbGciOiJIUzI1NiJ9.e30.signature", want: false},
+		{token: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isAPIKey(tt.token); got != tt.want {
+			t.Errorf("isAPIKey(%q) = %v, want %v", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestAPIKeyActive(t *testing.T) {
+	now := time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Minute), now.Add(time.Minute)
+
+	tests := []struct {
+		name string
+		key  models.APIKey
+		want bool
+	}{
+		{name: "no expiry", key: models.APIKey{}, want: true},
+		{name: "not expired", key: models.APIKey{ExpiresAt: &after}, want: true},
+		{name: "expired", key: models.APIKey{ExpiresAt: &before}, want: false},
+		{name: "expires now", key: models.APIKey{ExpiresAt: &now}, want: false},
+		{name: "revoked", key: models.APIKey{RevokedAt: &before, ExpiresAt: &after}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.Active(now); got != tt.want {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/archive"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// ExportRestaurant exports the restaurant with its menus, menu items and their images as a zip archive.
+func (m *Repository) ExportRestaurant(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	if err := archive.Export(buf, m.App.DB, restaurantID, m.archiveOptions()); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="restaurant-%d.zip"`, restaurantID))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// ImportRestaurant recreates a restaurant from an uploaded export archive under the current user.
+// Admins can import it under another user with the `ownerId` form field.
+func (m *Repository) ImportRestaurant(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(64 << 20); err != nil { // 64 MB limit
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error parsing form"), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	if !m.requireVerifiedEmail(w, r, userID) {
+		return
+	}
+
+	ownerID := userID
+	if value := r.FormValue("ownerId"); value != "" {
+		if !m.isAdmin(userID) {
+			_ = m.errorJSON(w, r, errors.New("only admins can import restaurants for other users"), http.StatusForbidden)
+			return
+		}
+
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			_ = m.errorJSON(w, r, apierror.InvalidParam("owner_id"), http.StatusBadRequest)
+			return
+		}
+
+		var owner models.User
+		if err := m.App.DB.First(&owner, "id = ?", id).Error; err != nil {
+			_ = m.errorJSON(w, r, errors.New("owner not found"), http.StatusNotFound)
+			return
+		}
+		ownerID = owner.ID
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("error retrieving the file"), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	restaurant, err := archive.Import(m.App.DB, file, header.Size, ownerID, m.archiveOptions())
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  restaurant,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// archiveOptions returns the storage options of restaurant archives.
+func (m *Repository) archiveOptions() archive.Options {
+	return archive.Options{
+		ImagesDir:      "storage/images",
+		ImagesURL:      m.appURL("/api/v1/storage/images"),
+		DefaultPicture: m.appURL("/api/v1/storage/images/menuitem-default.jpeg"),
+	}
+}
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// cartItemBody is the cart item request body structure.
+type cartItemBody struct {
+	MenuItemID uint `json:"menuItemId"`
+	Quantity   uint `json:"quantity"`
+}
+
+// checkoutBody is the checkout request body structure.
+type checkoutBody struct {
+	Comment string `json:"comment"`
+}
+
+// GetCart returns the cart of the current user in the restaurant.
+func (m *Repository) GetCart(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	m.writeCart(w, r, userID, uint(restaurantID), http.StatusOK)
+}
+
+// CreateCartItem adds a menu item of the restaurant to the cart of the current user.
+// Adding an item that is already in the cart increases its quantity.
+func (m *Repository) CreateCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	var body cartItemBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding cart item data"), http.StatusBadRequest)
+		return
+	}
+
+	if body.Quantity == 0 {
+		body.Quantity = 1
+	}
+
+	var menuItem models.MenuItem
+	if err := m.App.DB.First(&menuItem, "id = ? AND menu_id IN (SELECT id FROM menus WHERE restaurant_id = ?)", body.MenuItemID, restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("menu item not found in this restaurant"), http.StatusNotFound)
+		return
+	}
+
+	cart := models.Cart{
+		UserID:       userID,
+		RestaurantID: uint(restaurantID),
+	}
+	if err := m.App.DB.Where(&cart).FirstOrCreate(&cart).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	var cartItem models.CartItem
+	err = m.App.DB.First(&cartItem, "cart_id = ? AND menu_item_id = ?", cart.ID, menuItem.ID).Error
+	if err == nil {
+		cartItem.Quantity += body.Quantity
+		err = m.App.DB.Save(&cartItem).Error
+	} else {
+		cartItem = models.CartItem{
+			CartID:     cart.ID,
+			MenuItemID: menuItem.ID,
+			Quantity:   body.Quantity,
+		}
+		err = m.App.DB.Create(&cartItem).Error
+	}
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	m.writeCart(w, r, userID, cart.RestaurantID, http.StatusCreated)
+}
+
+// UpdateCartItem changes the quantity of a cart item. A zero quantity removes the item.
+func (m *Repository) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, cartItem, ok := m.userCartItem(w, r)
+	if !ok {
+		return
+	}
+
+	var body cartItemBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding cart item data"), http.StatusBadRequest)
+		return
+	}
+
+	if body.Quantity == 0 {
+		err = m.App.DB.Delete(&cartItem).Error
+	} else {
+		cartItem.Quantity = body.Quantity
+		err = m.App.DB.Save(&cartItem).Error
+	}
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	restaurantID, _ := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	m.writeCart(w, r, userID, uint(restaurantID), http.StatusOK)
+}
+
+// DeleteCartItem removes an item from the cart.
+func (m *Repository) DeleteCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, cartItem, ok := m.userCartItem(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.App.DB.Delete(&cartItem).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	restaurantID, _ := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	m.writeCart(w, r, userID, uint(restaurantID), http.StatusOK)
+}
+
+// DeleteCart empties the cart of the current user in the restaurant.
+func (m *Repository) DeleteCart(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
+		return
+	}
+
+	err = m.App.DB.Where("user_id = ? AND restaurant_id = ?", userID, restaurantID).Delete(&models.Cart{}).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "cart emptied successfully",
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// Checkout places an order from the cart of the current user in the restaurant.
+// Item titles and prices, with the promotions active at checkout, are copied into the order,
+// and the cart is emptied.
+func (m *Repository) Checkout(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
+		return
+	}
+
+	var body checkoutBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil && !errors.Is(err, io.EOF) {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding checkout data"), http.StatusBadRequest)
+		return
+	}
+
+	trackingToken, err := randomToken(24)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	order := models.Order{
+		RestaurantID:  uint(restaurantID),
+		UserID:        userID,
+		TrackingToken: trackingToken,
+		Status:        models.OrderStatusPlaced,
+		Comment:       body.Comment,
+	}
+
+	errEmptyCart := errors.New("cart is empty")
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		var cart models.Cart
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&cart, "user_id = ? AND restaurant_id = ?", userID, restaurantID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errEmptyCart
+		}
+		if err != nil {
+			return err
+		}
+
+		var cartItems []models.CartItem
+		if err := tx.Preload("MenuItem").Where("cart_id = ?", cart.ID).Order("id").Find(&cartItems).Error; err != nil {
+			return err
+		}
+
+		if len(cartItems) == 0 {
+			return errEmptyCart
+		}
+
+		menuItems := make([]models.MenuItem, len(cartItems))
+		for i, cartItem := range cartItems {
+			menuItems[i] = cartItem.MenuItem
+		}
+
+		if err := m.priceMenuItems(cart.RestaurantID, menuItems); err != nil {
+			return err
+		}
+
+		for i, cartItem := range cartItems {
+			menuItemID := cartItem.MenuItemID
+			price := *menuItems[i].EffectivePriceUAH
+			order.Items = append(order.Items, models.OrderItem{
+				MenuItemID: &menuItemID,
+				Title:      menuItems[i].Title,
+				PriceUAH:   price,
+				Quantity:   cartItem.Quantity,
+			})
+			order.TotalUAH += price * cartItem.Quantity
+		}
+
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&cart).Error
+	})
+	if errors.Is(err, errEmptyCart) {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  order,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// findCart returns the cart of the user in the restaurant with its items priced as at checkout.
+// A user without a cart gets an empty one that is not persisted.
+func (m *Repository) findCart(db *gorm.DB, userID, restaurantID uint) (models.Cart, error) {
+	var cart models.Cart
+
+	err := db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Items.MenuItem").First(&cart, "user_id = ? AND restaurant_id = ?", userID, restaurantID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Cart{UserID: userID, RestaurantID: restaurantID, Items: []models.CartItem{}}, nil
+	}
+	if err != nil {
+		return cart, err
+	}
+
+	menuItems := make([]*models.MenuItem, len(cart.Items))
+	for i := range cart.Items {
+		menuItems[i] = &cart.Items[i].MenuItem
+	}
+
+	return cart, m.priceMenuItemRefs(menuItems)
+}
+
+// writeCart writes the current state of the cart of the user in the restaurant, translated into the languages of the request.
+func (m *Repository) writeCart(w http.ResponseWriter, r *http.Request, userID, restaurantID uint, status int) {
+	cart, err := m.findCart(m.App.DB, userID, restaurantID)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	menuItems := make([]*models.MenuItem, len(cart.Items))
+	for i := range cart.Items {
+		menuItems[i] = &cart.Items[i].MenuItem
+	}
+	m.translateMenuItemRefs(r, menuItems)
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  cart,
+	}
+	_ = m.writeJSON(w, status, payload)
+}
+
+// userCartItem loads the cart item from the URL that belongs to the current user's cart in the restaurant.
+// It writes the error response and returns false if the item cannot be used.
+func (m *Repository) userCartItem(w http.ResponseWriter, r *http.Request) (uint, models.CartItem, bool) {
+	var cartItem models.CartItem
+
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return 0, cartItem, false
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
+		return 0, cartItem, false
+	}
+
+	cartItemID, err := strconv.Atoi(chi.URLParam(r, "cart_item_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("cart_item_id"), http.StatusBadRequest)
+		return 0, cartItem, false
+	}
+
+	err = m.App.DB.First(&cartItem, "id = ? AND cart_id IN (SELECT id FROM carts WHERE user_id = ? AND restaurant_id = ?)",
+		cartItemID, userID, restaurantID).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("cart item not found"), http.StatusNotFound)
+		return 0, cartItem, false
+	}
+
+	return userID, cartItem, true
+}
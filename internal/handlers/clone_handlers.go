@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/pricehistory"
+	"github.com/vladyslavpavlenko/peparesu/internal/storage"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cloneRestaurantBody is the clone restaurant request body structure.
+type cloneRestaurantBody struct {
+	Title      string `json:"title"`
+	SkipPrices bool   `json:"skipPrices"`
+	SkipLikes  bool   `json:"skipLikes"`
+}
+
+// cloneMenuBody is the clone menu request body structure.
+type cloneMenuBody struct {
+	TargetRestaurantID uint   `json:"targetRestaurantId"`
+	Title              string `json:"title"`
+	SkipPrices         bool   `json:"skipPrices"`
+	SkipLikes          bool   `json:"skipLikes"`
+}
+
+// cloneOptions controls what is copied from the menu items.
+type cloneOptions struct {
+	SkipPrices bool
+	SkipLikes  bool
+}
+
+// CloneRestaurant deep-copies a restaurant with its menus, menu items and their images
+// into a new restaurant owned by the current user.
+func (m *Repository) CloneRestaurant(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	if !m.requireVerifiedEmail(w, r, userID) {
+		return
+	}
+
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	var body cloneRestaurantBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding clone data"), http.StatusBadRequest)
+		return
+	}
+
+	var source models.Restaurant
+	err = m.App.DB.Preload("Menus", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Menus.MenuItems", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&source, "id = ?", restaurantID).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
+		return
+	}
+
+	title := strings.TrimSpace(body.Title)
+	if title == "" {
+		title = source.Title
+	}
+
+	clone := models.Restaurant{
+		OwnerID:         userID,
+		Title:           title,
+		Type:            source.Type,
+		Description:     source.Description,
+		Address:         source.Address,
+		Phone:           source.Phone,
+		DefaultLanguage: source.DefaultLanguage,
+	}
+	opts := cloneOptions{SkipPrices: body.SkipPrices, SkipLikes: body.SkipLikes}
+
+	var copied []string
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&clone).Error; err != nil {
+			return err
+		}
+
+		for _, menu := range source.Menus {
+			if _, err := m.cloneMenu(tx, menu, clone.ID, menu.Title, opts, userID, &copied); err != nil {
+				return err
+			}
+		}
+
+		var translations []models.Translation
+		err := tx.Where("restaurant_id = ? AND menu_id IS NULL AND menu_item_id IS NULL", source.ID).Find(&translations).Error
+		if err != nil {
+			return err
+		}
+
+		return createTranslations(tx, cloneTranslations(translations, clone.ID, nil, nil))
+	})
+	if err != nil {
+		removeFiles(copied)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  clone,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// CloneMenu deep-copies a menu with its menu items and their images into another restaurant
+// of the current user, or into the same restaurant under a new title.
+func (m *Repository) CloneMenu(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	menuID, err := strconv.Atoi(chi.URLParam(r, "menu_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_id"), http.StatusBadRequest)
+		return
+	}
+
+	var body cloneMenuBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding clone data"), http.StatusBadRequest)
+		return
+	}
+
+	var source models.Menu
+	err = m.App.DB.Preload("MenuItems", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).First(&source, "id = ? AND restaurant_id = ?", menuID, restaurantID).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("menu not found"), http.StatusNotFound)
+		return
+	}
+
+	targetID := body.TargetRestaurantID
+	if targetID == 0 {
+		targetID = restaurantID
+	}
+
+	if !m.canManageRestaurant(userID, int(targetID)) {
+		_ = m.errorJSON(w, r, errors.New("target restaurant not found or not owned by the user"), http.StatusNotFound)
+		return
+	}
+
+	title := strings.TrimSpace(body.Title)
+	if title == "" {
+		title = source.Title
+	}
+
+	var existingMenu models.Menu
+	if err := m.App.DB.Where("title = ? AND restaurant_id = ?", title, targetID).First(&existingMenu).Error; err == nil {
+		_ = m.errorJSON(w, r, errors.New("a menu with this title already exists for this restaurant"), http.StatusConflict)
+		return
+	}
+
+	opts := cloneOptions{SkipPrices: body.SkipPrices, SkipLikes: body.SkipLikes}
+
+	var clone models.Menu
+	var copied []string
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		clone, err = m.cloneMenu(tx, source, targetID, title, opts, userID, &copied)
+		return err
+	})
+	if err != nil {
+		removeFiles(copied)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  clone,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// cloneMenu copies the menu and its menu items with their translations into the restaurant within the transaction.
+// Image files of the menu items are copied under the new item IDs and their paths are added to copied.
+func (m *Repository) cloneMenu(tx *gorm.DB, source models.Menu, restaurantID uint, title string, opts cloneOptions, userID uint, copied *[]string) (models.Menu, error) {
+	menu := models.Menu{RestaurantID: restaurantID, Title: title}
+	if err := tx.Create(&menu).Error; err != nil {
+		return menu, err
+	}
+
+	sourceItemIDs := make([]uint, 0, len(source.MenuItems))
+	menuItemIDs := make(map[uint]uint, len(source.MenuItems))
+	for _, sourceItem := range source.MenuItems {
+		menuItem := cloneMenuItem(sourceItem, menu.ID, opts)
+
+		// A picture missing from the storage is skipped, and the copy gets the default picture
+		name, copyPicture := storage.ImageName(sourceItem.Picture, imagesPath)
+		copyPicture = copyPicture && name != defaultMenuItemPicture
+		if copyPicture {
+			if _, err := os.Stat(filepath.Join(imagesDir, name)); err != nil {
+				copyPicture = false
+				menuItem.Picture = m.appURL(imagesPath + defaultMenuItemPicture)
+			}
+		}
+
+		if err := tx.Create(&menuItem).Error; err != nil {
+			return menu, err
+		}
+
+		if copyPicture {
+			newName := fmt.Sprintf("menuitem-%d%s", menuItem.ID, filepath.Ext(name))
+			target := filepath.Join(imagesDir, newName)
+
+			if err := copyFile(filepath.Join(imagesDir, name), target); err != nil {
+				return menu, err
+			}
+			*copied = append(*copied, target)
+
+			menuItem.Picture = m.appURL(imagesPath + newName)
+			if err := tx.Model(&menuItem).Update("picture", menuItem.Picture).Error; err != nil {
+				return menu, err
+			}
+		}
+
+		if err := pricehistory.Record(tx, menuItem, restaurantID, 0, userID); err != nil {
+			return menu, err
+		}
+
+		sourceItemIDs = append(sourceItemIDs, sourceItem.ID)
+		menuItemIDs[sourceItem.ID] = menuItem.ID
+		menu.MenuItems = append(menu.MenuItems, menuItem)
+	}
+
+	var translations []models.Translation
+	query := tx.Where("menu_id = ?", source.ID)
+	if len(sourceItemIDs) > 0 {
+		query = query.Or("menu_item_id IN ?", sourceItemIDs)
+	}
+	if err := query.Find(&translations).Error; err != nil {
+		return menu, err
+	}
+
+	err := createTranslations(tx, cloneTranslations(translations, restaurantID, map[uint]uint{source.ID: menu.ID}, menuItemIDs))
+
+	return menu, err
+}
+
+// cloneTranslations returns unsaved copies of the translations for the restaurant, with the menu and
+// menu item IDs mapped from the source IDs to the IDs of their copies. Translations of menus or menu
+// items that were not copied are left out.
+func cloneTranslations(translations []models.Translation, restaurantID uint, menuIDs, menuItemIDs map[uint]uint) []models.Translation {
+	clones := make([]models.Translation, 0, len(translations))
+
+	for _, translation := range translations {
+		clone := models.Translation{
+			RestaurantID: restaurantID,
+			Language:     translation.Language,
+			Title:        translation.Title,
+			Description:  translation.Description,
+		}
+
+		if translation.MenuID != nil {
+			menuID, ok := menuIDs[*translation.MenuID]
+			if !ok {
+				continue
+			}
+			clone.MenuID = &menuID
+		}
+
+		if translation.MenuItemID != nil {
+			menuItemID, ok := menuItemIDs[*translation.MenuItemID]
+			if !ok {
+				continue
+			}
+			clone.MenuItemID = &menuItemID
+		}
+
+		clones = append(clones, clone)
+	}
+
+	return clones
+}
+
+// createTranslations stores the translations, if there are any.
+func createTranslations(tx *gorm.DB, translations []models.Translation) error {
+	if len(translations) == 0 {
+		return nil
+	}
+
+	return tx.Omit("Restaurant", "Menu", "MenuItem").Create(&translations).Error
+}
+
+// cloneMenuItem returns an unsaved copy of the menu item in the menu, without the prices or likes the options skip.
+func cloneMenuItem(source models.MenuItem, menuID uint, opts cloneOptions) models.MenuItem {
+	menuItem := models.MenuItem{
+		MenuID:      menuID,
+		Picture:     source.Picture,
+		Title:       source.Title,
+		Description: source.Description,
+		LikesCount:  source.LikesCount,
+		PriceUAH:    source.PriceUAH,
+	}
+	if opts.SkipLikes {
+		menuItem.LikesCount = 0
+	}
+	if opts.SkipPrices {
+		menuItem.PriceUAH = 0
+	}
+
+	return menuItem
+}
+
+// copyFile copies the file at source to target.
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(target)
+		return err
+	}
+
+	return out.Close()
+}
+
+// removeFiles removes the files, ignoring errors. It cleans up files written by a failed transaction.
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		_ = os.Remove(path)
+	}
+}
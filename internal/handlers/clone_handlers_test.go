@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCloneMenuItem(t *testing.T) {
+	source := models.MenuItem{
+		ID:          4,
+		MenuID:      1,
+		Picture:     "https://cdn.test/borshch.jpeg",
+		Title:       "Борщ",
+		Description: "З пампушками",
+		LikesCount:  12,
+		PriceUAH:    120,
+	}
+
+	tests := []struct {
+		name      string
+		opts      cloneOptions
+		wantLikes uint
+		wantPrice uint
+	}{
+		{name: "everything", wantLikes: 12, wantPrice: 120},
+		{name: "skip likes", opts: cloneOptions{SkipLikes: true}, wantPrice: 120},
+		{name: "skip prices", opts: cloneOptions{SkipPrices: true}, wantLikes: 12},
+		{name: "skip both", opts: cloneOptions{SkipLikes: true, SkipPrices: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clone := cloneMenuItem(source, 9, tt.opts)
+
+			want := models.MenuItem{
+				MenuID:      9,
+				Picture:     source.Picture,
+				Title:       source.Title,
+				Description: source.Description,
+				LikesCount:  tt.wantLikes,
+				PriceUAH:    tt.wantPrice,
+			}
+			if !reflect.DeepEqual(clone, want) {
+				t.Errorf("cloneMenuItem = %+v, want %+v", clone, want)
+			}
+		})
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "menuitem-1.jpeg")
+	if err := os.WriteFile(source, []byte("jpeg"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, "menuitem-2.jpeg")
+	if err := copyFile(source, target); err != nil {
+		t.Fatalf("copyFile: %v", err)
+	}
+
+	content, err := os.ReadFile(target)
+	if err != nil || string(content) != "jpeg" {
+		t.Errorf("copied file = %q, %v", content, err)
+	}
+
+	if err := copyFile(filepath.Join(dir, "missing.jpeg"), filepath.Join(dir, "menuitem-3.jpeg")); err == nil {
+		t.Error("copyFile of a missing file succeeded")
+	}
+
+	removeFiles([]string{target, filepath.Join(dir, "missing.jpeg")})
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("removeFiles left the copy: %v", err)
+	}
+}
+
+func TestCloneTranslations(t *testing.T) {
+	id := func(id uint) *uint {
+		return &id
+	}
+
+	translations := []models.Translation{
+		{ID: 1, RestaurantID: 1, Language: "en", Title: "Potato House"},
+		{ID: 2, RestaurantID: 1, MenuID: id(3), Language: "en", Title: "Lunch"},
+		{ID: 3, RestaurantID: 1, MenuItemID: id(10), Language: "en", Title: "Borscht", Description: "With garlic buns"},
+		{ID: 4, RestaurantID: 1, MenuItemID: id(11), Language: "pl", Title: "Pierogi"},
+		{ID: 5, RestaurantID: 1, MenuID: id(4), Language: "en", Title: "Dinner"},
+	}
+
+	got := cloneTranslations(translations, 2, map[uint]uint{3: 30}, map[uint]uint{10: 100, 11: 110})
+
+	want := []models.Translation{
+		{RestaurantID: 2, Language: "en", Title: "Potato House"},
+		{RestaurantID: 2, MenuID: id(30), Language: "en", Title: "Lunch"},
+		{RestaurantID: 2, MenuItemID: id(100), Language: "en", Title: "Borscht", Description: "With garlic buns"},
+		{RestaurantID: 2, MenuItemID: id(110), Language: "pl", Title: "Pierogi"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cloneTranslations = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/mailer"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// emailVerificationTTL is how long an email verification link is valid.
+	emailVerificationTTL = 48 * time.Hour
+
+	purposeVerifyEmail = "verify_email"
+)
+
+// linkClaims are the claims of the tokens of signed links sent by email. Purpose keeps a token
+// of one kind of link from being used for another, and Email voids the links sent to an old
+// address once the email of the user changes. CurrentEmail is the email of the user when the
+// link was sent, which voids the email change links once the email changes.
+type linkClaims struct {
+	Purpose      string `json:"purpose"`
+	Email        string `json:"email"`
+	CurrentEmail string `json:"currentEmail"`
+	jwt.RegisteredClaims
+}
+
+// VerifyEmail confirms the email address of a user with the token of a verification link.
+func (m *Repository) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	user, _, err := m.parseLinkToken(r.URL.Query().Get("token"), purposeVerifyEmail)
+	if err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		err = m.App.DB.Model(&user).Update("email_verified_at", time.Now()).Error
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "email verified",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ResendVerificationEmail sends a new verification link to the current user.
+func (m *Repository) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := m.App.DB.First(&user, "id = ?", userID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		_ = m.errorJSON(w, r, errors.New("email is already verified"), http.StatusConflict)
+		return
+	}
+
+	if err := m.sendVerificationEmail(user); err != nil {
+		_ = m.errorJSON(w, r, apierror.Wrap(apierror.Unavailable, err))
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "verification email sent",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// sendVerificationEmail sends the user a link that confirms the email address.
+func (m *Repository) sendVerificationEmail(user models.User) error {
+	token, err := m.signLinkToken(user, purposeVerifyEmail, user.Email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := m.appURL("/api/v1/verify-email?token=" + url.QueryEscape(token))
+
+	return m.App.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Text: fmt.Sprintf("Hi %s,\n\nconfirm your email address for Peparesu by opening this link:\n\n%s\n\n"+
+			"The link is valid for %d hours. If you did not sign up, ignore this email.\n",
+			user.FirstName, link, int(emailVerificationTTL.Hours())),
+	})
+}
+
+// requireVerifiedEmail writes an email_not_verified error unless the user has confirmed the email address.
+func (m *Repository) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID uint) bool {
+	var user models.User
+	if err := m.App.DB.First(&user, "id = ?", userID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("user not found"), http.StatusNotFound)
+		return false
+	}
+
+	if user.EmailVerifiedAt == nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.EmailNotVerified, "verify your email address first"))
+		return false
+	}
+
+	return true
+}
+
+// signLinkToken returns the token of a signed link for the user. The email is the address
+// the link is sent to.
+func (m *Repository) signLinkToken(user models.User, purpose, email string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := linkClaims{
+		Purpose:      purpose,
+		Email:        email,
+		CurrentEmail: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(m.App.Env.JWTSecret))
+}
+
+// parseLinkToken validates the token of a signed link with the purpose and returns its user and claims.
+// For links that depend on the email of the user, it must not have changed since.
+func (m *Repository) parseLinkToken(tokenString, purpose string) (models.User, linkClaims, error) {
+	var user models.User
+	var claims linkClaims
+
+	invalid := apierror.New(apierror.BadRequest, "the link is invalid or has expired")
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
+		return []byte(m.App.Env.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Purpose != purpose {
+		return user, claims, invalid
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return user, claims, invalid
+	}
+
+	if err := m.App.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return user, claims, invalid
+	}
+
+	if !linkEmailCurrent(user, purpose, claims) {
+		return user, claims, invalid
+	}
+
+	return user, claims, nil
+}
+
+// linkEmailCurrent reports whether the user still has the email the link depends on: the address
+// a verification link was sent to, or the email an email change link changes from.
+func linkEmailCurrent(user models.User, purpose string, claims linkClaims) bool {
+	switch purpose {
+	case purposeVerifyEmail:
+		return user.Email == claims.Email
+	case purposeChangeEmail:
+		return user.Email == claims.CurrentEmail
+	default:
+		return true
+	}
+}
+
+// logMailError logs an email that could not be sent where the request does not depend on it.
+func logMailError(err error, user models.User) {
+	if err != nil {
+		log.Printf("error sending email to user %d: %v", user.ID, err)
+	}
+}
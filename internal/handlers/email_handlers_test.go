@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladyslavpavlenko/peparesu/config"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"testing"
+	"time"
+)
+
+func TestSignLinkToken(t *testing.T) {
+	repo := &Repository{App: &config.AppConfig{Env: &config.EnvVariables{JWTSecret: testJWTSecret}}}
+	user := models.User{ID: 42, Email: "olena@example.com"}
+
+	token, err := repo.signLinkToken(user, purposeChangeEmail, "olena@example.org", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims linkClaims
+	_, err = jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return []byte(testJWTSecret), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Purpose != purposeChangeEmail || claims.Email != "olena@example.org" || claims.CurrentEmail != user.Email || claims.Subject != "42" {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestLinkEmailCurrent(t *testing.T) {
+	user := models.User{ID: 42, Email: "olena@example.com"}
+
+	tests := []struct {
+		name    string
+		purpose string
+		claims  linkClaims
+		want    bool
+	}{
+		{name: "verification of the current email", purpose: purposeVerifyEmail, claims: linkClaims{Email: "olena@example.com", CurrentEmail: "olena@example.com"}, want: true},
+		{name: "verification of an old email", purpose: purposeVerifyEmail, claims: linkClaims{Email: "olena@example.net", CurrentEmail: "olena@example.net"}},
+		{name: "change from the current email", purpose: purposeChangeEmail, claims: linkClaims{Email: "olena@example.org", CurrentEmail: "olena@example.com"}, want: true},
+		{name: "change from an old email", purpose: purposeChangeEmail, claims: linkClaims{Email: "olena@example.org", CurrentEmail: "olena@example.net"}},
+		{name: "change already made", purpose: purposeChangeEmail, claims: linkClaims{Email: "olena@example.com", CurrentEmail: "olena@example.net"}},
+		{name: "change without the current email", purpose: purposeChangeEmail, claims: linkClaims{Email: "olena@example.org"}},
+		{name: "two-factor login", purpose: purposeTwoFactorLogin, claims: linkClaims{Email: "olena@example.net"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := linkEmailCurrent(user, tt.purpose, tt.claims); got != tt.want {
+				t.Errorf("linkEmailCurrent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
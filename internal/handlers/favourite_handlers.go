@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// favouriteListBody is the favourite list request body structure.
+type favouriteListBody struct {
+	Title string `json:"title"`
+}
+
+// maxFavouriteListTitleLength is the length limit of the favourite list title in characters.
+const maxFavouriteListTitleLength = 255
+
+// validate checks the favourite list title.
+func (b favouriteListBody) validate() error {
+	if strings.TrimSpace(b.Title) == "" {
+		return apierror.Field("title", apierror.Required, "title cannot be empty")
+	}
+
+	if utf8.RuneCountInString(b.Title) > maxFavouriteListTitleLength {
+		return apierror.Field("title", apierror.TooLong, "title cannot be longer than 255 characters")
+	}
+
+	return nil
+}
+
+// favouriteEntryBody is the favourite list entry request body structure.
+type favouriteEntryBody struct {
+	RestaurantID *uint `json:"restaurantId"`
+	MenuItemID   *uint `json:"menuItemId"`
+}
+
+// GetFavouriteLists returns the favourite lists of the current user with their entries.
+func (m *Repository) GetFavouriteLists(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	var lists []models.FavouriteList
+	err = m.App.DB.Preload("Entries.Restaurant").Preload("Entries.MenuItem").
+		Where("user_id = ?", userID).Order("created_at").Find(&lists).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	m.translateFavouriteLists(r, lists)
+
+	if err := m.priceFavouriteLists(lists); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  lists,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetSharedFavouriteList returns a favourite list by its public share token.
+func (m *Repository) GetSharedFavouriteList(w http.ResponseWriter, r *http.Request) {
+	shareToken := chi.URLParam(r, "share_token")
+
+	var list models.FavouriteList
+	err := m.App.DB.Preload("Entries.Restaurant").Preload("Entries.MenuItem").
+		First(&list, "share_token = ?", shareToken).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("favourite list not found"), http.StatusNotFound)
+		return
+	}
+
+	lists := []models.FavouriteList{list}
+	m.translateFavouriteLists(r, lists)
+	if err := m.priceFavouriteLists(lists); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	list = lists[0]
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  list,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateFavouriteList handles the favourite list creation request.
+func (m *Repository) CreateFavouriteList(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	var body favouriteListBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding favourite list data"), http.StatusBadRequest)
+		return
+	}
+
+	if err := body.validate(); err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	var existingList models.FavouriteList
+	if err := m.App.DB.First(&existingList, "user_id = ? AND title = ?", userID, body.Title).Error; err == nil {
+		_ = m.errorJSON(w, r, errors.New("a favourite list with this title already exists"), http.StatusConflict)
+		return
+	}
+
+	list := models.FavouriteList{
+		UserID: userID,
+		Title:  body.Title,
+	}
+
+	if err := m.App.DB.Create(&list).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  list,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// UpdateFavouriteList handles the favourite list rename request.
+func (m *Repository) UpdateFavouriteList(w http.ResponseWriter, r *http.Request) {
+	list, ok := m.userFavouriteList(w, r)
+	if !ok {
+		return
+	}
+
+	var body favouriteListBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding favourite list data"), http.StatusBadRequest)
+		return
+	}
+
+	if err := body.validate(); err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	var existingList models.FavouriteList
+	err = m.App.DB.First(&existingList, "user_id = ? AND title = ? AND id <> ?", list.UserID, body.Title, list.ID).Error
+	if err == nil {
+		_ = m.errorJSON(w, r, errors.New("a favourite list with this title already exists"), http.StatusConflict)
+		return
+	}
+
+	list.Title = body.Title
+
+	if err := m.App.DB.Save(&list).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  list,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteFavouriteList handles the favourite list deletion request.
+func (m *Repository) DeleteFavouriteList(w http.ResponseWriter, r *http.Request) {
+	list, ok := m.userFavouriteList(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.App.DB.Delete(&list).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "favourite list deleted successfully",
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ShareFavouriteList generates a public share link for the favourite list.
+func (m *Repository) ShareFavouriteList(w http.ResponseWriter, r *http.Request) {
+	list, ok := m.userFavouriteList(w, r)
+	if !ok {
+		return
+	}
+
+	if list.ShareToken == nil {
+		token, err := randomToken(24)
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		list.ShareToken = &token
+
+		if err := m.App.DB.Save(&list).Error; err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]string{
+			"link": m.appURL("/api/v1/favourites/shared/" + *list.ShareToken),
+		},
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// UnshareFavouriteList revokes the public share link of the favourite list.
+func (m *Repository) UnshareFavouriteList(w http.ResponseWriter, r *http.Request) {
+	list, ok := m.userFavouriteList(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.App.DB.Model(&list).Update("share_token", nil).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "favourite list is no longer shared",
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateFavouriteEntry adds a restaurant or a menu item to the favourite list.
+func (m *Repository) CreateFavouriteEntry(w http.ResponseWriter, r *http.Request) {
+	list, ok := m.userFavouriteList(w, r)
+	if !ok {
+		return
+	}
+
+	var body favouriteEntryBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding favourite entry data"), http.StatusBadRequest)
+		return
+	}
+
+	if (body.RestaurantID == nil) == (body.MenuItemID == nil) {
+		_ = m.errorJSON(w, r, errors.New("exactly one of restaurantId and menuItemId must be provided"), http.StatusBadRequest)
+		return
+	}
+
+	entry := models.FavouriteListEntry{
+		FavouriteListID: list.ID,
+		RestaurantID:    body.RestaurantID,
+		MenuItemID:      body.MenuItemID,
+	}
+
+	query := m.App.DB.Where("favourite_list_id = ?", list.ID)
+	if body.RestaurantID != nil {
+		var restaurant models.Restaurant
+		if err := m.App.DB.First(&restaurant, "id = ?", *body.RestaurantID).Error; err != nil {
+			_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
+			return
+		}
+
+		query = query.Where("restaurant_id = ?", *body.RestaurantID)
+	} else {
+		var menuItem models.MenuItem
+		if err := m.App.DB.First(&menuItem, "id = ?", *body.MenuItemID).Error; err != nil {
+			_ = m.errorJSON(w, r, errors.New("menu item not found"), http.StatusNotFound)
+			return
+		}
+
+		query = query.Where("menu_item_id = ?", *body.MenuItemID)
+	}
+
+	var existingEntry models.FavouriteListEntry
+	if err := query.First(&existingEntry).Error; err == nil {
+		_ = m.errorJSON(w, r, errors.New("already in the favourite list"), http.StatusConflict)
+		return
+	}
+
+	if err := m.App.DB.Create(&entry).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  entry,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// DeleteFavouriteEntry removes an entry from the favourite list.
+func (m *Repository) DeleteFavouriteEntry(w http.ResponseWriter, r *http.Request) {
+	list, ok := m.userFavouriteList(w, r)
+	if !ok {
+		return
+	}
+
+	entryID, err := strconv.Atoi(chi.URLParam(r, "entry_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("entry_id"), http.StatusBadRequest)
+		return
+	}
+
+	result := m.App.DB.Where("id = ? AND favourite_list_id = ?", entryID, list.ID).Delete(&models.FavouriteListEntry{})
+	if result.Error != nil {
+		_ = m.errorJSON(w, r, result.Error, http.StatusInternalServerError)
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		_ = m.errorJSON(w, r, errors.New("favourite entry not found"), http.StatusNotFound)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "favourite entry deleted successfully",
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// userFavouriteList loads the favourite list from the URL owned by the current user.
+// It writes the error response and returns false if the list cannot be used.
+func (m *Repository) userFavouriteList(w http.ResponseWriter, r *http.Request) (models.FavouriteList, bool) {
+	var list models.FavouriteList
+
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return list, false
+	}
+
+	listID, err := strconv.Atoi(chi.URLParam(r, "list_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("favourite_list_id"), http.StatusBadRequest)
+		return list, false
+	}
+
+	if err := m.App.DB.First(&list, "id = ? AND user_id = ?", listID, userID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("favourite list not found"), http.StatusNotFound)
+		return list, false
+	}
+
+	return list, true
+}
+
+// markFavouriteRestaurants sets the IsFavourite flag on restaurants bookmarked by the
+// user making the request. Anonymous requests are left untouched.
+func (m *Repository) markFavouriteRestaurants(r *http.Request, restaurants []models.Restaurant) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil || len(restaurants) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(restaurants))
+	for i, restaurant := range restaurants {
+		ids[i] = restaurant.ID
+	}
+
+	favourites := m.favouriteIDs(userID, "restaurant_id", ids)
+	for i := range restaurants {
+		restaurants[i].IsFavourite = favourites[restaurants[i].ID]
+	}
+}
+
+// priceFavouriteLists sets the effective prices of the menu items in the lists.
+func (m *Repository) priceFavouriteLists(lists []models.FavouriteList) error {
+	var menuItems []*models.MenuItem
+	for i := range lists {
+		for _, entry := range lists[i].Entries {
+			if entry.MenuItem != nil {
+				menuItems = append(menuItems, entry.MenuItem)
+			}
+		}
+	}
+
+	return m.priceMenuItemRefs(menuItems)
+}
+
+// markFavouriteMenuItems sets the IsFavourite flag on menu items bookmarked by the
+// user making the request. Anonymous requests are left untouched.
+func (m *Repository) markFavouriteMenuItems(r *http.Request, menuItems []models.MenuItem) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil || len(menuItems) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(menuItems))
+	for i, menuItem := range menuItems {
+		ids[i] = menuItem.ID
+	}
+
+	favourites := m.favouriteIDs(userID, "menu_item_id", ids)
+	for i := range menuItems {
+		menuItems[i].IsFavourite = favourites[menuItems[i].ID]
+	}
+}
+
+// favouriteIDs returns the set of IDs in the given column that appear in any favourite list of the user.
+func (m *Repository) favouriteIDs(userID uint, column string, ids []uint) map[uint]bool {
+	var found []uint
+	m.App.DB.Model(&models.FavouriteListEntry{}).
+		Joins("JOIN favourite_lists ON favourite_lists.id = favourite_list_entries.favourite_list_id").
+		Where("favourite_lists.user_id = ? AND favourite_list_entries."+column+" IN ?", userID, ids).
+		Distinct().Pluck("favourite_list_entries."+column, &found)
+
+	favourites := make(map[uint]bool, len(found))
+	for _, id := range found {
+		favourites[id] = true
+	}
+
+	return favourites
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"strings"
+	"testing"
+)
+
+func TestFavouriteListBodyValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		title      string
+		wantReason apierror.Reason
+	}{
+		{name: "title", title: "Date night"},
+		{name: "longest Cyrillic title", title: strings.Repeat("ж", maxFavouriteListTitleLength)},
+		{name: "empty title", title: "", wantReason: apierror.Required},
+		{name: "blank title", title: "  ", wantReason: apierror.Required},
+		{name: "too long title", title: strings.Repeat("a", maxFavouriteListTitleLength+1), wantReason: apierror.TooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := favouriteListBody{Title: tt.title}.validate()
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("validate = %v, want nil", err)
+				}
+				return
+			}
+
+			var apiErr *apierror.Error
+			if !errors.As(err, &apiErr) || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "title" || apiErr.Fields[0].Reason != tt.wantReason {
+				t.Fatalf("validate = %v, want a %s error of the title", err, tt.wantReason)
+			}
+		})
+	}
+}
@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
 	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
 	"io"
+	"log"
 	"net/http"
 	"net/mail"
+	"strings"
 )
 
 func (m *Repository) readJSON(w http.ResponseWriter, r *http.Request, data any) error {
@@ -52,53 +56,103 @@ func (m *Repository) writeJSON(w http.ResponseWriter, status int, data any, head
 	return nil
 }
 
-func (m *Repository) errorJSON(w http.ResponseWriter, err error, status ...int) error {
+// errorJSON writes the error as an RFC 7807 problem in the language of the request.
+// Errors outside the apierror catalogue are classified by the status, which defaults to 400.
+func (m *Repository) errorJSON(w http.ResponseWriter, r *http.Request, err error, status ...int) error {
 	statusCode := http.StatusBadRequest
 
 	if len(status) > 0 {
 		statusCode = status[0]
 	}
 
-	var payload jsonResponse
-	payload.Error = true
-	payload.Message = err.Error()
+	var apiErr *apierror.Error
+	switch {
+	case errors.As(err, &apiErr):
+	case errors.Is(err, errInvalidTransition):
+		apiErr = apierror.New(apierror.InvalidTransition, err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apiErr = apierror.New(apierror.NotFound, err.Error())
+	default:
+		apiErr = apierror.From(err, statusCode)
+	}
+
+	if apiErr.Status() >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	lang := apierror.Language(requestLanguages(r))
+	problem := apiErr.Problem(lang, r.URL.Path)
+
+	out, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("Content-Language", lang)
+	w.WriteHeader(problem.Status)
+	_, err = w.Write(out)
 
-	return m.writeJSON(w, statusCode, payload)
+	return err
 }
 
 // validateEmail validates the email address.
 func validateEmail(email string) bool {
-	_, err := mail.ParseAddress(email)
-	return err == nil
+	// A display name like "Jane <jane@example.com>" parses too, but is not a plain address
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
 }
 
-// getUserFromToken extracts the user ID from the JWT token in the request cookie.
-func (m *Repository) getUserFromToken(r *http.Request) (uint, error) {
-	cookie, err := r.Cookie("user_jwt")
-	if err != nil {
-		return 0, errors.New("no token found")
+// errEmailAmbiguous is returned by userByEmail for an address that several accounts have. It can only be
+// the case for accounts whose emails differed by case before the emails were stored lowercased.
+var errEmailAmbiguous = apierror.New(apierror.Conflict, "several accounts have this email address")
+
+// normalizeEmail returns the email address the way it is stored: trimmed and lowercased, so that
+// the emails of two accounts cannot differ only by case.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// userByEmail returns the user with the email address, whatever its case. It returns
+// gorm.ErrRecordNotFound if there is none and errEmailAmbiguous if there are several.
+func userByEmail(db *gorm.DB, email string) (models.User, error) {
+	var users []models.User
+	if err := db.Where("LOWER(email) = ?", normalizeEmail(email)).Limit(2).Find(&users).Error; err != nil {
+		return models.User{}, err
+	}
+
+	switch len(users) {
+	case 0:
+		return models.User{}, gorm.ErrRecordNotFound
+	case 1:
+		return users[0], nil
+	default:
+		return models.User{}, errEmailAmbiguous
 	}
+}
 
-	token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// getUserFromToken extracts the user ID from the JWT token in the Authorization header or the request cookie.
+// It fails if the session of the token has been revoked. For an API key, it is the owner of the key's restaurant.
+func (m *Repository) getUserFromToken(r *http.Request) (uint, error) {
+	if token, ok := bearerToken(r); ok && isAPIKey(token) {
+		key, err := m.authenticateAPIKey(r)
+		if err != nil {
+			return 0, err
 		}
-		return []byte(m.App.Env.JWTSecret), nil
-	})
 
-	if err != nil {
-		return 0, err
+		if err := apiKeyAllows(key, r); err != nil {
+			return 0, err
+		}
+
+		return key.Restaurant.OwnerID, nil
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userId, ok := claims["sub"].(float64)
-		if !ok {
-			return 0, errors.New("invalid token claims")
-		}
-		return uint(userId), nil
+	session, err := m.authenticate(r)
+	if err != nil {
+		return 0, err
 	}
 
-	return 0, errors.New("invalid token")
+	return session.UserID, nil
 }
 
 // isAdmin checks if the given user ID corresponds to an admin user.
@@ -109,3 +163,29 @@ func (m *Repository) isAdmin(userID uint) bool {
 	}
 	return user.UserTypeID == 2
 }
+
+// randomToken generates a URL-safe random token of n random bytes.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// appURL returns the absolute URL of the given application path.
+func (m *Repository) appURL(path string) string {
+	return strings.TrimSuffix(m.App.Env.AppURL, "/") + path
+}
+
+// canManageRestaurant checks if the user is an admin or the owner of the restaurant.
+func (m *Repository) canManageRestaurant(userID uint, restaurantID int) bool {
+	if m.isAdmin(userID) {
+		return true
+	}
+
+	var restaurant models.Restaurant
+	err := m.App.DB.First(&restaurant, "id = ? AND owner_id = ?", restaurantID, userID).Error
+	return err == nil
+}
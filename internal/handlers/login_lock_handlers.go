@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// accountLockThreshold is how many consecutive failed logins with an email address lock it.
+	accountLockThreshold = 5
+	// ipLockThreshold is how many consecutive failed logins from an IP address lock it. It is higher
+	// than accountLockThreshold as many users can share an address.
+	ipLockThreshold = 20
+	// resetEmailLockThreshold is how many password reset requests for an email address lock it, so that
+	// its inbox cannot be flooded with reset links.
+	resetEmailLockThreshold = 3
+	// resetIPLockThreshold is how many password reset requests from an IP address lock it.
+	resetIPLockThreshold = 10
+	// loginLockBase is how long the first lock lasts. Every further failure doubles it up to loginLockMax.
+	loginLockBase = time.Minute
+	loginLockMax  = time.Hour
+	// loginFailureWindow is how long failures are remembered; a failure after a longer pause counts from one.
+	loginFailureWindow = 24 * time.Hour
+)
+
+// dummyPasswordHash is compared with the password when there is no user with the email, so that
+// the response does not take less time for unknown addresses.
+const dummyPasswordHash = "$2a$10$LZn/PnDnEtAqChgm30Hx2uHK24dmmfDjnFuSPvNRnLdOCnLDdajR6"
+
+// loginLockKey identifies the failed login counter of an account or an IP address.
+type loginLockKey struct {
+	Kind models.LoginLockKind
+	Key  string
+}
+
+// GetLoginLocks lets an admin view the failed login and password reset counters. With locked=true only
+// the accounts and IP addresses that are locked now are returned.
+func (m *Repository) GetLoginLocks(w http.ResponseWriter, r *http.Request) {
+	query := m.App.DB.Model(&models.LoginLock{})
+
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		switch models.LoginLockKind(kind) {
+		case models.LoginLockAccount, models.LoginLockIP, models.LoginLockResetEmail, models.LoginLockResetIP:
+		default:
+			_ = m.errorJSON(w, r, apierror.InvalidParam("kind"), http.StatusBadRequest)
+			return
+		}
+
+		query = query.Where("kind = ?", kind)
+	}
+
+	if value := r.URL.Query().Get("locked"); value != "" {
+		locked, err := strconv.ParseBool(value)
+		if err != nil {
+			_ = m.errorJSON(w, r, apierror.InvalidParam("locked"), http.StatusBadRequest)
+			return
+		}
+
+		if locked {
+			query = query.Where("locked_until > ?", time.Now())
+		} else {
+			query = query.Where("locked_until IS NULL OR locked_until <= ?", time.Now())
+		}
+	}
+
+	var locks []models.LoginLock
+	if err := query.Order("last_failure_at DESC").Find(&locks).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  locks,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ClearLoginLock lets an admin unlock an account or an IP address and reset its failed login counter.
+func (m *Repository) ClearLoginLock(w http.ResponseWriter, r *http.Request) {
+	lockID, err := strconv.Atoi(chi.URLParam(r, "lock_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("lock_id"), http.StatusBadRequest)
+		return
+	}
+
+	result := m.App.DB.Delete(&models.LoginLock{}, lockID)
+	if result.Error != nil {
+		_ = m.errorJSON(w, r, result.Error, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		_ = m.errorJSON(w, r, errors.New("login lock not found"), http.StatusNotFound)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "login lock cleared",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// loginLockKeys returns the counters of a login with the email from the client of the request.
+func loginLockKeys(r *http.Request, email string) []loginLockKey {
+	return []loginLockKey{
+		{Kind: models.LoginLockAccount, Key: normalizeEmail(email)},
+		{Kind: models.LoginLockIP, Key: clientIP(r)},
+	}
+}
+
+// passwordResetLockKeys returns the counters of a password reset request for the email from the client
+// of the request.
+func passwordResetLockKeys(r *http.Request, email string) []loginLockKey {
+	return []loginLockKey{
+		{Kind: models.LoginLockResetEmail, Key: normalizeEmail(email)},
+		{Kind: models.LoginLockResetIP, Key: clientIP(r)},
+	}
+}
+
+// loginLockedUntil returns until when any of the counters is locked, or the zero time if none is.
+func (m *Repository) loginLockedUntil(keys []loginLockKey) (time.Time, error) {
+	var until time.Time
+
+	for _, key := range keys {
+		var lock models.LoginLock
+		err := m.App.DB.First(&lock, "kind = ? AND key = ?", key.Kind, key.Key).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if lock.Locked(time.Now()) && lock.LockedUntil.After(until) {
+			until = *lock.LockedUntil
+		}
+	}
+
+	return until, nil
+}
+
+// recordLoginFailure counts a failed login on the counters and locks the ones past their threshold.
+func (m *Repository) recordLoginFailure(keys []loginLockKey) error {
+	now := time.Now()
+
+	return m.App.DB.Transaction(func(tx *gorm.DB) error {
+		for _, key := range keys {
+			// Make sure the row exists, so that it can be locked for the update
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.LoginLock{Kind: key.Kind, Key: key.Key, LastFailureAt: now}).Error
+			if err != nil {
+				return err
+			}
+
+			var lock models.LoginLock
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				First(&lock, "kind = ? AND key = ?", key.Kind, key.Key).Error
+			if err != nil {
+				return err
+			}
+
+			if now.Sub(lock.LastFailureAt) > loginFailureWindow {
+				lock.Failures = 0
+			}
+			lock.Failures++
+			lock.LastFailureAt = now
+			lock.LockedUntil = nil
+
+			if duration := loginLockDuration(key.Kind, lock.Failures); duration > 0 {
+				until := now.Add(duration)
+				lock.LockedUntil = &until
+			}
+
+			err = tx.Model(&lock).Select("failures", "last_failure_at", "locked_until").Updates(&lock).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// clearLoginFailures resets the counter of the account after a successful login. The counter
+// of the IP address is kept, so that logging in to an own account does not allow further guesses.
+func (m *Repository) clearLoginFailures(email string) error {
+	return m.App.DB.
+		Where("kind = ? AND key = ?", models.LoginLockAccount, normalizeEmail(email)).
+		Delete(&models.LoginLock{}).Error
+}
+
+// writeLoginLocked answers a login attempt while the account or the IP address is locked.
+func (m *Repository) writeLoginLocked(w http.ResponseWriter, r *http.Request, until time.Time) {
+	m.writeLocked(w, r, until, "too many failed logins")
+}
+
+// writeLocked answers a request while one of its counters is locked, telling when to try again.
+func (m *Repository) writeLocked(w http.ResponseWriter, r *http.Request, until time.Time, reason string) {
+	wait := int(math.Ceil(time.Until(until).Seconds()))
+	if wait < 1 {
+		wait = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(wait))
+	_ = m.errorJSON(w, r, apierror.New(apierror.TooManyRequests,
+		fmt.Sprintf("%s, try again in %d seconds", reason, wait)))
+}
+
+// loginLockDuration returns how long the counter is locked after the number of failures.
+func loginLockDuration(kind models.LoginLockKind, failures int) time.Duration {
+	var threshold int
+	switch kind {
+	case models.LoginLockIP:
+		threshold = ipLockThreshold
+	case models.LoginLockResetEmail:
+		threshold = resetEmailLockThreshold
+	case models.LoginLockResetIP:
+		threshold = resetIPLockThreshold
+	default:
+		threshold = accountLockThreshold
+	}
+
+	if failures < threshold {
+		return 0
+	}
+
+	duration := loginLockBase
+	for i := threshold; i < failures && duration < loginLockMax; i++ {
+		duration *= 2
+	}
+
+	return min(duration, loginLockMax)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoginLockDuration(t *testing.T) {
+	tests := []struct {
+		kind     models.LoginLockKind
+		failures int
+		want     time.Duration
+	}{
+		{models.LoginLockAccount, 0, 0},
+		{models.LoginLockAccount, accountLockThreshold - 1, 0},
+		{models.LoginLockAccount, accountLockThreshold, time.Minute},
+		{models.LoginLockAccount, accountLockThreshold + 1, 2 * time.Minute},
+		{models.LoginLockAccount, accountLockThreshold + 2, 4 * time.Minute},
+		{models.LoginLockAccount, accountLockThreshold + 5, 32 * time.Minute},
+		{models.LoginLockAccount, accountLockThreshold + 6, time.Hour},
+		{models.LoginLockAccount, 1000, time.Hour},
+		{models.LoginLockIP, accountLockThreshold, 0},
+		{models.LoginLockIP, ipLockThreshold - 1, 0},
+		{models.LoginLockIP, ipLockThreshold, time.Minute},
+		{models.LoginLockIP, ipLockThreshold + 3, 8 * time.Minute},
+		{models.LoginLockIP, 1000, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := loginLockDuration(tt.kind, tt.failures); got != tt.want {
+			t.Errorf("loginLockDuration(%s, %d) = %v, want %v", tt.kind, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordResetLockDuration(t *testing.T) {
+	tests := []struct {
+		kind     models.LoginLockKind
+		failures int
+		want     time.Duration
+	}{
+		{models.LoginLockResetEmail, resetEmailLockThreshold - 1, 0},
+		{models.LoginLockResetEmail, resetEmailLockThreshold, time.Minute},
+		{models.LoginLockResetEmail, resetEmailLockThreshold + 2, 4 * time.Minute},
+		{models.LoginLockResetEmail, 1000, time.Hour},
+		{models.LoginLockResetIP, resetEmailLockThreshold, 0},
+		{models.LoginLockResetIP, resetIPLockThreshold - 1, 0},
+		{models.LoginLockResetIP, resetIPLockThreshold, time.Minute},
+		{models.LoginLockResetIP, 1000, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := loginLockDuration(tt.kind, tt.failures); got != tt.want {
+			t.Errorf("loginLockDuration(%s, %d) = %v, want %v", tt.kind, tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordResetLockKeys(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/password/forgot", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+
+	got := passwordResetLockKeys(r, "  Jane@Example.com ")
+	want := []loginLockKey{
+		{Kind: models.LoginLockResetEmail, Key: "jane@example.com"},
+		{Kind: models.LoginLockResetIP, Key: "203.0.113.7"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("passwordResetLockKeys() = %v, want %v", got, want)
+	}
+}
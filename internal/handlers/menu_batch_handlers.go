@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/pricehistory"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxBatchOperations limits the number of operations in a single batch.
+	maxBatchOperations = 500
+	// maxBatchTitleLength and maxBatchDescriptionLength are the lengths of the menu and menu item columns in characters.
+	maxBatchTitleLength       = 255
+	maxBatchDescriptionLength = 1000
+)
+
+// batchOperation is a single operation of the menu batch request.
+// Menus created earlier in the batch can be referenced by their ref with MenuRef instead of MenuID.
+type batchOperation struct {
+	Op          string  `json:"op"`
+	Ref         string  `json:"ref"`
+	MenuID      uint    `json:"menuId"`
+	MenuRef     string  `json:"menuRef"`
+	MenuItemID  uint    `json:"menuItemId"`
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	PriceUAH    *uint   `json:"priceUAH"`
+}
+
+// validate checks the lengths of the title and description an operation sets.
+func (o batchOperation) validate() error {
+	if o.Title != nil && utf8.RuneCountInString(*o.Title) > maxBatchTitleLength {
+		return apierror.Field("title", apierror.Invalid, fmt.Sprintf("title must be at most %d characters", maxBatchTitleLength))
+	}
+
+	if o.Description != nil && utf8.RuneCountInString(*o.Description) > maxBatchDescriptionLength {
+		return apierror.Field("description", apierror.Invalid, fmt.Sprintf("description must be at most %d characters", maxBatchDescriptionLength))
+	}
+
+	return nil
+}
+
+// menuBatchBody is the menu batch request body structure.
+type menuBatchBody struct {
+	Operations []batchOperation `json:"operations"`
+}
+
+// batchResult is the outcome of a single batch operation.
+type batchResult struct {
+	Index int
+	Op    string
+	OK    bool
+	ID    uint   `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+// errBatchSkipped marks the operations after a failed one.
+var errBatchSkipped = errors.New("skipped because an earlier operation failed")
+
+// BatchMenus applies a list of menu and menu item operations of a restaurant in a single transaction.
+// Supported operations are create_menu, update_menu, delete_menu, create_item, update_item, delete_item
+// and move_item. If any operation fails, none are applied and the results tell which one failed.
+func (m *Repository) BatchMenus(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	var body menuBatchBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding batch data"), http.StatusBadRequest)
+		return
+	}
+
+	if len(body.Operations) == 0 {
+		_ = m.errorJSON(w, r, apierror.Field("operations", apierror.Required, "operations cannot be empty"), http.StatusBadRequest)
+		return
+	}
+
+	if len(body.Operations) > maxBatchOperations {
+		_ = m.errorJSON(w, r, apierror.Field("operations", apierror.TooLong, fmt.Sprintf("a batch cannot have more than %d operations", maxBatchOperations)), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]batchResult, len(body.Operations))
+	for i, operation := range body.Operations {
+		results[i] = batchResult{Index: i, Op: operation.Op}
+	}
+
+	failed := false
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		batch := menuBatch{
+			tx:             tx,
+			restaurantID:   restaurantID,
+			userID:         userID,
+			defaultPicture: m.appURL(imagesPath + defaultMenuItemPicture),
+			refs:           make(map[string]uint),
+		}
+
+		for i, operation := range body.Operations {
+			id, err := batch.apply(operation)
+			// Only an operation the client got wrong fails the batch; database errors are internal
+			var apiErr *apierror.Error
+			if err != nil && errors.As(err, &apiErr) {
+				failed = true
+				failBatch(results, i, err)
+				return err
+			}
+			if err != nil {
+				return err
+			}
+
+			results[i].OK = true
+			results[i].ID = id
+		}
+
+		return nil
+	})
+	if failed {
+		_ = m.writeJSON(w, http.StatusUnprocessableEntity, jsonResponse{
+			Error:   true,
+			Message: "batch failed, no operations were applied",
+			Data:    results,
+		})
+		return
+	}
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  results,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// failBatch records the error of the failed operation and marks the operations after it as skipped.
+// The operations before it are rolled back with the transaction, so none of the results stay OK.
+func failBatch(results []batchResult, failed int, err error) {
+	for i := range results {
+		results[i].OK = false
+		results[i].ID = 0
+
+		switch {
+		case i == failed:
+			results[i].Error = err.Error()
+		case i > failed:
+			results[i].Error = errBatchSkipped.Error()
+		}
+	}
+}
+
+// menuBatch applies batch operations within the transaction of a restaurant whose ownership is already checked.
+type menuBatch struct {
+	tx           *gorm.DB
+	restaurantID uint
+	userID       uint
+	// defaultPicture is the picture of the created menu items.
+	defaultPicture string
+	// refs maps the refs of the menus created in the batch to their IDs.
+	refs map[string]uint
+}
+
+// apply runs a single operation and returns the ID of the affected menu or menu item.
+func (b *menuBatch) apply(operation batchOperation) (uint, error) {
+	if err := operation.validate(); err != nil {
+		return 0, err
+	}
+
+	switch operation.Op {
+	case "create_menu":
+		return b.createMenu(operation)
+	case "update_menu":
+		return b.updateMenu(operation)
+	case "delete_menu":
+		return b.deleteMenu(operation)
+	case "create_item":
+		return b.createItem(operation)
+	case "update_item":
+		return b.updateItem(operation)
+	case "delete_item":
+		return b.deleteItem(operation)
+	case "move_item":
+		return b.moveItem(operation)
+	default:
+		return 0, apierror.Field("op", apierror.Invalid, fmt.Sprintf("invalid op %q", operation.Op))
+	}
+}
+
+func (b *menuBatch) createMenu(operation batchOperation) (uint, error) {
+	if operation.Title == nil || strings.TrimSpace(*operation.Title) == "" {
+		return 0, apierror.Field("title", apierror.Required, "title cannot be empty")
+	}
+
+	if err := b.checkMenuTitle(*operation.Title, 0); err != nil {
+		return 0, err
+	}
+
+	menu := models.Menu{RestaurantID: b.restaurantID, Title: *operation.Title}
+	if err := b.tx.Create(&menu).Error; err != nil {
+		return 0, err
+	}
+
+	if operation.Ref != "" {
+		if _, ok := b.refs[operation.Ref]; ok {
+			return 0, apierror.Field("ref", apierror.Taken, fmt.Sprintf("duplicate ref %q", operation.Ref))
+		}
+		b.refs[operation.Ref] = menu.ID
+	}
+
+	return menu.ID, nil
+}
+
+func (b *menuBatch) updateMenu(operation batchOperation) (uint, error) {
+	menu, err := b.menu(operation)
+	if err != nil {
+		return 0, err
+	}
+
+	if operation.Title != nil {
+		if strings.TrimSpace(*operation.Title) == "" {
+			return 0, apierror.Field("title", apierror.Required, "title cannot be empty")
+		}
+
+		if err := b.checkMenuTitle(*operation.Title, menu.ID); err != nil {
+			return 0, err
+		}
+
+		menu.Title = *operation.Title
+	}
+
+	return menu.ID, b.tx.Save(&menu).Error
+}
+
+func (b *menuBatch) deleteMenu(operation batchOperation) (uint, error) {
+	menu, err := b.menu(operation)
+	if err != nil {
+		return 0, err
+	}
+
+	return menu.ID, b.tx.Delete(&menu).Error
+}
+
+func (b *menuBatch) createItem(operation batchOperation) (uint, error) {
+	menu, err := b.menu(operation)
+	if err != nil {
+		return 0, err
+	}
+
+	if operation.Title == nil || strings.TrimSpace(*operation.Title) == "" {
+		return 0, apierror.Field("title", apierror.Required, "title cannot be empty")
+	}
+
+	menuItem := models.MenuItem{
+		MenuID:  menu.ID,
+		Title:   *operation.Title,
+		Picture: b.defaultPicture,
+	}
+	if operation.Description != nil {
+		menuItem.Description = *operation.Description
+	}
+	if operation.PriceUAH != nil {
+		menuItem.PriceUAH = *operation.PriceUAH
+	}
+
+	if err := b.tx.Create(&menuItem).Error; err != nil {
+		return 0, err
+	}
+
+	return menuItem.ID, pricehistory.Record(b.tx, menuItem, b.restaurantID, 0, b.userID)
+}
+
+func (b *menuBatch) updateItem(operation batchOperation) (uint, error) {
+	menuItem, err := b.menuItem(operation)
+	if err != nil {
+		return 0, err
+	}
+
+	if operation.Title != nil {
+		if strings.TrimSpace(*operation.Title) == "" {
+			return 0, apierror.Field("title", apierror.Required, "title cannot be empty")
+		}
+		menuItem.Title = *operation.Title
+	}
+	if operation.Description != nil {
+		menuItem.Description = *operation.Description
+	}
+
+	oldPriceUAH := menuItem.PriceUAH
+	if operation.PriceUAH != nil {
+		menuItem.PriceUAH = *operation.PriceUAH
+	}
+
+	if err := b.tx.Save(&menuItem).Error; err != nil {
+		return 0, err
+	}
+
+	return menuItem.ID, pricehistory.Record(b.tx, menuItem, b.restaurantID, oldPriceUAH, b.userID)
+}
+
+func (b *menuBatch) deleteItem(operation batchOperation) (uint, error) {
+	menuItem, err := b.menuItem(operation)
+	if err != nil {
+		return 0, err
+	}
+
+	return menuItem.ID, b.tx.Delete(&menuItem).Error
+}
+
+func (b *menuBatch) moveItem(operation batchOperation) (uint, error) {
+	menuItem, err := b.menuItem(operation)
+	if err != nil {
+		return 0, err
+	}
+
+	menu, err := b.menu(operation)
+	if err != nil {
+		return 0, err
+	}
+
+	return menuItem.ID, b.tx.Model(&menuItem).Update("menu_id", menu.ID).Error
+}
+
+// menu loads the menu of the restaurant referenced by the operation's menuId or menuRef.
+func (b *menuBatch) menu(operation batchOperation) (models.Menu, error) {
+	var menu models.Menu
+
+	menuID := operation.MenuID
+	if operation.MenuRef != "" {
+		id, ok := b.refs[operation.MenuRef]
+		if !ok {
+			return menu, apierror.Field("menuRef", apierror.Invalid, fmt.Sprintf("unknown menu ref %q", operation.MenuRef))
+		}
+		menuID = id
+	}
+
+	if menuID == 0 {
+		return menu, apierror.Field("menuId", apierror.Required, "menuId or menuRef is required")
+	}
+
+	err := b.tx.First(&menu, "id = ? AND restaurant_id = ?", menuID, b.restaurantID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return menu, apierror.New(apierror.NotFound, "menu not found")
+	}
+	if err != nil {
+		return menu, err
+	}
+
+	return menu, nil
+}
+
+// menuItem loads the menu item of the restaurant referenced by the operation's menuItemId.
+func (b *menuBatch) menuItem(operation batchOperation) (models.MenuItem, error) {
+	var menuItem models.MenuItem
+
+	if operation.MenuItemID == 0 {
+		return menuItem, apierror.Field("menuItemId", apierror.Required, "menuItemId is required")
+	}
+
+	err := b.tx.Where("menu_id IN (SELECT id FROM menus WHERE restaurant_id = ?)", b.restaurantID).
+		First(&menuItem, "id = ?", operation.MenuItemID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return menuItem, apierror.New(apierror.NotFound, "menu item not found")
+	}
+	if err != nil {
+		return menuItem, err
+	}
+
+	return menuItem, nil
+}
+
+// checkMenuTitle checks that no other menu of the restaurant has the title.
+func (b *menuBatch) checkMenuTitle(title string, exceptID uint) error {
+	var existingMenu models.Menu
+	err := b.tx.Where("title = ? AND restaurant_id = ? AND id <> ?", title, b.restaurantID, exceptID).First(&existingMenu).Error
+	if err == nil {
+		return apierror.Field("title", apierror.Taken, "a menu with this title already exists for this restaurant")
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchOperationValidate(t *testing.T) {
+	text := func(s string) *string {
+		return &s
+	}
+
+	tests := []struct {
+		name      string
+		operation batchOperation
+		wantField string
+	}{
+		{name: "no title or description", operation: batchOperation{Op: "delete_item"}},
+		{
+			name:      "longest values in Cyrillic",
+			operation: batchOperation{Op: "create_item", Title: text(strings.Repeat("т", maxBatchTitleLength)), Description: text(strings.Repeat("о", maxBatchDescriptionLength))},
+		},
+		{name: "too long title", operation: batchOperation{Op: "create_menu", Title: text(strings.Repeat("t", maxBatchTitleLength+1))}, wantField: "title"},
+		{name: "too long description", operation: batchOperation{Op: "update_item", Description: text(strings.Repeat("d", maxBatchDescriptionLength+1))}, wantField: "description"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.operation.validate()
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("validate = %v, want nil", err)
+				}
+				return
+			}
+
+			var apiErr *apierror.Error
+			if !errors.As(err, &apiErr) || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != tt.wantField || apiErr.Fields[0].Reason != apierror.Invalid {
+				t.Fatalf("validate = %v, want an invalid %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestFailBatch(t *testing.T) {
+	results := []batchResult{
+		{Index: 0, Op: "create_menu", OK: true, ID: 5},
+		{Index: 1, Op: "create_item", OK: true, ID: 9},
+		{Index: 2, Op: "update_item"},
+		{Index: 3, Op: "delete_menu"},
+	}
+
+	failBatch(results, 2, apierror.New(apierror.NotFound, "menu item not found"))
+
+	want := []batchResult{
+		{Index: 0, Op: "create_menu"},
+		{Index: 1, Op: "create_item"},
+		{Index: 2, Op: "update_item", Error: "menu item not found"},
+		{Index: 3, Op: "delete_menu", Error: errBatchSkipped.Error()},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
 	"github.com/vladyslavpavlenko/peparesu/internal/models"
 	"net/http"
 	"strconv"
@@ -12,17 +13,19 @@ import (
 func (m *Repository) GetMenus(w http.ResponseWriter, r *http.Request) {
 	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid restaurant id"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
 		return
 	}
 
 	var menus []models.Menu
 	err = m.App.DB.Where("restaurant_id = ?", restaurantID).Find(&menus).Error
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusNotFound)
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
 		return
 	}
 
+	m.translateMenus(r, menus)
+
 	payload := jsonResponse{
 		Error: false,
 		Data:  menus,
@@ -34,20 +37,20 @@ func (m *Repository) GetMenus(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) CreateMenu(w http.ResponseWriter, r *http.Request) {
 	userID, err := m.getUserFromToken(r)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
 	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid restaurant ID"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
 		return
 	}
 
 	if !m.isAdmin(userID) {
 		var restaurant models.Restaurant
 		if err := m.App.DB.First(&restaurant, "id = ? AND owner_id = ?", restaurantID, userID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
 			return
 		}
 	}
@@ -55,20 +58,20 @@ func (m *Repository) CreateMenu(w http.ResponseWriter, r *http.Request) {
 	var newMenu models.Menu
 	err = json.NewDecoder(r.Body).Decode(&newMenu)
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("error decoding menu data"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding menu data"), http.StatusBadRequest)
 		return
 	}
 
 	var existingMenu models.Menu
 	if err := m.App.DB.Where("title = ? AND restaurant_id = ?", newMenu.Title, restaurantID).First(&existingMenu).Error; err == nil {
-		_ = m.errorJSON(w, errors.New("a menu with this title already exists for this restaurant"), http.StatusConflict)
+		_ = m.errorJSON(w, r, errors.New("a menu with this title already exists for this restaurant"), http.StatusConflict)
 		return
 	}
 
 	newMenu.RestaurantID = uint(restaurantID)
 
 	if err := m.App.DB.Create(&newMenu).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -82,44 +85,44 @@ func (m *Repository) CreateMenu(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) UpdateMenu(w http.ResponseWriter, r *http.Request) {
 	userID, err := m.getUserFromToken(r)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
 	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid restaurant ID"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
 		return
 	}
 
 	menuID, err := strconv.Atoi(chi.URLParam(r, "menu_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu ID"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_id"))
 		return
 	}
 
 	if !m.isAdmin(userID) {
 		var existingRestaurant models.Restaurant
 		if err := m.App.DB.First(&existingRestaurant, "id = ? AND owner_id = ?", restaurantID, userID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
 			return
 		}
 	}
 
 	var existingMenu models.Menu
 	if err := m.App.DB.First(&existingMenu, "id = ?", menuID).Error; err != nil {
-		_ = m.errorJSON(w, errors.New("menu not found"), http.StatusNotFound)
+		_ = m.errorJSON(w, r, errors.New("menu not found"), http.StatusNotFound)
 		return
 	}
 
 	err = json.NewDecoder(r.Body).Decode(&existingMenu)
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("error decoding menu data"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding menu data"), http.StatusBadRequest)
 		return
 	}
 
 	if err := m.App.DB.Save(&existingMenu).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -133,31 +136,31 @@ func (m *Repository) UpdateMenu(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) DeleteMenu(w http.ResponseWriter, r *http.Request) {
 	userID, err := m.getUserFromToken(r)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
 	menuID, err := strconv.Atoi(chi.URLParam(r, "menu_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu ID"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_id"), http.StatusBadRequest)
 		return
 	}
 
 	var menu models.Menu
 	if m.isAdmin(userID) {
 		if err := m.App.DB.First(&menu, menuID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("menu not found"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("menu not found"), http.StatusNotFound)
 			return
 		}
 	} else {
 		if err := m.App.DB.First(&menu, "id = ? AND restaurant_id IN (SELECT id FROM restaurants WHERE owner_id = ?)", menuID, userID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("menu not found or not owned by the user"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("menu not found or not owned by the user"), http.StatusNotFound)
 			return
 		}
 	}
 
 	if err := m.App.DB.Delete(&menu).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/menuimport"
+	"net/http"
+	"strconv"
+)
+
+// ImportMenus imports menus and menu items of a restaurant from an uploaded CSV or XLSX sheet.
+// With the `dry_run` query parameter set, the import is only validated and previewed.
+// Invalid rows are reported one by one and nothing is saved unless all rows are valid.
+func (m *Repository) ImportMenus(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB limit
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error parsing form"), http.StatusBadRequest)
+		return
+	}
+
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid dry_run value", apierror.FieldError{Field: "dry_run", Reason: apierror.Invalid}))
+			return
+		}
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("error retrieving the file"), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	format, err := menuimport.FormatFromFilename(header.Filename)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	report, err := menuimport.Import(m.App.DB, restaurantID, file, format, menuimport.Options{
+		ImagesDir:      "storage/images",
+		ImagesURL:      m.appURL("/api/v1/storage/images"),
+		DefaultPicture: m.appURL("/api/v1/storage/images/menuitem-default.jpeg"),
+		ActorID:        userID,
+		DryRun:         dryRun,
+	})
+	if errors.Is(err, menuimport.ErrInvalidRows) {
+		_ = m.writeJSON(w, http.StatusUnprocessableEntity, jsonResponse{
+			Error:   true,
+			Message: err.Error(),
+			Data:    report,
+		})
+		return
+	}
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusCreated
+	if dryRun {
+		status = http.StatusOK
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  report,
+	}
+	_ = m.writeJSON(w, status, payload)
+}
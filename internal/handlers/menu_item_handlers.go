@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
 	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/pricehistory"
+	"gorm.io/gorm"
 	"io"
 	"net/http"
 	"os"
@@ -15,30 +18,38 @@ import (
 func (m *Repository) GetMenu(w http.ResponseWriter, r *http.Request) {
 	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid restaurant id"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
 		return
 	}
 
 	menuID, err := strconv.Atoi(chi.URLParam(r, "menu_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu id"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_id"))
 		return
 	}
 
 	var menu models.Menu
 	err = m.App.DB.Where("restaurant_id = ? AND id = ?", restaurantID, menuID).First(&menu).Error
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusNotFound)
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
 		return
 	}
 
 	var menuItems []models.MenuItem
 	err = m.App.DB.Where("menu_id = ?", menu.ID).Find(&menuItems).Error
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusNotFound)
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
 		return
 	}
 
+	if err := m.priceMenuItems(menu.RestaurantID, menuItems); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	m.markFavouriteMenuItems(r, menuItems)
+	m.translateMenuItems(r, menuItems)
+
 	payload := jsonResponse{
 		Error: false,
 		Data:  menuItems,
@@ -50,36 +61,46 @@ func (m *Repository) GetMenu(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) GetMenuItem(w http.ResponseWriter, r *http.Request) {
 	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid restaurant ID"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
 		return
 	}
 
 	menuID, err := strconv.Atoi(chi.URLParam(r, "menu_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu ID"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_id"))
 		return
 	}
 
 	menuItemID, err := strconv.Atoi(chi.URLParam(r, "menu_item_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu item ID"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_item_id"))
 		return
 	}
 
 	var menu models.Menu
 	err = m.App.DB.Where("restaurant_id = ? AND id = ?", restaurantID, menuID).First(&menu).Error
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusNotFound)
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
 		return
 	}
 
 	var menuItem models.MenuItem
 	err = m.App.DB.Where("menu_id = ? AND id = ?", menu.ID, menuItemID).First(&menuItem).Error
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusNotFound)
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	menuItems := []models.MenuItem{menuItem}
+	if err := m.priceMenuItems(menu.RestaurantID, menuItems); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
+	m.markFavouriteMenuItems(r, menuItems)
+	m.translateMenuItems(r, menuItems)
+	menuItem = menuItems[0]
+
 	payload := jsonResponse{
 		Error: false,
 		Data:  menuItem,
@@ -91,20 +112,20 @@ func (m *Repository) GetMenuItem(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) LikeMenuItem(w http.ResponseWriter, r *http.Request) {
 	menuID, err := strconv.Atoi(chi.URLParam(r, "menu_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu ID"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_id"), http.StatusBadRequest)
 		return
 	}
 
 	menuItemID, err := strconv.Atoi(chi.URLParam(r, "menu_item_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu item ID"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_item_id"), http.StatusBadRequest)
 		return
 	}
 
 	var menuItem models.MenuItem
 	err = m.App.DB.Where("menu_id = ? AND id = ?", menuID, menuItemID).First(&menuItem).Error
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusNotFound)
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
 		return
 	}
 
@@ -116,13 +137,18 @@ func (m *Repository) LikeMenuItem(w http.ResponseWriter, r *http.Request) {
 			menuItem.LikesCount--
 		}
 	} else {
-		_ = m.errorJSON(w, errors.New("invalid action, expected 'like' or 'unlike'"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid action, expected 'like' or 'unlike'", apierror.FieldError{Field: "action", Reason: apierror.Invalid}), http.StatusBadRequest)
 		return
 	}
 
 	err = m.App.DB.Save(&menuItem).Error
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := m.priceMenuItemRefs([]*models.MenuItem{&menuItem}); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -136,25 +162,25 @@ func (m *Repository) LikeMenuItem(w http.ResponseWriter, r *http.Request) {
 
 func (m *Repository) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB limit
-		_ = m.errorJSON(w, errors.New("error parsing form"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error parsing form"), http.StatusBadRequest)
 		return
 	}
 
 	userID, err := m.getUserFromToken(r)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
 	var user models.User
 	if err := m.App.DB.First(&user, "id = ?", userID).Error; err != nil {
-		_ = m.errorJSON(w, errors.New("user not found"), http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, errors.New("user not found"), http.StatusUnauthorized)
 		return
 	}
 
 	menuID, err := strconv.Atoi(chi.URLParam(r, "menu_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu ID"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_id"), http.StatusBadRequest)
 		return
 	}
 
@@ -162,9 +188,9 @@ func (m *Repository) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
 	if err := m.App.DB.Joins("JOIN restaurants ON restaurants.id = menus.restaurant_id").
 		First(&menu, "menus.id = ? AND (restaurants.owner_id = ? OR ? = 2)", menuID, userID, user.UserTypeID).Error; err != nil {
 		if m.isAdmin(user.UserTypeID) {
-			_ = m.errorJSON(w, errors.New("menu not found or access denied"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("menu not found or access denied"), http.StatusNotFound)
 		} else {
-			_ = m.errorJSON(w, errors.New("menu not found"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("menu not found"), http.StatusNotFound)
 		}
 		return
 	}
@@ -178,14 +204,21 @@ func (m *Repository) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
 	priceUAH, _ := strconv.ParseInt(r.FormValue("price_uah"), 10, 64)
 	newMenuItem.PriceUAH = uint(priceUAH)
 
-	if err := m.App.DB.Create(&newMenuItem).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newMenuItem).Error; err != nil {
+			return err
+		}
+
+		return pricehistory.Record(tx, newMenuItem, menu.RestaurantID, 0, userID)
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
 	file, _, err := r.FormFile("picture")
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("error retrieving the file"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, errors.New("error retrieving the file"), http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
@@ -193,20 +226,25 @@ func (m *Repository) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
 	filePath := filepath.Join("storage/images", fmt.Sprintf("menuitem-%d.jpeg", newMenuItem.ID))
 	dst, err := os.Create(filePath)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 	defer dst.Close()
 
 	if _, err = io.Copy(dst, file); err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
 	newMenuItem.Picture = fmt.Sprintf("http://localhost:8080/api/v1/%s", filePath)
 
 	if err := m.App.DB.Save(&newMenuItem).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := m.priceMenuItemRefs([]*models.MenuItem{&newMenuItem}); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -219,45 +257,48 @@ func (m *Repository) CreateMenuItem(w http.ResponseWriter, r *http.Request) {
 
 func (m *Repository) UpdateMenuItem(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 MB
-		_ = m.errorJSON(w, errors.New("error parsing form"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error parsing form"), http.StatusBadRequest)
 		return
 	}
 
 	userID, err := m.getUserFromToken(r)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
 	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid restaurant ID"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
 		return
 	}
 
 	menuItemID, err := strconv.Atoi(chi.URLParam(r, "menu_item_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu item ID"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_item_id"), http.StatusBadRequest)
 		return
 	}
 
 	if !m.isAdmin(userID) {
 		var existingRestaurant models.Restaurant
 		if err := m.App.DB.First(&existingRestaurant, "id = ? AND owner_id = ?", restaurantID, userID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
 			return
 		}
 	}
 
 	var existingMenuItem models.MenuItem
-	if err := m.App.DB.First(&existingMenuItem, "id = ?", menuItemID).Error; err != nil {
-		_ = m.errorJSON(w, errors.New("menu item not found"), http.StatusNotFound)
+	err = m.App.DB.Where("menu_id IN (SELECT id FROM menus WHERE restaurant_id = ?)", restaurantID).
+		First(&existingMenuItem, "id = ?", menuItemID).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("menu item not found"), http.StatusNotFound)
 		return
 	}
 
 	existingMenuItem.Title = r.FormValue("title")
 	existingMenuItem.Description = r.FormValue("description")
 
+	oldPriceUAH := existingMenuItem.PriceUAH
 	priceUAH, _ := strconv.ParseInt(r.FormValue("price_uah"), 10, 64)
 	existingMenuItem.PriceUAH = uint(priceUAH)
 
@@ -268,24 +309,36 @@ func (m *Repository) UpdateMenuItem(w http.ResponseWriter, r *http.Request) {
 		filePath := filepath.Join("storage/images", fmt.Sprintf("menuitem-%d.jpeg", menuItemID))
 		dst, err := os.Create(filePath)
 		if err != nil {
-			_ = m.errorJSON(w, err, http.StatusInternalServerError)
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 			return
 		}
 		defer dst.Close()
 
 		if _, err = io.Copy(dst, file); err != nil {
-			_ = m.errorJSON(w, err, http.StatusInternalServerError)
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 			return
 		}
 
 		existingMenuItem.Picture = fmt.Sprintf("http://localhost:8080/api/v1/%s", filePath)
 	} else if !errors.Is(err, http.ErrMissingFile) {
-		_ = m.errorJSON(w, errors.New("error processing uploaded file"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, errors.New("error processing uploaded file"), http.StatusBadRequest)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&existingMenuItem).Error; err != nil {
+			return err
+		}
+
+		return pricehistory.Record(tx, existingMenuItem, uint(restaurantID), oldPriceUAH, userID)
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	if err := m.App.DB.Save(&existingMenuItem).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+	if err := m.priceMenuItemRefs([]*models.MenuItem{&existingMenuItem}); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -298,31 +351,31 @@ func (m *Repository) UpdateMenuItem(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) DeleteMenuItem(w http.ResponseWriter, r *http.Request) {
 	userID, err := m.getUserFromToken(r)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
 	menuItemID, err := strconv.Atoi(chi.URLParam(r, "menu_item_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid menu item ID"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_item_id"), http.StatusBadRequest)
 		return
 	}
 
 	var menuItem models.MenuItem
 	if m.isAdmin(userID) {
 		if err := m.App.DB.First(&menuItem, menuItemID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("menu item not found"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("menu item not found"), http.StatusNotFound)
 			return
 		}
 	} else {
 		if err := m.App.DB.First(&menuItem, "id = ? AND menu_id IN (SELECT id FROM menus WHERE restaurant_id IN (SELECT id FROM restaurants WHERE owner_id = ?))", menuItemID, userID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("menu item not found or not owned by the user"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("menu item not found or not owned by the user"), http.StatusNotFound)
 			return
 		}
 	}
 
 	if err := m.App.DB.Delete(&menuItem).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/menupdf"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/storage"
+	"gorm.io/gorm"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// GetMenusPDF renders the menus of a restaurant into a printable PDF.
+// The `layout` query parameter selects classic (default) or compact, `size` selects A4 (default) or A5,
+// and `photos` adds the menu item pictures.
+func (m *Repository) GetMenusPDF(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	query := r.URL.Query()
+
+	layout, err := menupdf.ParseLayout(query.Get("layout"))
+	if err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	pageSize, err := menupdf.ParsePageSize(query.Get("size"))
+	if err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	photos := false
+	if value := query.Get("photos"); value != "" {
+		photos, err = strconv.ParseBool(value)
+		if err != nil {
+			_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid photos value", apierror.FieldError{Field: "photos", Reason: apierror.Invalid}))
+			return
+		}
+	}
+
+	var restaurant models.Restaurant
+	if err := m.App.DB.First(&restaurant, "id = ?", restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
+		return
+	}
+
+	var menus []models.Menu
+	err = m.App.DB.Preload("MenuItems", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("restaurant_id = ?", restaurant.ID).Order("id").Find(&menus).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	restaurants := []models.Restaurant{restaurant}
+	m.translateRestaurants(r, restaurants)
+	restaurant = restaurants[0]
+
+	m.translateMenus(r, menus)
+	for _, menu := range menus {
+		m.translateMenuItems(r, menu.MenuItems)
+	}
+
+	buf := new(bytes.Buffer)
+	err = menupdf.Render(buf, restaurant, menus, menupdf.Options{
+		Layout:   layout,
+		PageSize: pageSize,
+		Photos:   photos,
+		Image:    m.storageImage,
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="menu-%d.pdf"`, restaurant.ID))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// storageImage reads a picture served from the application storage.
+// Pictures hosted elsewhere and the default menu item picture are not loaded.
+func (m *Repository) storageImage(picture string) ([]byte, error) {
+	name, ok := storage.ImageName(picture, imagesPath)
+	if !ok || name == defaultMenuItemPicture {
+		return nil, errors.New("picture is not a menu item image in the application storage")
+	}
+
+	return os.ReadFile(filepath.Join(imagesDir, name))
+}
@@ -3,85 +3,164 @@ package handlers
 import (
 	"context"
 	"errors"
-	"fmt"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
 	"github.com/vladyslavpavlenko/peparesu/internal/models"
 	"net/http"
-	"time"
+	"net/netip"
+	"strconv"
+	"strings"
 )
 
-// RequireAuth is a middleware that checks for the presence and validity of a JWT in the request cookie.
+// RequireAuth is a middleware that checks for the presence and validity of a JWT in the Authorization
+// header or the request cookie and that its session has not been revoked. Requests with an API key
+// are let through only to the integration routes of the key's restaurant that its scope allows. Suspended users
+// are refused.
 func (m *Repository) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get the cookie of request
-		tokenCookie, err := r.Cookie("user_jwt")
-		if err != nil {
-			_ = m.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		var userID uint
+		var ctx context.Context
 
-			return
-		}
+		if token, ok := bearerToken(r); ok && isAPIKey(token) {
+			key, err := m.authenticateAPIKey(r)
+			if err != nil {
+				_ = m.errorJSON(w, r, errors.New("unauthorized"), http.StatusUnauthorized)
+				return
+			}
 
-		// Decode/validate it
-		token, err := jwt.Parse(tokenCookie.Value, func(token *jwt.Token) (any, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			if err := apiKeyAllows(key, r); err != nil {
+				_ = m.errorJSON(w, r, err, http.StatusForbidden)
+				return
 			}
 
-			return []byte(m.App.Env.JWTSecret), nil
-		})
+			m.touchAPIKey(&key)
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// Check the exp
-			if float64(time.Now().Unix()) > claims["exp"].(float64) {
-				_ = m.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+			userID = key.Restaurant.OwnerID
+			ctx = context.WithValue(r.Context(), "api_key", key)
+		} else {
+			session, err := m.authenticate(r)
+			if err != nil {
+				_ = m.errorJSON(w, r, errors.New("unauthorized"), http.StatusUnauthorized)
 				return
 			}
 
-			// Find the user with token sub
-			var user models.User
+			m.touchSession(r, &session)
 
-			m.App.DB.Preload("UserType").First(&user, "id = ?", claims["sub"])
+			userID = session.UserID
+			ctx = context.WithValue(r.Context(), "session", session)
+		}
 
-			if user.ID == 0 {
-				_ = m.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
-				return
-			}
+		// Find the user of the session or the owner of the API key restaurant
+		var user models.User
 
-			ctx := context.WithValue(r.Context(), "user", user)
+		m.App.DB.Preload("UserType").First(&user, "id = ?", userID)
 
-			next.ServeHTTP(w, r.WithContext(ctx))
-		} else {
-			_ = m.errorJSON(w, errors.New("unauthorized"), http.StatusUnauthorized)
+		if user.ID == 0 {
+			_ = m.errorJSON(w, r, errors.New("unauthorized"), http.StatusUnauthorized)
+			return
+		}
+
+		// Suspended users and the API keys of their restaurants are refused
+		if !m.requireActiveAccount(w, r, user) {
+			return
+		}
+
+		// Responses to impersonation sessions are marked, and their changes audited
+		if session, ok := ctx.Value("session").(models.Session); ok && session.ImpersonatorID != nil {
+			w.Header().Set(impersonationHeader, strconv.FormatUint(uint64(*session.ImpersonatorID), 10))
+			m.auditImpersonatedRequest(r, session)
+		}
+
+		// Users who must use two-factor authentication can do nothing else until they enable it
+		if _, isSession := ctx.Value("session").(models.Session); isSession && user.TOTPEnabledAt == nil &&
+			!twoFactorEnrolmentPath(r) && m.twoFactorRequired(user) {
+			_ = m.errorJSON(w, r, apierror.New(apierror.TwoFactorRequired, "two-factor authentication is mandatory for this account"))
 			return
 		}
+
+		ctx = context.WithValue(ctx, "user", user)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// RequireNoAuth is a middleware that checks for the presence of a JWT in the request cookie.
+// RequireNoAuth is a middleware that rejects requests with a valid JWT of an active session in the request cookie.
 func (m *Repository) RequireNoAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Attempt to get the cookie from the request
-		tokenCookie, err := r.Cookie("user_jwt")
+		if _, err := m.authenticate(r); err == nil {
+			_ = m.errorJSON(w, r, errors.New("already authenticated"), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
 
-		// If no cookie, proceed with the next handler
+// RequireAdmin is a middleware that restricts access to admin users. It must be used after RequireAuth.
+func (m *Repository) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := m.getUserFromToken(r)
 		if err != nil {
-			next.ServeHTTP(w, r)
+			_ = m.errorJSON(w, r, errors.New("unauthorized"), http.StatusUnauthorized)
 			return
 		}
 
-		// Attempt to decode and validate the JWT
-		token, err := jwt.Parse(tokenCookie.Value, func(token *jwt.Token) (any, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(m.App.Env.JWTSecret), nil
-		})
-
-		if err == nil && token.Valid {
-			_ = m.errorJSON(w, errors.New("already authenticated"), http.StatusForbidden)
+		if !m.isAdmin(userID) {
+			_ = m.errorJSON(w, r, errors.New("forbidden"), http.StatusForbidden)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RealIP is a middleware that sets the remote address of a request from a trusted proxy to the client
+// address the proxy forwarded in X-Forwarded-For, so that sessions, login locks and the audit log see
+// the client rather than the proxy. The header of any other request is ignored, as clients can set it.
+func (m *Repository) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := forwardedClientIP(r, m.App.Env.TrustedProxies); ok {
+			r.RemoteAddr = ip
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedClientIP returns the client address of a request from a trusted proxy. It is the last address
+// of X-Forwarded-For that is not a trusted proxy, since the addresses before it are set by the client.
+func forwardedClientIP(r *http.Request, trusted []netip.Prefix) (string, bool) {
+	peer, err := netip.ParseAddr(clientIP(r))
+	if err != nil || !trustedProxy(peer, trusted) {
+		return "", false
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return "", false
+		}
+
+		if !trustedProxy(addr, trusted) {
+			return addr.Unmap().String(), true
+		}
+	}
+
+	return "", false
+}
+
+// trustedProxy reports whether the address is one of the trusted proxies.
+func trustedProxy(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
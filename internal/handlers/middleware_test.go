@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestForwardedClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  []string
+		trusted       []netip.Prefix
+		wantIP        string
+		wantForwarded bool
+	}{
+		{name: "no trusted proxies", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"203.0.113.7"}},
+		{name: "request not from a proxy", remoteAddr: "198.51.100.2:4000", forwardedFor: []string{"203.0.113.7"}, trusted: trusted},
+		{name: "from a proxy", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"203.0.113.7"}, trusted: trusted, wantIP: "203.0.113.7", wantForwarded: true},
+		{name: "client-set addresses are skipped", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"1.2.3.4, 203.0.113.7"}, trusted: trusted, wantIP: "203.0.113.7", wantForwarded: true},
+		{name: "chain of proxies", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"1.2.3.4, 203.0.113.7", "10.0.0.2"}, trusted: trusted, wantIP: "203.0.113.7", wantForwarded: true},
+		{name: "IPv6 proxy", remoteAddr: "[2001:db8::1]:4000", forwardedFor: []string{"2001:db9::5"}, trusted: trusted, wantIP: "2001:db9::5", wantForwarded: true},
+		{name: "IPv4-mapped client", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"::ffff:203.0.113.7"}, trusted: trusted, wantIP: "203.0.113.7", wantForwarded: true},
+		{name: "no header", remoteAddr: "10.0.0.1:4000", trusted: trusted},
+		{name: "only proxies", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"10.0.0.2"}, trusted: trusted},
+		{name: "malformed address", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"1.2.3.4, unknown"}, trusted: trusted},
+		{name: "malformed proxy hop", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"203.0.113.7, unknown"}, trusted: trusted},
+		{name: "empty hop", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"203.0.113.7, "}, trusted: trusted},
+		{name: "empty header", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{""}, trusted: trusted},
+		{name: "address with a port", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"203.0.113.7:5000"}, trusted: trusted},
+		{name: "extra spaces", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"  203.0.113.7 ,10.0.0.2  "}, trusted: trusted, wantIP: "203.0.113.7", wantForwarded: true},
+		{name: "IPv4-mapped proxy", remoteAddr: "[::ffff:10.0.0.1]:4000", forwardedFor: []string{"203.0.113.7"}, trusted: trusted, wantIP: "203.0.113.7", wantForwarded: true},
+		{name: "IPv4-mapped proxy hop", remoteAddr: "10.0.0.1:4000", forwardedFor: []string{"203.0.113.7, ::ffff:10.0.0.2"}, trusted: trusted, wantIP: "203.0.113.7", wantForwarded: true},
+		{name: "remote address without a port", remoteAddr: "10.0.0.1", forwardedFor: []string{"203.0.113.7"}, trusted: trusted, wantIP: "203.0.113.7", wantForwarded: true},
+		{name: "malformed remote address", remoteAddr: "proxy:4000", forwardedFor: []string{"203.0.113.7"}, trusted: trusted},
+		{name: "spoofed proxy address", remoteAddr: "198.51.100.2:4000", forwardedFor: []string{"203.0.113.7, 10.0.0.2"}, trusted: trusted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			ip, ok := forwardedClientIP(r, tt.trusted)
+			if ip != tt.wantIP || ok != tt.wantForwarded {
+				t.Errorf("forwardedClientIP = %q, %v, want %q, %v", ip, ok, tt.wantIP, tt.wantForwarded)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/oidclogin"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// oidcStateCookie keeps the state, nonce and PKCE verifier of a login between the redirects.
+	oidcStateCookie = "oidc_state"
+	// oidcStateTTL is how long the user has to log in at the provider.
+	oidcStateTTL = 10 * time.Minute
+	// revokedOIDCLink is the reason the sessions of an unverified account are revoked when it is linked.
+	revokedOIDCLink = "oidc_link"
+)
+
+// oidcState is the content of the signed state cookie of a login.
+type oidcState struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GetOIDCProviders returns the names of the configured OIDC login providers.
+func (m *Repository) GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	names := []string{}
+	if m.App.OIDCProviders != nil {
+		names = m.App.OIDCProviders.Names()
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  names,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// OIDCLogin redirects to the login page of an OIDC provider. The optional redirect query parameter
+// is an application path the user is sent to after logging in.
+func (m *Repository) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, err := m.App.OIDCProviders.Get(name)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	redirect := r.URL.Query().Get("redirect")
+	if redirect != "" && (!strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//")) {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid redirect, expected an application path", apierror.FieldError{Field: "redirect", Reason: apierror.Invalid}))
+		return
+	}
+
+	state := oidcState{
+		Provider: name,
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: redirect,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcStateTTL)),
+		},
+	}
+	if state.State, err = randomToken(16); err == nil {
+		state.Nonce, err = randomToken(16)
+	}
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.Wrap(apierror.Unavailable, err))
+		return
+	}
+
+	stateToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, state).SignedString([]byte(m.App.Env.JWTSecret))
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     oidcCallbackPath(name),
+		Value:    stateToken,
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		Secure:   false,
+		HttpOnly: true,
+		// Lax so that the cookie is sent on the redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback completes the login at an OIDC provider. The user is found by the provider account,
+// or else linked by the email address when the provider has verified it, or else signed up.
+func (m *Repository) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, err := m.App.OIDCProviders.Get(name)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	// The state cookie is single-use
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcCallbackPath(name), MaxAge: -1, HttpOnly: true})
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		_ = m.errorJSON(w, r, fmt.Errorf("login at %s failed: %s", name, providerErr), http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("login expired, try again"), http.StatusUnauthorized)
+		return
+	}
+
+	var state oidcState
+	_, err = jwt.ParseWithClaims(cookie.Value, &state, func(token *jwt.Token) (any, error) {
+		return []byte(m.App.Env.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || state.Provider != name || state.State == "" || state.State != query.Get("state") {
+		_ = m.errorJSON(w, r, errors.New("invalid login state, try again"), http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), state.Nonce, state.Verifier)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	user, err := m.oidcUser(identity)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !m.requireActiveAccount(w, r, user) {
+		return
+	}
+
+	// The provider login does not replace the second factor
+	if user.TOTPEnabledAt != nil {
+		m.writeTwoFactorChallenge(w, r, user)
+		return
+	}
+
+	_, err = m.startSession(w, r, user.ID)
+	if err != nil {
+		_ = m.errorJSON(w, r, fmt.Errorf("failed to start session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if state.Redirect != "" {
+		http.Redirect(w, r, state.Redirect, http.StatusFound)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("logged in as %s %s", user.FirstName, user.LastName),
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// oidcUser returns the user of the provider identity, linking or creating one by the email address.
+// The provider has verified the address, so the user's email counts as verified too. An account whose
+// email was never verified may have been registered by someone else in advance, so linking it clears
+// its password and two-factor authentication and revokes its sessions.
+func (m *Repository) oidcUser(identity oidclogin.Identity) (models.User, error) {
+	var user models.User
+
+	err := m.App.DB.Transaction(func(tx *gorm.DB) error {
+		var linked models.OAuthIdentity
+		err := tx.Preload("User").First(&linked, "provider = ? AND subject = ?", identity.Provider, identity.Subject).Error
+		if err == nil {
+			user = linked.User
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var found *models.User
+
+		user, err = userByEmail(tx, identity.Email)
+		if err == nil {
+			found = &user
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		link, err := oidcEmailLink(identity, found)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+
+		switch link {
+		case oidcClaimUser:
+			err = claimUnverifiedUser(tx, &user, now)
+		case oidcSignUpUser:
+			user = newOIDCUser(identity, now)
+			err = tx.Create(&user).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.OAuthIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}).Error
+	})
+
+	return user, err
+}
+
+// oidcLink is how a provider identity that has not been linked yet gets its user.
+type oidcLink int
+
+const (
+	// oidcLinkUser links the verified account with the email of the identity.
+	oidcLinkUser oidcLink = iota
+	// oidcClaimUser links the unverified account with the email of the identity after claiming it.
+	oidcClaimUser
+	// oidcSignUpUser signs up a new user, as no account has the email of the identity.
+	oidcSignUpUser
+)
+
+// oidcEmailLink decides how to link the identity by its email address, given the user found with
+// that email or nil. Linking by an unverified email would let anyone take over the account with that email.
+func oidcEmailLink(identity oidclogin.Identity, found *models.User) (oidcLink, error) {
+	if identity.Email == "" || !identity.EmailVerified {
+		return 0, apierror.New(apierror.Forbidden, "the provider has not verified the email address")
+	}
+
+	switch {
+	case found == nil:
+		return oidcSignUpUser, nil
+	case found.EmailVerifiedAt == nil:
+		return oidcClaimUser, nil
+	default:
+		return oidcLinkUser, nil
+	}
+}
+
+// newOIDCUser returns the user signed up with the identity, named after its email when the provider
+// has no name.
+func newOIDCUser(identity oidclogin.Identity, now time.Time) models.User {
+	user := models.User{
+		FirstName:       identity.GivenName,
+		LastName:        identity.FamilyName,
+		Email:           normalizeEmail(identity.Email),
+		UserTypeID:      1, // User
+		EmailVerifiedAt: &now,
+	}
+	if user.FirstName == "" {
+		user.FirstName, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	return user
+}
+
+// claimUnverifiedUser verifies the email of the user and removes the credentials of whoever
+// registered the account before the owner of the email proved it.
+func claimUnverifiedUser(tx *gorm.DB, user *models.User, now time.Time) error {
+	err := tx.Model(user).Updates(map[string]any{
+		"email_verified_at": now,
+		"password":          "",
+		"totp_secret":       "",
+		"totp_enabled_at":   nil,
+		"totp_last_step":    0,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	user.EmailVerifiedAt = &now
+	user.Password = ""
+	user.TOTPSecret, user.TOTPEnabledAt, user.TOTPLastStep = "", nil, 0
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	_, err = revokeUserSessions(tx, user.ID, 0, revokedOIDCLink)
+	return err
+}
+
+// oidcCallbackPath returns the path of the callback of the provider.
+func oidcCallbackPath(provider string) string {
+	return "/api/v1/auth/oidc/" + provider + "/callback"
+}
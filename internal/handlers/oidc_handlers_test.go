@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladyslavpavlenko/peparesu/config"
+	"github.com/vladyslavpavlenko/peparesu/internal/mockoidc"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/oidclogin"
+	"golang.org/x/oauth2"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testJWTSecret = "test-secret"
+
+// oidcTest runs the OIDC login routes of the application against a mock provider.
+type oidcTest struct {
+	app    *httptest.Server
+	client *http.Client
+}
+
+// newOIDCTest starts the application and the mock provider. The database can be nil
+// for logins that fail before the user is looked up.
+func newOIDCTest(t *testing.T, db *gorm.DB) *oidcTest {
+	t.Helper()
+
+	var provider *mockoidc.Server
+	providerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider.ServeHTTP(w, r)
+	}))
+	t.Cleanup(providerServer.Close)
+
+	var err error
+	provider, err = mockoidc.New(providerServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &Repository{App: &config.AppConfig{DB: db, Env: &config.EnvVariables{JWTSecret: testJWTSecret}}}
+
+	mux := chi.NewRouter()
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Get("/auth/oidc/{provider}/login", repo.OIDCLogin)
+		mux.Get("/auth/oidc/{provider}/callback", repo.OIDCCallback)
+	})
+	app := httptest.NewServer(mux)
+	t.Cleanup(app.Close)
+
+	repo.App.Env.AppURL = app.URL
+	repo.App.OIDCProviders = oidclogin.New([]oidclogin.Config{{
+		Name:        "mock",
+		Issuer:      providerServer.URL,
+		ClientID:    "peparesu",
+		RedirectURL: app.URL + oidcCallbackPath("mock"),
+	}})
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &oidcTest{
+		app: app,
+		client: &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+}
+
+// get requests the URL without following redirects.
+func (o *oidcTest) get(t *testing.T, rawURL string) *http.Response {
+	t.Helper()
+
+	resp, err := o.client.Get(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp
+}
+
+// redirect returns the location the response redirects to.
+func redirect(t *testing.T, resp *http.Response) *url.URL {
+	t.Helper()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return location
+}
+
+// callbackURL is the URL the state cookie is scoped to.
+func (o *oidcTest) callbackURL(t *testing.T) *url.URL {
+	t.Helper()
+
+	callbackURL, err := url.Parse(o.app.URL + oidcCallbackPath("mock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return callbackURL
+}
+
+// state returns the login state from the state cookie.
+func (o *oidcTest) state(t *testing.T) oidcState {
+	t.Helper()
+
+	for _, cookie := range o.client.Jar.Cookies(o.callbackURL(t)) {
+		if cookie.Name != oidcStateCookie {
+			continue
+		}
+
+		var state oidcState
+		_, err := jwt.ParseWithClaims(cookie.Value, &state, func(*jwt.Token) (any, error) {
+			return []byte(testJWTSecret), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return state
+	}
+
+	t.Fatal("no state cookie was set")
+	return oidcState{}
+}
+
+// setState replaces the state cookie with the state signed by the secret.
+func (o *oidcTest) setState(t *testing.T, state oidcState, secret string) {
+	t.Helper()
+
+	value, err := jwt.NewWithClaims(jwt.SigningMethodHS256, state).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o.client.Jar.SetCookies(o.callbackURL(t), []*http.Cookie{{Name: oidcStateCookie, Path: oidcCallbackPath("mock"), Value: value}})
+}
+
+// login starts the login, checks that the provider is asked for PKCE and the nonce of the state
+// cookie, and logs in at the provider with the params. It returns the callback URL with the code.
+func (o *oidcTest) login(t *testing.T, params url.Values) *url.URL {
+	t.Helper()
+
+	authURL := redirect(t, o.get(t, o.app.URL+"/api/v1/auth/oidc/mock/login"))
+	state := o.state(t)
+
+	query := authURL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") != oauth2.S256ChallengeFromVerifier(state.Verifier) {
+		t.Fatalf("authorization URL does not carry the S256 challenge of the state verifier: %s", authURL)
+	}
+	if query.Get("nonce") == "" || query.Get("nonce") != state.Nonce {
+		t.Fatalf("authorization URL nonce = %q, want the state nonce %q", query.Get("nonce"), state.Nonce)
+	}
+	if query.Get("state") == "" || query.Get("state") != state.State {
+		t.Fatalf("authorization URL state = %q, want %q", query.Get("state"), state.State)
+	}
+
+	for name, values := range params {
+		query[name] = values
+	}
+	authURL.RawQuery = query.Encode()
+
+	callbackURL := redirect(t, o.get(t, authURL.String()))
+	if callbackURL.Path != oidcCallbackPath("mock") {
+		t.Fatalf("provider redirected to %s, want the callback", callbackURL)
+	}
+
+	return callbackURL
+}
+
+// hasSessionCookie reports whether the response starts a session.
+func hasSessionCookie(resp *http.Response) bool {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == accessTokenCookie && cookie.Value != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestOIDCLoginRejectsInvalidRedirect(t *testing.T) {
+	o := newOIDCTest(t, nil)
+
+	for _, redirect := range []string{"https://evil.example", "//evil.example", "menus"} {
+		resp := o.get(t, o.app.URL+"/api/v1/auth/oidc/mock/login?redirect="+url.QueryEscape(redirect))
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("redirect %q: status = %d, want %d", redirect, resp.StatusCode, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestOIDCCallbackRejectsTamperedLogin(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, o *oidcTest, callbackURL *url.URL)
+	}{
+		{
+			name: "wrong PKCE verifier",
+			tamper: func(t *testing.T, o *oidcTest, _ *url.URL) {
+				state := o.state(t)
+				state.Verifier = oauth2.GenerateVerifier()
+				o.setState(t, state, testJWTSecret)
+			},
+		},
+		{
+			name: "wrong nonce",
+			tamper: func(t *testing.T, o *oidcTest, _ *url.URL) {
+				state := o.state(t)
+				state.Nonce = "other-nonce"
+				o.setState(t, state, testJWTSecret)
+			},
+		},
+		{
+			name: "wrong state",
+			tamper: func(t *testing.T, _ *oidcTest, callbackURL *url.URL) {
+				query := callbackURL.Query()
+				query.Set("state", "other-state")
+				callbackURL.RawQuery = query.Encode()
+			},
+		},
+		{
+			name: "state cookie signed with another key",
+			tamper: func(t *testing.T, o *oidcTest, _ *url.URL) {
+				o.setState(t, o.state(t), "other-secret")
+			},
+		},
+		{
+			name: "expired state cookie",
+			tamper: func(t *testing.T, o *oidcTest, _ *url.URL) {
+				state := o.state(t)
+				state.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				o.setState(t, state, testJWTSecret)
+			},
+		},
+		{
+			name: "no state cookie",
+			tamper: func(t *testing.T, o *oidcTest, _ *url.URL) {
+				o.client.Jar.SetCookies(o.callbackURL(t), []*http.Cookie{{Name: oidcStateCookie, Path: oidcCallbackPath("mock"), MaxAge: -1}})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOIDCTest(t, nil)
+
+			callbackURL := o.login(t, url.Values{"login_hint": {"jane@example.com"}})
+			tt.tamper(t, o, callbackURL)
+
+			resp := o.get(t, callbackURL.String())
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+			}
+			if hasSessionCookie(resp) {
+				t.Error("a session was started")
+			}
+		})
+	}
+}
+
+// testDB returns a transaction of the database of TEST_DATABASE_DSN that is rolled back
+// after the test, or skips the test when it is not set.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.AutoMigrate(&models.UserType{}, &models.User{}, &models.OAuthIdentity{}, &models.RecoveryCode{},
+		&models.Session{}, &models.RefreshToken{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+
+	if err := tx.FirstOrCreate(&models.UserType{ID: 1, Title: "User"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return tx
+}
+
+func TestOIDCCallbackLinksAccounts(t *testing.T) {
+	verifiedAt := time.Now().Add(-24 * time.Hour)
+
+	tests := []struct {
+		name string
+		// existing is the user registered with the email before the login, if any.
+		existing      *models.User
+		emailVerified bool
+		wantStatus    int
+		// wantLinked tells whether the login links the existing user rather than signing up.
+		wantLinked bool
+		// wantClaimed tells whether the existing user loses the password, the second factor and the sessions.
+		wantClaimed bool
+	}{
+		{
+			name:          "signs up with a verified email",
+			emailVerified: true,
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "links a verified account by a verified email",
+			existing:      &models.User{FirstName: "Jane", Email: "Jane@Example.com", Password: "hash", UserTypeID: 1, EmailVerifiedAt: &verifiedAt},
+			emailVerified: true,
+			wantStatus:    http.StatusOK,
+			wantLinked:    true,
+		},
+		{
+			name:          "claims an unverified account by a verified email",
+			existing:      &models.User{FirstName: "Jane", Email: "jane@example.com", Password: "hash", UserTypeID: 1, TOTPSecret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", TOTPEnabledAt: &verifiedAt},
+			emailVerified: true,
+			wantStatus:    http.StatusOK,
+			wantLinked:    true,
+			wantClaimed:   true,
+		},
+		{
+			name:       "rejects an unverified email",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "does not link a verified account by an unverified email",
+			existing:   &models.User{FirstName: "Jane", Email: "jane@example.com", Password: "hash", UserTypeID: 1, EmailVerifiedAt: &verifiedAt},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			o := newOIDCTest(t, db)
+
+			var session models.Session
+			if tt.existing != nil {
+				if err := db.Create(tt.existing).Error; err != nil {
+					t.Fatal(err)
+				}
+
+				session = models.Session{UserID: tt.existing.ID, ExpiresAt: time.Now().Add(time.Hour)}
+				if err := db.Create(&session).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			params := url.Values{"login_hint": {"jane@example.com"}}
+			if !tt.emailVerified {
+				params.Set("email_verified", "false")
+			}
+
+			resp := o.get(t, o.login(t, params).String())
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			var identity models.OAuthIdentity
+			err := db.Preload("User").First(&identity, "provider = ? AND subject = ?", "mock", "mock-jane@example.com").Error
+
+			if tt.wantStatus != http.StatusOK {
+				if err == nil {
+					t.Error("the provider account was linked")
+				}
+				if hasSessionCookie(resp) {
+					t.Error("a session was started")
+				}
+
+				var count int64
+				db.Model(&models.User{}).Where("LOWER(email) = ?", "jane@example.com").Count(&count)
+				if tt.existing == nil && count != 0 {
+					t.Error("a user was signed up")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("the provider account was not linked: %v", err)
+			}
+			if !hasSessionCookie(resp) {
+				t.Error("no session was started")
+			}
+
+			user := identity.User
+			if user.EmailVerifiedAt == nil {
+				t.Error("the email of the user is not verified")
+			}
+			if tt.existing == nil {
+				return
+			}
+
+			if (user.ID == tt.existing.ID) != tt.wantLinked {
+				t.Errorf("linked user %d, existing user %d", user.ID, tt.existing.ID)
+			}
+
+			if err := db.First(&session, session.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantClaimed {
+				if user.Password != "" || user.TOTPSecret != "" || user.TOTPEnabledAt != nil {
+					t.Error("the credentials of the unverified account were kept")
+				}
+				if session.RevokedAt == nil || session.RevokedReason != revokedOIDCLink {
+					t.Errorf("session revoked at %v for %q, want revoked for %q", session.RevokedAt, session.RevokedReason, revokedOIDCLink)
+				}
+			} else {
+				if user.Password != tt.existing.Password {
+					t.Error("the password of the verified account was changed")
+				}
+				if session.RevokedAt != nil {
+					t.Error("the session of the verified account was revoked")
+				}
+			}
+		})
+	}
+}
+
+func TestOIDCEmailLink(t *testing.T) {
+	verifiedAt := time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC)
+
+	verified := oidclogin.Identity{Provider: "mock", Subject: "1", Email: "jane@example.com", EmailVerified: true}
+	unverified := verified
+	unverified.EmailVerified = false
+	noEmail := verified
+	noEmail.Email = ""
+
+	tests := []struct {
+		name     string
+		identity oidclogin.Identity
+		found    *models.User
+		want     oidcLink
+		wantErr  bool
+	}{
+		{name: "new email", identity: verified, want: oidcSignUpUser},
+		{name: "verified account", identity: verified, found: &models.User{ID: 1, EmailVerifiedAt: &verifiedAt}, want: oidcLinkUser},
+		{name: "unverified account", identity: verified, found: &models.User{ID: 1}, want: oidcClaimUser},
+		{name: "unverified identity", identity: unverified, wantErr: true},
+		{name: "unverified identity with verified account", identity: unverified, found: &models.User{ID: 1, EmailVerifiedAt: &verifiedAt}, wantErr: true},
+		{name: "unverified identity with unverified account", identity: unverified, found: &models.User{ID: 1}, wantErr: true},
+		{name: "no email", identity: noEmail, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := oidcEmailLink(tt.identity, tt.found)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("oidcEmailLink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("oidcEmailLink() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewOIDCUser(t *testing.T) {
+	now := time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		identity      oidclogin.Identity
+		wantFirstName string
+		wantLastName  string
+	}{
+		{name: "named", identity: oidclogin.Identity{Email: "jane@example.com", GivenName: "Jane", FamilyName: "Doe"}, wantFirstName: "Jane", wantLastName: "Doe"},
+		{name: "unnamed", identity: oidclogin.Identity{Email: "jane.doe@example.com"}, wantFirstName: "jane.doe"},
+		{name: "mixed case email", identity: oidclogin.Identity{Email: "Jane.Doe@Example.com"}, wantFirstName: "Jane.Doe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newOIDCUser(tt.identity, now)
+
+			if user.FirstName != tt.wantFirstName || user.LastName != tt.wantLastName {
+				t.Errorf("name = %q %q, want %q %q", user.FirstName, user.LastName, tt.wantFirstName, tt.wantLastName)
+			}
+			if want := strings.ToLower(tt.identity.Email); user.Email != want {
+				t.Errorf("email = %q, want %q", user.Email, want)
+			}
+			if user.EmailVerifiedAt == nil || !user.EmailVerifiedAt.Equal(now) {
+				t.Errorf("email verified at %v, want %v", user.EmailVerifiedAt, now)
+			}
+			if user.UserTypeID != 1 {
+				t.Errorf("user type = %d, want 1", user.UserTypeID)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"strconv"
+)
+
+// errInvalidTransition is returned when an order or a reservation cannot move to the requested status.
+var errInvalidTransition = errors.New("invalid status transition")
+
+// GetOrders returns the orders placed by the current user.
+func (m *Repository) GetOrders(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	var orders []models.Order
+	err = m.App.DB.Preload("Items").Where("user_id = ?", userID).Order("created_at DESC").Find(&orders).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	m.translateOrders(r, orders)
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  orders,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// TrackOrder returns an order by its tracking token, so guests can follow it without logging in.
+func (m *Repository) TrackOrder(w http.ResponseWriter, r *http.Request) {
+	var order models.Order
+	err := m.App.DB.Preload("Items").First(&order, "tracking_token = ?", chi.URLParam(r, "tracking_token")).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("order not found"), http.StatusNotFound)
+		return
+	}
+
+	orders := []models.Order{order}
+	m.translateOrders(r, orders)
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  orders[0],
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CancelOrder lets the guest cancel their own order while it has not been accepted yet.
+func (m *Repository) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	orderID, err := strconv.Atoi(chi.URLParam(r, "order_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("order_id"), http.StatusBadRequest)
+		return
+	}
+
+	order, err := m.transitionOrder(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id = ? AND user_id = ?", orderID, userID)
+	}, models.OrderStatusCancelled, models.OrderStatusPlaced)
+	if err != nil {
+		m.writeTransitionError(w, r, err, "order not found")
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  order,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetRestaurantOrders returns the orders of a restaurant for its owner.
+// The `status` query parameter narrows the result.
+func (m *Repository) GetRestaurantOrders(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	if !m.isAdmin(userID) {
+		var restaurant models.Restaurant
+		if err := m.App.DB.First(&restaurant, "id = ? AND owner_id = ?", restaurantID, userID).Error; err != nil {
+			_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+			return
+		}
+	}
+
+	query := m.App.DB.Preload("Items").Where("restaurant_id = ?", restaurantID)
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var orders []models.Order
+	if err := query.Order("created_at DESC").Find(&orders).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  orders,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// AdvanceOrder moves an order of the restaurant to the status given in the URL.
+// Only the restaurant owner or an admin can do it, and only along valid transitions.
+func (m *Repository) AdvanceOrder(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
+		return
+	}
+
+	orderID, err := strconv.Atoi(chi.URLParam(r, "order_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("order_id"), http.StatusBadRequest)
+		return
+	}
+
+	if !m.isAdmin(userID) {
+		var restaurant models.Restaurant
+		if err := m.App.DB.First(&restaurant, "id = ? AND owner_id = ?", restaurantID, userID).Error; err != nil {
+			_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+			return
+		}
+	}
+
+	status := models.OrderStatus(chi.URLParam(r, "status"))
+
+	order, err := m.transitionOrder(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id = ? AND restaurant_id = ?", orderID, restaurantID)
+	}, status)
+	if err != nil {
+		m.writeTransitionError(w, r, err, "order not found")
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  order,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// transitionOrder locks the order matched by scope and moves it to the next status.
+// If from is given, the order must currently be in one of these statuses.
+func (m *Repository) transitionOrder(scope func(*gorm.DB) *gorm.DB, next models.OrderStatus, from ...models.OrderStatus) (models.Order, error) {
+	var order models.Order
+
+	err := m.App.DB.Transaction(func(tx *gorm.DB) error {
+		err := scope(tx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&order).Error
+		if err != nil {
+			return err
+		}
+
+		allowed := len(from) == 0
+		for _, status := range from {
+			if order.Status == status {
+				allowed = true
+			}
+		}
+
+		if !allowed || !order.Status.CanTransitionTo(next) {
+			return fmt.Errorf("%w: %s -> %s", errInvalidTransition, order.Status, next)
+		}
+
+		order.Status = next
+
+		return tx.Save(&order).Error
+	})
+	if err != nil {
+		return order, err
+	}
+
+	err = m.App.DB.Preload("Items").First(&order, order.ID).Error
+
+	return order, err
+}
+
+// writeTransitionError writes the error response matching a failed status transition.
+func (m *Repository) writeTransitionError(w http.ResponseWriter, r *http.Request, err error, notFound string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		_ = m.errorJSON(w, r, errors.New(notFound), http.StatusNotFound)
+	case errors.Is(err, errInvalidTransition):
+		_ = m.errorJSON(w, r, err, http.StatusConflict)
+	default:
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+	}
+}
@@ -9,7 +9,7 @@ import (
 func (m *Repository) Restaurants(w http.ResponseWriter, r *http.Request) {
 	err := render.Template(w, r, "restaurants.page.gohtml", &models.TemplateData{})
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
@@ -17,7 +17,15 @@ func (m *Repository) Restaurants(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) Restaurant(w http.ResponseWriter, r *http.Request) {
 	err := render.Template(w, r, "restaurant.page.gohtml", &models.TemplateData{})
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (m *Repository) ResetPasswordPage(w http.ResponseWriter, r *http.Request) {
+	err := render.Template(w, r, "reset-password.page.gohtml", &models.TemplateData{})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 }
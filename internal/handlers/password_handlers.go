@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/mailer"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// passwordResetTTL is how long a forgot-password link is valid.
+	passwordResetTTL = time.Hour
+	// minPasswordLength is the minimum length of a password.
+	minPasswordLength = 8
+
+	revokedPasswordReset  = "password_reset"
+	revokedPasswordChange = "password_change"
+)
+
+// forgotPasswordBody is the forgot password request body structure.
+type forgotPasswordBody struct {
+	Email string `json:"email"`
+}
+
+// resetPasswordBody is the reset password request body structure.
+type resetPasswordBody struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// changePasswordBody is the change password request body structure.
+type changePasswordBody struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// ForgotPassword emails a password reset link to the user with the address. The response is the same
+// whether or not such a user exists, so that it does not tell which addresses have accounts: the email
+// is sent in the background so that it does not take longer either. The requests are limited per address
+// and per client IP address.
+func (m *Repository) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var body forgotPasswordBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding forgot password data"), http.StatusBadRequest)
+		return
+	}
+
+	body.Email = strings.TrimSpace(body.Email)
+
+	if !validateEmail(body.Email) {
+		_ = m.errorJSON(w, r, apierror.Field("email", apierror.Invalid, "invalid email"), http.StatusBadRequest)
+		return
+	}
+
+	keys := passwordResetLockKeys(r, body.Email)
+
+	until, err := m.loginLockedUntil(keys)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !until.IsZero() {
+		m.writeLocked(w, r, until, "too many password reset requests")
+		return
+	}
+
+	// Every request counts, whether or not the address has an account
+	if err := m.recordLoginFailure(keys); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	user, err := userByEmail(m.App.DB, body.Email)
+	if err == nil {
+		go func() {
+			logMailError(m.sendPasswordResetEmail(user), user)
+		}()
+	} else if errors.Is(err, errEmailAmbiguous) {
+		// Which of the accounts the link would reset cannot be told, so none is
+		log.Printf("error sending password reset email: %v", err)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "if an account with this email exists, a password reset link has been sent to it",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ResetPassword sets a new password with the token of a forgot-password link
+// and revokes all sessions of the user.
+func (m *Repository) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var body resetPasswordBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding reset password data"), http.StatusBadRequest)
+		return
+	}
+
+	if len(body.Password) < minPasswordLength {
+		_ = m.errorJSON(w, r, apierror.Field("password", apierror.Invalid, fmt.Sprintf("password must be at least %d characters long", minPasswordLength)), http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), 10)
+	if err != nil {
+		_ = m.errorJSON(w, r, fmt.Errorf("error hashing password: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var resetToken models.PasswordResetToken
+		err := tx.Preload("User").First(&resetToken, "token_hash = ?", hashToken(body.Token)).Error
+		if err != nil || resetToken.UsedAt != nil || now.After(resetToken.ExpiresAt) {
+			return apierror.New(apierror.BadRequest, "the link is invalid or has expired")
+		}
+
+		// Using the token voids the other links sent to the user as well
+		err = tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", resetToken.UserID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]any{"password": string(hashedPassword)}
+		// Following the link proves the user can read the emails sent to the address
+		if resetToken.User.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = now
+		}
+		if err := tx.Model(&resetToken.User).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// The new password ends a lockout of the account
+		err = tx.Where("kind = ? AND key = ?", models.LoginLockAccount, normalizeEmail(resetToken.User.Email)).
+			Delete(&models.LoginLock{}).Error
+		if err != nil {
+			return err
+		}
+
+		_, err = revokeUserSessions(tx, resetToken.UserID, 0, revokedPasswordReset)
+		return err
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	clearAuthCookies(w)
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "password reset, log in with the new password",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ChangePassword changes the password of the current user, who must provide the current one.
+// All sessions of the user are revoked and the request gets a new session.
+func (m *Repository) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body changePasswordBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding change password data"), http.StatusBadRequest)
+		return
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.CurrentPassword))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.Field("currentPassword", apierror.Invalid, "invalid password"), http.StatusBadRequest)
+		return
+	}
+
+	if len(body.NewPassword) < minPasswordLength {
+		_ = m.errorJSON(w, r, apierror.Field("newPassword", apierror.Invalid, fmt.Sprintf("password must be at least %d characters long", minPasswordLength)), http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+	if err != nil {
+		_ = m.errorJSON(w, r, fmt.Errorf("error hashing password: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+
+		_, err := revokeUserSessions(tx, user.ID, 0, revokedPasswordChange)
+		return err
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = m.startSession(w, r, user.ID)
+	if err != nil {
+		clearAuthCookies(w)
+		_ = m.errorJSON(w, r, fmt.Errorf("password changed, but failed to start a new session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "password changed, other sessions were logged out",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// confirmPassword checks the password that confirms a sensitive request of the user. Users who only sign
+// in with an OIDC provider have no password: with two-factor authentication on, the second factor, which
+// the caller must verify, confirms the request instead, and without it they have to set a password first.
+func confirmPassword(user models.User, password string) error {
+	if user.Password == "" {
+		if user.TOTPEnabledAt != nil {
+			return nil
+		}
+
+		return apierror.Field("password", apierror.Invalid, "the account has no password, set one with forgot password first")
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return apierror.Field("password", apierror.Invalid, "invalid password")
+	}
+
+	return nil
+}
+
+// sendPasswordResetEmail stores a new password reset token of the user and emails its link.
+func (m *Repository) sendPasswordResetEmail(user models.User) error {
+	value, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	resetToken := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(value),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	if err := m.App.DB.Create(&resetToken).Error; err != nil {
+		return err
+	}
+
+	link := m.appURL("/reset-password?token=" + url.QueryEscape(value))
+
+	return m.App.Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Hi %s,\n\nset a new Peparesu password by opening this link:\n\n%s\n\n"+
+			"The link can be used once within %d minutes. If you did not ask to reset the password, ignore this email.\n",
+			user.FirstName, link, int(passwordResetTTL.Minutes())),
+	})
+}
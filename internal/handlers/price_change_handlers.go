@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// priceChangeReportRow is a single price change in the restaurant report.
+type priceChangeReportRow struct {
+	ID            uint
+	MenuID        uint
+	MenuTitle     string
+	MenuItemID    uint
+	MenuItemTitle string
+	OldPriceUAH   uint
+	NewPriceUAH   uint
+	ChangedByID   *uint
+	CreatedAt     time.Time
+}
+
+// GetPriceHistory returns the price changes of a menu item, newest first.
+func (m *Repository) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	menuID, err := strconv.Atoi(chi.URLParam(r, "menu_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_id"))
+		return
+	}
+
+	menuItemID, err := strconv.Atoi(chi.URLParam(r, "menu_item_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("menu_item_id"))
+		return
+	}
+
+	var menuItem models.MenuItem
+	err = m.App.DB.Joins("JOIN menus ON menus.id = menu_items.menu_id").
+		First(&menuItem, "menu_items.id = ? AND menu_items.menu_id = ? AND menus.restaurant_id = ?", menuItemID, menuID, restaurantID).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("menu item not found"), http.StatusNotFound)
+		return
+	}
+
+	var changes []models.PriceChange
+	err = m.App.DB.Where("menu_item_id = ?", menuItem.ID).Order("created_at DESC").Find(&changes).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  changes,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetPriceChangesReport returns the price changes of all menu items of a restaurant over a date range.
+// The `from` and `to` query parameters (YYYY-MM-DD, inclusive) default to the last 30 days.
+func (m *Repository) GetPriceChangesReport(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, err := priceReportRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	var rows []priceChangeReportRow
+	err = m.App.DB.Model(&models.PriceChange{}).
+		Select("price_changes.id, menus.id AS menu_id, menus.title AS menu_title, "+
+			"menu_items.id AS menu_item_id, menu_items.title AS menu_item_title, "+
+			"price_changes.old_price_uah, price_changes.new_price_uah, price_changes.changed_by_id, price_changes.created_at").
+		Joins("JOIN menu_items ON menu_items.id = price_changes.menu_item_id").
+		Joins("JOIN menus ON menus.id = menu_items.menu_id").
+		Where("price_changes.restaurant_id = ? AND price_changes.created_at >= ? AND price_changes.created_at < ?",
+			restaurantID, from, to.AddDate(0, 0, 1)).
+		Order("price_changes.created_at").
+		Scan(&rows).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  rows,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// priceReportRange parses the inclusive `from` and `to` dates (YYYY-MM-DD) of the price changes report.
+// A missing `to` is today and a missing `from` is 30 days before `to`.
+func priceReportRange(fromValue, toValue string, now time.Time) (time.Time, time.Time, error) {
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	var err error
+	if toValue != "" {
+		to, err = time.ParseInLocation("2006-01-02", toValue, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid to date, expected YYYY-MM-DD")
+		}
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if fromValue != "" {
+		from, err = time.ParseInLocation("2006-01-02", fromValue, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("invalid from date, expected YYYY-MM-DD")
+		}
+	}
+
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("the from date must not be after the to date")
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriceReportRange(t *testing.T) {
+	now := time.Date(2024, 5, 10, 15, 30, 0, 0, time.Local)
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{name: "last 30 days", wantFrom: day(2024, 4, 10), wantTo: day(2024, 5, 10)},
+		{name: "from only", from: "2024-05-01", wantFrom: day(2024, 5, 1), wantTo: day(2024, 5, 10)},
+		{name: "to only", to: "2024-03-31", wantFrom: day(2024, 3, 1), wantTo: day(2024, 3, 31)},
+		{name: "single day", from: "2024-02-29", to: "2024-02-29", wantFrom: day(2024, 2, 29), wantTo: day(2024, 2, 29)},
+		{name: "from after to", from: "2024-05-02", to: "2024-05-01", wantErr: true},
+		{name: "invalid from", from: "01.05.2024", wantErr: true},
+		{name: "invalid to", to: "2024-13-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := priceReportRange(tt.from, tt.to, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("priceReportRange = %v, %v, want an error", from, to)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("priceReportRange: %v", err)
+			}
+
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Errorf("priceReportRange = %v, %v, want %v, %v", from, to, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
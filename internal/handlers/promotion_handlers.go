@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// promotionBody is the promotion request body structure.
+// Dates are YYYY-MM-DD, times are HH:MM and weekdays are 0 (Sunday) to 6.
+type promotionBody struct {
+	Title       string               `json:"title"`
+	Kind        models.PromotionKind `json:"kind"`
+	Value       uint                 `json:"value"`
+	MenuIDs     []uint               `json:"menuIds"`
+	MenuItemIDs []uint               `json:"menuItemIds"`
+	StartsOn    string               `json:"startsOn"`
+	EndsOn      string               `json:"endsOn"`
+	Weekdays    []uint               `json:"weekdays"`
+	TimeFrom    string               `json:"timeFrom"`
+	TimeTo      string               `json:"timeTo"`
+	Active      *bool                `json:"active"`
+}
+
+// GetPromotions returns the promotions of a restaurant.
+func (m *Repository) GetPromotions(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	var promotions []models.Promotion
+	err = m.App.DB.Preload("Menus").Preload("MenuItems").
+		Where("restaurant_id = ?", restaurantID).Order("id").Find(&promotions).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	var menus []*models.Menu
+	var menuItems []*models.MenuItem
+	for i := range promotions {
+		for j := range promotions[i].Menus {
+			menus = append(menus, &promotions[i].Menus[j])
+		}
+		for j := range promotions[i].MenuItems {
+			menuItems = append(menuItems, &promotions[i].MenuItems[j])
+		}
+	}
+
+	m.translateMenuRefs(r, menus)
+	m.translateMenuItemRefs(r, menuItems)
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  promotions,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreatePromotion handles the promotion creation request.
+func (m *Repository) CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	var body promotionBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding promotion data"), http.StatusBadRequest)
+		return
+	}
+
+	promotion := models.Promotion{RestaurantID: restaurantID}
+	if err := m.fillPromotion(&promotion, body); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := m.App.DB.Create(&promotion).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  promotion,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// UpdatePromotion handles the promotion update request.
+func (m *Repository) UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, ok := m.managedPromotion(w, r)
+	if !ok {
+		return
+	}
+
+	var body promotionBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding promotion data"), http.StatusBadRequest)
+		return
+	}
+
+	if err := m.fillPromotion(&promotion, body); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Menus", "MenuItems").Save(&promotion).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&promotion).Association("Menus").Replace(promotion.Menus); err != nil {
+			return err
+		}
+
+		return tx.Model(&promotion).Association("MenuItems").Replace(promotion.MenuItems)
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  promotion,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeletePromotion handles the promotion deletion request.
+func (m *Repository) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	promotion, ok := m.managedPromotion(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.App.DB.Select("Menus", "MenuItems").Delete(&promotion).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "promotion deleted successfully",
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// PreviewPromotions shows which promotions of a restaurant are active at the time given in the `at`
+// query parameter (RFC 3339, defaults to now) and the resulting prices of the discounted menu items.
+func (m *Repository) PreviewPromotions(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid time, expected RFC 3339", apierror.FieldError{Field: "at", Reason: apierror.Invalid}))
+			return
+		}
+		at = at.In(time.Local)
+	}
+
+	promotions, err := m.activePromotions(restaurantID, at)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	var menuItems []models.MenuItem
+	err = m.App.DB.Where("menu_id IN (SELECT id FROM menus WHERE restaurant_id = ?)", restaurantID).
+		Order("menu_id").Order("id").Find(&menuItems).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	applyPromotions(promotions, menuItems)
+
+	discounted := []models.MenuItem{}
+	for _, menuItem := range menuItems {
+		if menuItem.PromotionID != nil {
+			discounted = append(discounted, menuItem)
+		}
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]any{
+			"at":         at,
+			"promotions": promotions,
+			"menuItems":  discounted,
+		},
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// fillPromotion validates the promotion body and copies it into the promotion.
+func (m *Repository) fillPromotion(promotion *models.Promotion, body promotionBody) error {
+	if body.Title == "" {
+		return apierror.Field("title", apierror.Required, "title cannot be empty")
+	}
+
+	switch body.Kind {
+	case models.PromotionPercentage:
+		if body.Value == 0 || body.Value > 100 {
+			return errors.New("percentage must be between 1 and 100")
+		}
+	case models.PromotionFixed:
+		if body.Value == 0 {
+			return errors.New("fixed discount must be positive")
+		}
+	default:
+		return apierror.New(apierror.InvalidParameter, "invalid kind, expected 'percentage' or 'fixed'", apierror.FieldError{Field: "kind", Reason: apierror.Invalid})
+	}
+
+	startsOn, err := parseOptionalDate(body.StartsOn)
+	if err != nil {
+		return err
+	}
+
+	endsOn, err := parseOptionalDate(body.EndsOn)
+	if err != nil {
+		return err
+	}
+
+	if startsOn != nil && endsOn != nil && endsOn.Before(*startsOn) {
+		return errors.New("the promotion cannot end before it starts")
+	}
+
+	var weekdays uint
+	for _, weekday := range body.Weekdays {
+		if weekday > 6 {
+			return apierror.Field("weekdays", apierror.OutOfRange, "invalid weekday, expected 0 (Sunday) to 6")
+		}
+		weekdays |= 1 << weekday
+	}
+
+	timeFrom, err := parseClock(body.TimeFrom)
+	if err != nil {
+		return err
+	}
+
+	timeTo, err := parseClock(body.TimeTo)
+	if err != nil {
+		return err
+	}
+
+	var menus []models.Menu
+	if len(body.MenuIDs) > 0 {
+		err := m.App.DB.Where("id IN ? AND restaurant_id = ?", body.MenuIDs, promotion.RestaurantID).Find(&menus).Error
+		if err != nil {
+			return err
+		}
+		if len(menus) != len(uniqueIDs(body.MenuIDs)) {
+			return errors.New("referenced menus not found in this restaurant")
+		}
+	}
+
+	menuItems, err := m.findRestaurantMenuItems(promotion.RestaurantID, body.MenuItemIDs)
+	if err != nil {
+		return err
+	}
+
+	promotion.Title = body.Title
+	promotion.Kind = body.Kind
+	promotion.Value = body.Value
+	promotion.Menus = menus
+	promotion.MenuItems = menuItems
+	promotion.StartsOn = startsOn
+	promotion.EndsOn = endsOn
+	promotion.Weekdays = weekdays
+	promotion.TimeFrom = timeFrom
+	promotion.TimeTo = timeTo
+	promotion.Active = body.Active == nil || *body.Active
+
+	return nil
+}
+
+// managedPromotion loads the promotion from the URL if the current user can manage its restaurant.
+// It writes the error response and returns false if the promotion cannot be used.
+func (m *Repository) managedPromotion(w http.ResponseWriter, r *http.Request) (models.Promotion, bool) {
+	var promotion models.Promotion
+
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return promotion, false
+	}
+
+	promotionID, err := strconv.Atoi(chi.URLParam(r, "promotion_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("promotion_id"), http.StatusBadRequest)
+		return promotion, false
+	}
+
+	if err := m.App.DB.First(&promotion, "id = ? AND restaurant_id = ?", promotionID, restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("promotion not found"), http.StatusNotFound)
+		return promotion, false
+	}
+
+	return promotion, true
+}
+
+// activePromotions returns the promotions of the restaurant that are in effect at the given time.
+func (m *Repository) activePromotions(restaurantID uint, at time.Time) ([]models.Promotion, error) {
+	var promotions []models.Promotion
+	err := m.App.DB.Preload("Menus").Preload("MenuItems").
+		Where("restaurant_id = ? AND active = ?", restaurantID, true).Order("id").Find(&promotions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	active := []models.Promotion{}
+	for _, promotion := range promotions {
+		if promotion.ActiveAt(at) {
+			active = append(active, promotion)
+		}
+	}
+
+	return active, nil
+}
+
+// applyPromotions sets the effective price of each menu item to the lowest price any of
+// the promotions gives it. Promotions do not stack.
+func applyPromotions(promotions []models.Promotion, menuItems []models.MenuItem) {
+	for i := range menuItems {
+		effectivePrice := menuItems[i].PriceUAH
+		menuItems[i].PromotionID = nil
+
+		for _, promotion := range promotions {
+			if !promotion.AppliesTo(menuItems[i]) {
+				continue
+			}
+
+			if price := promotion.Apply(menuItems[i].PriceUAH); price < effectivePrice {
+				promotionID := promotion.ID
+				effectivePrice = price
+				menuItems[i].PromotionID = &promotionID
+			}
+		}
+
+		menuItems[i].EffectivePriceUAH = &effectivePrice
+	}
+}
+
+// priceMenuItems sets the effective prices of the restaurant menu items at the current time.
+func (m *Repository) priceMenuItems(restaurantID uint, menuItems []models.MenuItem) error {
+	promotions, err := m.activePromotions(restaurantID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	applyPromotions(promotions, menuItems)
+
+	return nil
+}
+
+// priceMenuItemRefs sets the effective prices of menu items of any restaurants at the current time.
+func (m *Repository) priceMenuItemRefs(menuItems []*models.MenuItem) error {
+	if len(menuItems) == 0 {
+		return nil
+	}
+
+	menuIDs := make([]uint, 0, len(menuItems))
+	for _, menuItem := range menuItems {
+		menuIDs = append(menuIDs, menuItem.MenuID)
+	}
+
+	var menus []models.Menu
+	if err := m.App.DB.Select("id", "restaurant_id").Find(&menus, "id IN ?", uniqueIDs(menuIDs)).Error; err != nil {
+		return err
+	}
+
+	restaurantIDs := make(map[uint]uint, len(menus))
+	for _, menu := range menus {
+		restaurantIDs[menu.ID] = menu.RestaurantID
+	}
+
+	byRestaurant := map[uint][]*models.MenuItem{}
+	for _, menuItem := range menuItems {
+		restaurantID := restaurantIDs[menuItem.MenuID]
+		byRestaurant[restaurantID] = append(byRestaurant[restaurantID], menuItem)
+	}
+
+	for restaurantID, refs := range byRestaurant {
+		priced := make([]models.MenuItem, len(refs))
+		for i, ref := range refs {
+			priced[i] = *ref
+		}
+
+		if err := m.priceMenuItems(restaurantID, priced); err != nil {
+			return err
+		}
+
+		for i, ref := range refs {
+			ref.EffectivePriceUAH = priced[i].EffectivePriceUAH
+			ref.PromotionID = priced[i].PromotionID
+		}
+	}
+
+	return nil
+}
+
+// parseOptionalDate parses a YYYY-MM-DD date, returning nil for an empty string.
+func parseOptionalDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+
+	return &date, nil
+}
+
+// parseClock parses an HH:MM time into minutes since midnight. An empty string is midnight.
+func parseClock(value string) (uint, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+
+	return uint(clock.Hour()*60 + clock.Minute()), nil
+}
+
+// uniqueIDs returns the IDs without duplicates, keeping their order.
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
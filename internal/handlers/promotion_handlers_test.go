@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyPromotions(t *testing.T) {
+	promotions := []models.Promotion{
+		{ID: 1, Kind: models.PromotionPercentage, Value: 10},
+		{ID: 2, Kind: models.PromotionFixed, Value: 50, Menus: []models.Menu{{ID: 2}}},
+	}
+
+	menuItems := []models.MenuItem{
+		{ID: 1, MenuID: 1, PriceUAH: 200},
+		{ID: 2, MenuID: 2, PriceUAH: 200},
+		{ID: 3, MenuID: 2, PriceUAH: 1000},
+	}
+
+	applyPromotions(promotions, menuItems)
+
+	want := []struct {
+		price       uint
+		promotionID uint
+	}{
+		{price: 180, promotionID: 1},
+		{price: 150, promotionID: 2},
+		{price: 900, promotionID: 1},
+	}
+
+	for i, menuItem := range menuItems {
+		if menuItem.EffectivePriceUAH == nil || *menuItem.EffectivePriceUAH != want[i].price {
+			t.Errorf("menu item %d effective price = %v, want %d", menuItem.ID, menuItem.EffectivePriceUAH, want[i].price)
+		}
+		if menuItem.PromotionID == nil || *menuItem.PromotionID != want[i].promotionID {
+			t.Errorf("menu item %d promotion = %v, want %d", menuItem.ID, menuItem.PromotionID, want[i].promotionID)
+		}
+	}
+}
+
+func TestApplyPromotionsWithoutDiscount(t *testing.T) {
+	stalePromotionID := uint(7)
+	menuItems := []models.MenuItem{{ID: 1, MenuID: 1, PriceUAH: 200, PromotionID: &stalePromotionID}}
+
+	applyPromotions([]models.Promotion{{ID: 1, Kind: models.PromotionFixed, Value: 50, Menus: []models.Menu{{ID: 2}}}}, menuItems)
+
+	if menuItems[0].EffectivePriceUAH == nil || *menuItems[0].EffectivePriceUAH != 200 {
+		t.Errorf("effective price = %v, want 200", menuItems[0].EffectivePriceUAH)
+	}
+	if menuItems[0].PromotionID != nil {
+		t.Errorf("promotion = %d, want none", *menuItems[0].PromotionID)
+	}
+}
+
+func TestParseOptionalDate(t *testing.T) {
+	date, err := parseOptionalDate("")
+	if date != nil || err != nil {
+		t.Errorf("parseOptionalDate(\"\") = %v, %v, want nil, nil", date, err)
+	}
+
+	date, err = parseOptionalDate("2024-02-29")
+	if err != nil || !date.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("parseOptionalDate(2024-02-29) = %v, %v", date, err)
+	}
+
+	for _, value := range []string{"2023-02-29", "29.02.2024", "2024-02-29T00:00:00Z"} {
+		if _, err := parseOptionalDate(value); err == nil {
+			t.Errorf("parseOptionalDate(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "00:00", want: 0},
+		{value: "09:30", want: 570},
+		{value: "23:59", want: 1439},
+		{value: "24:00", wantErr: true},
+		{value: "9:30", want: 570},
+		{value: "noon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseClock(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseClock(%q) = %d, want an error", tt.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseClock(%q) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestUniqueIDs(t *testing.T) {
+	got := uniqueIDs([]uint{3, 1, 3, 2, 1})
+	if want := []uint{3, 1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueIDs = %v, want %v", got, want)
+	}
+}
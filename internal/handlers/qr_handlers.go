@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/qr"
+	"github.com/vladyslavpavlenko/peparesu/internal/render"
+	"html/template"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultQRSize = 512
+	minQRSize     = 128
+	maxQRSize     = 2048
+)
+
+// tableTent is a single table tent on the printable sheet.
+type tableTent struct {
+	Title string
+	Seats uint
+	URL   string
+	QR    template.URL
+}
+
+// GetRestaurantQR renders a QR code linking to the restaurant page.
+// The `format` query parameter selects png (default) or svg, and `size` the size in pixels.
+func (m *Repository) GetRestaurantQR(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	var restaurant models.Restaurant
+	if err := m.App.DB.First(&restaurant, "id = ?", restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
+		return
+	}
+
+	m.writeQR(w, r, m.restaurantPageURL(restaurant.ID, ""), fmt.Sprintf("restaurant-%d", restaurant.ID))
+}
+
+// GetTableQR renders a QR code linking to the restaurant page of a specific table.
+// The link carries the table token, so only the restaurant owner can get it.
+func (m *Repository) GetTableQR(w http.ResponseWriter, r *http.Request) {
+	table, ok := m.managedTable(w, r)
+	if !ok {
+		return
+	}
+
+	m.writeQR(w, r, m.restaurantPageURL(table.RestaurantID, table.Token), fmt.Sprintf("restaurant-%d-table-%d", table.RestaurantID, table.ID))
+}
+
+// GetTableTents renders a printable sheet of table tents with QR codes for all tables of a restaurant.
+func (m *Repository) GetTableTents(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	if !m.canManageRestaurant(userID, restaurantID) {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+		return
+	}
+
+	var restaurant models.Restaurant
+	if err := m.App.DB.First(&restaurant, "id = ?", restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
+		return
+	}
+
+	// Guests read the tents, so they are printed in the language asked for
+	restaurants := []models.Restaurant{restaurant}
+	m.translateRestaurants(r, restaurants)
+	restaurant = restaurants[0]
+
+	var tables []models.Table
+	if err := m.App.DB.Where("restaurant_id = ?", restaurantID).Order("id").Find(&tables).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	tents := make([]tableTent, 0, len(tables))
+	for i := range tables {
+		url := m.restaurantPageURL(restaurant.ID, tables[i].Token)
+		png, err := qr.PNG(url, defaultQRSize)
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		tents = append(tents, tableTent{
+			Title: tables[i].Title,
+			Seats: tables[i].Seats,
+			URL:   url,
+			QR:    template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)),
+		})
+	}
+
+	err = render.Template(w, r, "table-tents.page.gohtml", &models.TemplateData{
+		Data: map[string]any{
+			"restaurant": restaurant,
+			"tents":      tents,
+		},
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+}
+
+// writeQR writes the QR code of the content in the requested format and size.
+func (m *Repository) writeQR(w http.ResponseWriter, r *http.Request, content, filename string) {
+	size := defaultQRSize
+	if value := r.URL.Query().Get("size"); value != "" {
+		var err error
+		size, err = strconv.Atoi(value)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			_ = m.errorJSON(w, r, fmt.Errorf("invalid size, expected %d to %d pixels", minQRSize, maxQRSize))
+			return
+		}
+	}
+
+	var (
+		out         []byte
+		err         error
+		contentType string
+	)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "png":
+		out, err = qr.PNG(content, size)
+		contentType = "image/png"
+		filename += ".png"
+	case "svg":
+		out, err = qr.SVG(content, size)
+		contentType = "image/svg+xml"
+		filename += ".svg"
+	default:
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid format, expected 'png' or 'svg'", apierror.FieldError{Field: "format", Reason: apierror.Invalid}))
+		return
+	}
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(out)
+}
+
+// restaurantPageURL returns the public URL of the restaurant page, optionally bound to a table.
+func (m *Repository) restaurantPageURL(restaurantID uint, tableToken string) string {
+	url := m.appURL(fmt.Sprintf("/restaurants/%d", restaurantID))
+	if tableToken != "" {
+		url += "?table=" + tableToken
+	}
+
+	return url
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"github.com/vladyslavpavlenko/peparesu/config"
+	"testing"
+)
+
+func TestRestaurantPageURL(t *testing.T) {
+	m := &Repository{App: &config.AppConfig{Env: &config.EnvVariables{AppURL: "https://peparesu.test/"}}}
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{name: "restaurant", want: "https://peparesu.test/restaurants/7"},
+		{name: "table", token: "abc", want: "https://peparesu.test/restaurants/7?table=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.restaurantPageURL(7, tt.token); got != tt.want {
+				t.Errorf("restaurantPageURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
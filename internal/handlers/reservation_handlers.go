@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// reservationDuration is how long a table stays booked for a single reservation.
+	reservationDuration = 2 * time.Hour
+	// reservationSlotStep is the interval between the bookable time slots.
+	reservationSlotStep = 30 * time.Minute
+)
+
+// activeReservationStatuses are the statuses that keep a table booked.
+var activeReservationStatuses = []models.ReservationStatus{
+	models.ReservationStatusPending,
+	models.ReservationStatusConfirmed,
+}
+
+// errNoFreeTable is returned when no table can take the reservation.
+var errNoFreeTable = errors.New("no free table for this time slot and party size")
+
+// reservationBody is the reservation request body structure.
+type reservationBody struct {
+	StartsAt  time.Time `json:"startsAt"`
+	PartySize uint      `json:"partySize"`
+	GuestName string    `json:"guestName"`
+	Phone     string    `json:"phone"`
+	TableID   *uint     `json:"tableId"`
+}
+
+// reservationSlot is a bookable time slot with the tables still free in it.
+type reservationSlot struct {
+	StartsAt   time.Time
+	EndsAt     time.Time
+	FreeTables []uint
+}
+
+// GetReservationSlots returns the time slots of a day with the tables that are free for the party size.
+// It expects the `date` (YYYY-MM-DD) and `party_size` query parameters.
+func (m *Repository) GetReservationSlots(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", r.URL.Query().Get("date"), time.Local)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid date, expected YYYY-MM-DD", apierror.FieldError{Field: "date", Reason: apierror.Invalid}))
+		return
+	}
+
+	partySize, err := strconv.Atoi(r.URL.Query().Get("party_size"))
+	if err != nil || partySize < 1 {
+		_ = m.errorJSON(w, r, errors.New("invalid party size"))
+		return
+	}
+
+	slots, err := m.reservationSlots(m.App.DB, uint(restaurantID), date, uint(partySize))
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  slots,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateReservation books a table in the restaurant. If no table is given, the smallest
+// free table that fits the party is picked. Concurrent bookings of the same tables are
+// serialized, so a table is never booked twice for overlapping slots.
+func (m *Repository) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	var body reservationBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding reservation data"), http.StatusBadRequest)
+		return
+	}
+
+	if body.PartySize == 0 {
+		_ = m.errorJSON(w, r, errors.New("party size must be positive"), http.StatusBadRequest)
+		return
+	}
+
+	startsAt := body.StartsAt.In(time.Local)
+	if startsAt.Before(time.Now()) {
+		_ = m.errorJSON(w, r, errors.New("reservation must be in the future"), http.StatusBadRequest)
+		return
+	}
+
+	if body.GuestName == "" {
+		var user models.User
+		if err := m.App.DB.First(&user, "id = ?", userID).Error; err == nil {
+			body.GuestName = fmt.Sprintf("%s %s", user.FirstName, user.LastName)
+		}
+	}
+
+	reservation := models.Reservation{
+		RestaurantID: uint(restaurantID),
+		UserID:       userID,
+		GuestName:    body.GuestName,
+		Phone:        body.Phone,
+		PartySize:    body.PartySize,
+		StartsAt:     startsAt,
+		EndsAt:       startsAt.Add(reservationDuration),
+		Status:       models.ReservationStatusPending,
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("restaurant_id = ? AND seats >= ?", restaurantID, body.PartySize)
+		if body.TableID != nil {
+			query = query.Where("id = ?", *body.TableID)
+		}
+
+		var tables []models.Table
+		if err := query.Order("seats").Order("id").Find(&tables).Error; err != nil {
+			return err
+		}
+
+		slots, err := m.reservationSlots(tx, uint(restaurantID), startsAt, body.PartySize)
+		if err != nil {
+			return err
+		}
+
+		for _, slot := range slots {
+			if !slot.StartsAt.Equal(startsAt) {
+				continue
+			}
+
+			free := make(map[uint]bool, len(slot.FreeTables))
+			for _, id := range slot.FreeTables {
+				free[id] = true
+			}
+
+			for _, table := range tables {
+				if free[table.ID] {
+					reservation.TableID = table.ID
+					return tx.Create(&reservation).Error
+				}
+			}
+		}
+
+		return errNoFreeTable
+	})
+	if errors.Is(err, errNoFreeTable) {
+		_ = m.errorJSON(w, r, err, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  reservation,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// GetReservations returns the reservations made by the current user.
+func (m *Repository) GetReservations(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	var reservations []models.Reservation
+	err = m.App.DB.Where("user_id = ?", userID).Order("starts_at DESC").Find(&reservations).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  reservations,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CancelReservation lets the guest cancel their own reservation.
+func (m *Repository) CancelReservation(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	reservationID, err := strconv.Atoi(chi.URLParam(r, "reservation_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("reservation_id"), http.StatusBadRequest)
+		return
+	}
+
+	reservation, err := m.transitionReservation(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id = ? AND user_id = ?", reservationID, userID)
+	}, models.ReservationStatusCancelled)
+	if err != nil {
+		m.writeTransitionError(w, r, err, "reservation not found")
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  reservation,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetRestaurantReservations returns the owner view of the reservations of a restaurant on a day.
+// The `date` query parameter (YYYY-MM-DD) defaults to today.
+func (m *Repository) GetRestaurantReservations(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	if !m.canManageRestaurant(userID, restaurantID) {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+		return
+	}
+
+	day := time.Now()
+	if date := r.URL.Query().Get("date"); date != "" {
+		day, err = time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid date, expected YYYY-MM-DD", apierror.FieldError{Field: "date", Reason: apierror.Invalid}))
+			return
+		}
+	}
+
+	dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+
+	var reservations []models.Reservation
+	err = m.App.DB.Where("restaurant_id = ? AND starts_at >= ? AND starts_at < ?",
+		restaurantID, dayStart, dayStart.AddDate(0, 0, 1)).Order("starts_at").Order("table_id").Find(&reservations).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  reservations,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// UpdateReservationStatus moves a reservation of the restaurant to the status given in the URL:
+// confirmed, cancelled or no_show.
+func (m *Repository) UpdateReservationStatus(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
+		return
+	}
+
+	reservationID, err := strconv.Atoi(chi.URLParam(r, "reservation_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("reservation_id"), http.StatusBadRequest)
+		return
+	}
+
+	if !m.canManageRestaurant(userID, restaurantID) {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+		return
+	}
+
+	status := models.ReservationStatus(chi.URLParam(r, "status"))
+
+	reservation, err := m.transitionReservation(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("id = ? AND restaurant_id = ?", reservationID, restaurantID)
+	}, status)
+	if err != nil {
+		m.writeTransitionError(w, r, err, "reservation not found")
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  reservation,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// transitionReservation locks the reservation matched by scope and moves it to the next status.
+func (m *Repository) transitionReservation(scope func(*gorm.DB) *gorm.DB, next models.ReservationStatus) (models.Reservation, error) {
+	var reservation models.Reservation
+
+	err := m.App.DB.Transaction(func(tx *gorm.DB) error {
+		err := scope(tx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&reservation).Error
+		if err != nil {
+			return err
+		}
+
+		if !reservation.Status.CanTransitionTo(next) {
+			return fmt.Errorf("%w: %s -> %s", errInvalidTransition, reservation.Status, next)
+		}
+
+		reservation.Status = next
+
+		return tx.Save(&reservation).Error
+	})
+
+	return reservation, err
+}
+
+// reservationSlots derives the bookable slots of the day from the opening hours of the restaurant
+// and lists, for each slot, the tables fitting the party size that have no overlapping active reservation.
+func (m *Repository) reservationSlots(db *gorm.DB, restaurantID uint, day time.Time, partySize uint) ([]reservationSlot, error) {
+	dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	slots := []reservationSlot{}
+
+	var hours models.OpeningHours
+	err := db.First(&hours, "restaurant_id = ? AND weekday = ?", restaurantID, uint(dayStart.Weekday())).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return slots, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []models.Table
+	err = db.Where("restaurant_id = ? AND seats >= ?", restaurantID, partySize).Order("seats").Order("id").Find(&tables).Error
+	if err != nil {
+		return nil, err
+	}
+
+	opensAt := dayStart.Add(time.Duration(hours.OpensAt) * time.Minute)
+	closesAt := dayStart.Add(time.Duration(hours.ClosesAt) * time.Minute)
+
+	var reservations []models.Reservation
+	err = db.Where("restaurant_id = ? AND status IN ? AND starts_at < ? AND ends_at > ?",
+		restaurantID, activeReservationStatuses, closesAt, opensAt).Find(&reservations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for start := opensAt; !start.Add(reservationDuration).After(closesAt); start = start.Add(reservationSlotStep) {
+		end := start.Add(reservationDuration)
+
+		slots = append(slots, reservationSlot{
+			StartsAt:   start,
+			EndsAt:     end,
+			FreeTables: freeTables(tables, reservations, start, end),
+		})
+	}
+
+	return slots, nil
+}
+
+// freeTables returns the IDs of the tables that have no reservation overlapping the [start, end) slot.
+// A reservation ending exactly when the slot starts, or starting exactly when it ends, does not overlap.
+func freeTables(tables []models.Table, reservations []models.Reservation, start, end time.Time) []uint {
+	free := []uint{}
+	for _, table := range tables {
+		booked := false
+		for _, reservation := range reservations {
+			if reservation.TableID == table.ID && reservation.StartsAt.Before(end) && reservation.EndsAt.After(start) {
+				booked = true
+				break
+			}
+		}
+
+		if !booked {
+			free = append(free, table.ID)
+		}
+	}
+
+	return free
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFreeTables(t *testing.T) {
+	base := time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return base.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	tables := []models.Table{{ID: 1}, {ID: 2}}
+	start, end := at(0), at(120)
+
+	tests := []struct {
+		name         string
+		reservations []models.Reservation
+		want         []uint
+	}{
+		{
+			name: "no reservations",
+			want: []uint{1, 2},
+		},
+		{
+			name:         "same slot",
+			reservations: []models.Reservation{{TableID: 1, StartsAt: at(0), EndsAt: at(120)}},
+			want:         []uint{2},
+		},
+		{
+			name:         "overlaps the start",
+			reservations: []models.Reservation{{TableID: 2, StartsAt: at(-60), EndsAt: at(30)}},
+			want:         []uint{1},
+		},
+		{
+			name:         "overlaps the end",
+			reservations: []models.Reservation{{TableID: 1, StartsAt: at(90), EndsAt: at(210)}},
+			want:         []uint{2},
+		},
+		{
+			name:         "inside the slot",
+			reservations: []models.Reservation{{TableID: 1, StartsAt: at(30), EndsAt: at(60)}},
+			want:         []uint{2},
+		},
+		{
+			name:         "ends when the slot starts",
+			reservations: []models.Reservation{{TableID: 1, StartsAt: at(-120), EndsAt: at(0)}},
+			want:         []uint{1, 2},
+		},
+		{
+			name:         "starts when the slot ends",
+			reservations: []models.Reservation{{TableID: 1, StartsAt: at(120), EndsAt: at(240)}},
+			want:         []uint{1, 2},
+		},
+		{
+			name: "every table booked",
+			reservations: []models.Reservation{
+				{TableID: 1, StartsAt: at(0), EndsAt: at(120)},
+				{TableID: 2, StartsAt: at(60), EndsAt: at(180)},
+			},
+			want: []uint{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := freeTables(tables, tt.reservations, start, end)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("freeTables = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
 	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func (m *Repository) GetRestaurants(w http.ResponseWriter, r *http.Request) {
@@ -19,19 +22,31 @@ func (m *Repository) GetRestaurants(w http.ResponseWriter, r *http.Request) {
 	if ownerID != "" {
 		id, err := strconv.Atoi(ownerID)
 		if err != nil {
-			_ = m.errorJSON(w, errors.New("invalid owner ID"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, apierror.InvalidParam("owner_id"), http.StatusNotFound)
 			return
 		}
 
 		query = query.Where("owner_id = ?", id)
 	}
 
+	switch urlQuery.Get("sort") {
+	case "":
+	case "rating":
+		query = query.Order("rating DESC").Order("reviews_count DESC")
+	default:
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid sort, expected 'rating'", apierror.FieldError{Field: "sort", Reason: apierror.Invalid}))
+		return
+	}
+
 	err := query.Find(&restaurants).Error
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusNotFound)
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
 		return
 	}
 
+	m.markFavouriteRestaurants(r, restaurants)
+	m.translateRestaurants(r, restaurants)
+
 	payload := jsonResponse{
 		Error: false,
 		Data:  restaurants,
@@ -43,17 +58,22 @@ func (m *Repository) GetRestaurants(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) GetRestaurant(w http.ResponseWriter, r *http.Request) {
 	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid restaurant ID"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
 		return
 	}
 
 	var restaurant models.Restaurant
 	err = m.App.DB.Where("id = ?", restaurantID).First(&restaurant).Error
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusNotFound)
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
 		return
 	}
 
+	restaurants := []models.Restaurant{restaurant}
+	m.markFavouriteRestaurants(r, restaurants)
+	m.translateRestaurants(r, restaurants)
+	restaurant = restaurants[0]
+
 	payload := jsonResponse{
 		Error: false,
 		Data:  restaurant,
@@ -65,19 +85,23 @@ func (m *Repository) GetRestaurant(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 	ownerID, err := m.getUserFromToken(r)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	if !m.requireVerifiedEmail(w, r, ownerID) {
 		return
 	}
 
 	var newRestaurant models.Restaurant
 	err = json.NewDecoder(r.Body).Decode(&newRestaurant)
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("error decoding restaurant data"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding restaurant data"), http.StatusBadRequest)
 		return
 	}
 
 	if newRestaurant.Title == "" {
-		_ = m.errorJSON(w, errors.New("title cannot be empty"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.Field("title", apierror.Required, "title cannot be empty"), http.StatusBadRequest)
 		return
 	}
 
@@ -89,14 +113,22 @@ func (m *Repository) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 		"phone = ?", newRestaurant.Title, newRestaurant.Type,
 		newRestaurant.Description, newRestaurant.Address, newRestaurant.Phone).First(&existingRestaurant)
 	if result.Error == nil {
-		_ = m.errorJSON(w, errors.New("duplicate restaurant entry"), http.StatusConflict)
+		_ = m.errorJSON(w, r, errors.New("duplicate restaurant entry"), http.StatusConflict)
+		return
+	}
+
+	newRestaurant.DefaultLanguage, err = defaultLanguage(newRestaurant.DefaultLanguage)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
 		return
 	}
 
 	newRestaurant.OwnerID = ownerID
+	newRestaurant.Rating = 0
+	newRestaurant.ReviewsCount = 0
 
 	if err := m.App.DB.Create(&newRestaurant).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -110,32 +142,32 @@ func (m *Repository) CreateRestaurant(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 	userID, err := m.getUserFromToken(r)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
 	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid restaurant ID"))
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
 		return
 	}
 
 	var updateData models.Restaurant
 	err = json.NewDecoder(r.Body).Decode(&updateData)
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("error decoding restaurant data"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding restaurant data"), http.StatusBadRequest)
 		return
 	}
 
 	var existingRestaurant models.Restaurant
 	if m.isAdmin(userID) {
 		if err := m.App.DB.First(&existingRestaurant, "id = ?", restaurantID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("restaurant not found"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
 			return
 		}
 	} else {
 		if err := m.App.DB.First(&existingRestaurant, "id = ? AND owner_id = ?", restaurantID, userID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
 			return
 		}
 	}
@@ -146,8 +178,16 @@ func (m *Repository) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 	existingRestaurant.Address = updateData.Address
 	existingRestaurant.Phone = updateData.Phone
 
+	if updateData.DefaultLanguage != "" {
+		existingRestaurant.DefaultLanguage, err = defaultLanguage(updateData.DefaultLanguage)
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+			return
+		}
+	}
+
 	if err := m.App.DB.Save(&existingRestaurant).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -161,31 +201,31 @@ func (m *Repository) UpdateRestaurant(w http.ResponseWriter, r *http.Request) {
 func (m *Repository) DeleteRestaurant(w http.ResponseWriter, r *http.Request) {
 	userID, err := m.getUserFromToken(r)
 	if err != nil {
-		_ = m.errorJSON(w, err, http.StatusUnauthorized)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
 		return
 	}
 
 	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid restaurant ID"), http.StatusBadRequest)
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
 		return
 	}
 
 	var restaurant models.Restaurant
 	if m.isAdmin(userID) {
 		if err := m.App.DB.First(&restaurant, restaurantID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("restaurant not found"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
 			return
 		}
 	} else {
 		if err := m.App.DB.First(&restaurant, "id = ? AND owner_id = ?", restaurantID, userID).Error; err != nil {
-			_ = m.errorJSON(w, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+			_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
 			return
 		}
 	}
 
 	if err := m.App.DB.Delete(&restaurant).Error; err != nil {
-		_ = m.errorJSON(w, err, http.StatusInternalServerError)
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -195,3 +235,16 @@ func (m *Repository) DeleteRestaurant(w http.ResponseWriter, r *http.Request) {
 	}
 	_ = m.writeJSON(w, http.StatusOK, payload)
 }
+
+// transferRestaurants makes the user the owner of the restaurants. The API keys of the restaurants
+// were issued by the old owner and are revoked; the new owner issues their own.
+func transferRestaurants(tx *gorm.DB, restaurantIDs []uint, ownerID uint) error {
+	err := tx.Model(&models.Restaurant{}).Where("id IN ?", restaurantIDs).Update("owner_id", ownerID).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.APIKey{}).
+		Where("restaurant_id IN ? AND revoked_at IS NULL", restaurantIDs).
+		Update("revoked_at", time.Now()).Error
+}
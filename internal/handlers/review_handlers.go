@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// reviewBody is the review request body structure.
+type reviewBody struct {
+	Rating      uint   `json:"rating"`
+	Text        string `json:"text"`
+	MenuItemIDs []uint `json:"menuItemIds"`
+}
+
+// maxReviewTextLength is the length limit of the review text and the owner reply in characters.
+const maxReviewTextLength = 2000
+
+// validate checks the rating and the text length of the review.
+func (b reviewBody) validate() error {
+	if b.Rating < 1 || b.Rating > 5 {
+		return apierror.Field("rating", apierror.OutOfRange, "rating must be between 1 and 5")
+	}
+
+	if utf8.RuneCountInString(b.Text) > maxReviewTextLength {
+		return apierror.Field("text", apierror.TooLong, fmt.Sprintf("text cannot be longer than %d characters", maxReviewTextLength))
+	}
+
+	return nil
+}
+
+// replyBody is the owner reply request body structure.
+type replyBody struct {
+	Text string `json:"text"`
+}
+
+// GetReviews returns the visible reviews of a restaurant.
+func (m *Repository) GetReviews(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	var reviews []models.Review
+	err = m.App.DB.Preload("User").Preload("MenuItems").
+		Where("restaurant_id = ? AND hidden = ?", restaurantID, false).
+		Order("created_at DESC").Find(&reviews).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	var menuItems []*models.MenuItem
+	for i := range reviews {
+		reviews[i].AuthorName = fmt.Sprintf("%s %s", reviews[i].User.FirstName, reviews[i].User.LastName)
+
+		for j := range reviews[i].MenuItems {
+			menuItems = append(menuItems, &reviews[i].MenuItems[j])
+		}
+	}
+
+	m.translateMenuItemRefs(r, menuItems)
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  reviews,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateReview handles the review creation request.
+func (m *Repository) CreateReview(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	var restaurant models.Restaurant
+	if err := m.App.DB.First(&restaurant, "id = ?", restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
+		return
+	}
+
+	var body reviewBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding review data"), http.StatusBadRequest)
+		return
+	}
+
+	if err := body.validate(); err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	var existingReview models.Review
+	if err := m.App.DB.First(&existingReview, "restaurant_id = ? AND user_id = ?", restaurantID, userID).Error; err == nil {
+		_ = m.errorJSON(w, r, errors.New("you have already reviewed this restaurant"), http.StatusConflict)
+		return
+	}
+
+	menuItems, err := m.findRestaurantMenuItems(restaurant.ID, body.MenuItemIDs)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	review := models.Review{
+		RestaurantID: restaurant.ID,
+		UserID:       userID,
+		Rating:       body.Rating,
+		Text:         body.Text,
+		MenuItems:    menuItems,
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+
+		return refreshRestaurantRating(tx, restaurant.ID)
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  review,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// UpdateReview handles the review update request. Only the author can update a review.
+func (m *Repository) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	reviewID, err := strconv.Atoi(chi.URLParam(r, "review_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("review_id"))
+		return
+	}
+
+	var review models.Review
+	if err := m.App.DB.First(&review, "id = ? AND restaurant_id = ? AND user_id = ?", reviewID, restaurantID, userID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("review not found or not written by the user"), http.StatusNotFound)
+		return
+	}
+
+	var body reviewBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding review data"), http.StatusBadRequest)
+		return
+	}
+
+	if err := body.validate(); err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	menuItems, err := m.findRestaurantMenuItems(review.RestaurantID, body.MenuItemIDs)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	review.Rating = body.Rating
+	review.Text = body.Text
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&review).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&review).Association("MenuItems").Replace(menuItems); err != nil {
+			return err
+		}
+
+		return refreshRestaurantRating(tx, review.RestaurantID)
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	review.MenuItems = menuItems
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  review,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteReview handles the review deletion request. Authors and admins can delete a review.
+func (m *Repository) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
+		return
+	}
+
+	reviewID, err := strconv.Atoi(chi.URLParam(r, "review_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("review_id"), http.StatusBadRequest)
+		return
+	}
+
+	var review models.Review
+	if m.isAdmin(userID) {
+		if err := m.App.DB.First(&review, "id = ? AND restaurant_id = ?", reviewID, restaurantID).Error; err != nil {
+			_ = m.errorJSON(w, r, errors.New("review not found"), http.StatusNotFound)
+			return
+		}
+	} else {
+		if err := m.App.DB.First(&review, "id = ? AND restaurant_id = ? AND user_id = ?", reviewID, restaurantID, userID).Error; err != nil {
+			_ = m.errorJSON(w, r, errors.New("review not found or not written by the user"), http.StatusNotFound)
+			return
+		}
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("MenuItems").Delete(&review).Error; err != nil {
+			return err
+		}
+
+		return refreshRestaurantRating(tx, review.RestaurantID)
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "review deleted successfully",
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ReplyToReview handles the owner reply to a review. An empty text removes the reply.
+func (m *Repository) ReplyToReview(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	reviewID, err := strconv.Atoi(chi.URLParam(r, "review_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("review_id"))
+		return
+	}
+
+	if !m.isAdmin(userID) {
+		var restaurant models.Restaurant
+		if err := m.App.DB.First(&restaurant, "id = ? AND owner_id = ?", restaurantID, userID).Error; err != nil {
+			_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+			return
+		}
+	}
+
+	var review models.Review
+	if err := m.App.DB.First(&review, "id = ? AND restaurant_id = ?", reviewID, restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("review not found"), http.StatusNotFound)
+		return
+	}
+
+	var body replyBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding reply data"), http.StatusBadRequest)
+		return
+	}
+
+	if utf8.RuneCountInString(body.Text) > maxReviewTextLength {
+		_ = m.errorJSON(w, r, apierror.Field("text", apierror.TooLong, fmt.Sprintf("text cannot be longer than %d characters", maxReviewTextLength)))
+		return
+	}
+
+	review.OwnerReply = body.Text
+	review.OwnerRepliedAt = nil
+	if body.Text != "" {
+		now := time.Now()
+		review.OwnerRepliedAt = &now
+	}
+
+	if err := m.App.DB.Save(&review).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  review,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetModerationReviews returns all reviews, including hidden ones, for admin moderation.
+// The `flagged` and `hidden` query parameters narrow the result.
+func (m *Repository) GetModerationReviews(w http.ResponseWriter, r *http.Request) {
+	urlQuery := r.URL.Query()
+
+	query := m.App.DB.Preload("User").Preload("MenuItems")
+
+	for _, column := range []string{"flagged", "hidden"} {
+		if value := urlQuery.Get(column); value != "" {
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				_ = m.errorJSON(w, r, fmt.Errorf("invalid %s value", column))
+				return
+			}
+
+			query = query.Where(column+" = ?", flag)
+		}
+	}
+
+	var reviews []models.Review
+	if err := query.Order("created_at DESC").Find(&reviews).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	for i := range reviews {
+		reviews[i].AuthorName = fmt.Sprintf("%s %s", reviews[i].User.FirstName, reviews[i].User.LastName)
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  reviews,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// ModerateReview handles the admin moderation actions on a review: hide, unhide, flag and unflag.
+func (m *Repository) ModerateReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(chi.URLParam(r, "review_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("review_id"), http.StatusBadRequest)
+		return
+	}
+
+	var review models.Review
+	if err := m.App.DB.First(&review, reviewID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("review not found"), http.StatusNotFound)
+		return
+	}
+
+	switch chi.URLParam(r, "action") {
+	case "hide":
+		review.Hidden = true
+	case "unhide":
+		review.Hidden = false
+	case "flag":
+		review.Flagged = true
+	case "unflag":
+		review.Flagged = false
+	default:
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidParameter, "invalid action, expected 'hide', 'unhide', 'flag' or 'unflag'", apierror.FieldError{Field: "action", Reason: apierror.Invalid}), http.StatusBadRequest)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&review).Error; err != nil {
+			return err
+		}
+
+		return refreshRestaurantRating(tx, review.RestaurantID)
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  review,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// findRestaurantMenuItems loads the menu items with the given IDs, making sure all of them belong to the restaurant.
+func (m *Repository) findRestaurantMenuItems(restaurantID uint, ids []uint) ([]models.MenuItem, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var menuItems []models.MenuItem
+	err := m.App.DB.Where("id IN ? AND menu_id IN (SELECT id FROM menus WHERE restaurant_id = ?)", ids, restaurantID).
+		Find(&menuItems).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(menuItems) != len(uniqueIDs(ids)) {
+		return nil, errors.New("referenced menu items not found in this restaurant")
+	}
+
+	return menuItems, nil
+}
+
+// refreshRestaurantRating recalculates the aggregated rating and reviews count of a restaurant
+// from its visible reviews.
+func refreshRestaurantRating(tx *gorm.DB, restaurantID uint) error {
+	var aggregate struct {
+		Rating float64
+		Count  uint
+	}
+
+	err := tx.Model(&models.Review{}).
+		Select("COALESCE(AVG(rating), 0) AS rating, COUNT(*) AS count").
+		Where("restaurant_id = ? AND hidden = ?", restaurantID, false).
+		Scan(&aggregate).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.Restaurant{}).Where("id = ?", restaurantID).
+		Updates(map[string]any{"rating": aggregate.Rating, "reviews_count": aggregate.Count}).Error
+}
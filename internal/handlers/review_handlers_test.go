@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"strings"
+	"testing"
+)
+
+func TestReviewBodyValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      reviewBody
+		wantField string
+	}{
+		{name: "lowest rating", body: reviewBody{Rating: 1}},
+		{name: "highest rating with text", body: reviewBody{Rating: 5, Text: "Смачно"}},
+		{name: "no rating", body: reviewBody{Rating: 0}, wantField: "rating"},
+		{name: "rating above 5", body: reviewBody{Rating: 6}, wantField: "rating"},
+		{name: "longest text in Cyrillic", body: reviewBody{Rating: 4, Text: strings.Repeat("ї", maxReviewTextLength)}},
+		{name: "too long text", body: reviewBody{Rating: 4, Text: strings.Repeat("a", maxReviewTextLength+1)}, wantField: "text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.body.validate()
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("validate = %v, want nil", err)
+				}
+				return
+			}
+
+			var apiErr *apierror.Error
+			if !errors.As(err, &apiErr) || apiErr.Code != apierror.ValidationFailed || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != tt.wantField {
+				t.Fatalf("validate = %v, want a validation error of %s", err, tt.wantField)
+			}
+		})
+	}
+}
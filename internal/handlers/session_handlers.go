@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// accessTokenTTL is the lifetime of the access JWT in the user_jwt cookie.
+	accessTokenTTL = 15 * time.Minute
+	// refreshTokenTTL is the lifetime of a refresh token. A session expires when it is not refreshed for this long.
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	accessTokenCookie  = "user_jwt"
+	refreshTokenCookie = "user_refresh"
+	// refreshTokenPath limits the refresh token cookie to the refresh endpoint.
+	refreshTokenPath = "/api/v1/refresh"
+
+	// lastSeenInterval limits how often the last-seen time of a session is written.
+	lastSeenInterval = time.Minute
+)
+
+// Reasons a session is revoked.
+const (
+	revokedLogout     = "logout"
+	revokedTokenReuse = "refresh_token_reuse"
+	revokedByUser     = "revoked_by_user"
+	revokedByAdmin    = "revoked_by_admin"
+)
+
+var (
+	errSessionRevoked     = apierror.New(apierror.Unauthorized, "session is revoked or expired")
+	errRefreshTokenReused = apierror.New(apierror.Unauthorized, "refresh token was already used, the session is revoked")
+)
+
+// Refresh rotates the refresh token from the user_refresh cookie and issues a new access token.
+// Every refresh token can be used once; presenting a used one revokes its whole session,
+// since either the client or an attacker holds a stolen copy.
+func (m *Repository) Refresh(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(refreshTokenCookie)
+	if err != nil || cookie.Value == "" {
+		_ = m.errorJSON(w, r, apierror.New(apierror.Unauthorized, "no refresh token found"))
+		return
+	}
+
+	now := time.Now()
+
+	var session models.Session
+	var cookies []*http.Cookie
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		var refreshToken models.RefreshToken
+		if err := tx.Preload("Session").First(&refreshToken, "token_hash = ?", hashToken(cookie.Value)).Error; err != nil {
+			return apierror.New(apierror.Unauthorized, "invalid refresh token")
+		}
+		session = refreshToken.Session
+
+		if err := checkRefreshToken(refreshToken, now); err != nil {
+			return err
+		}
+
+		// Mark the token used only if nobody did it first, so that concurrent reuse is detected too
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", refreshToken.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		if err := tx.Model(&session).Updates(sessionClient(r, now)).Error; err != nil {
+			return err
+		}
+
+		cookies, err = m.issueTokens(tx, &session)
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		if err := revokeSession(m.App.DB, session.ID, revokedTokenReuse); err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	if err != nil {
+		clearAuthCookies(w)
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	for _, cookie := range cookies {
+		http.SetCookie(w, cookie)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "session refreshed",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// checkRefreshToken checks that the refresh token with its session preloaded can be exchanged at the given time.
+// A token of a revoked or expired session, or an expired token, is refused with errSessionRevoked.
+// A token used before is refused with errRefreshTokenReused, so that the caller revokes the session.
+func checkRefreshToken(refreshToken models.RefreshToken, now time.Time) error {
+	if !refreshToken.Session.Active(now) || now.After(refreshToken.ExpiresAt) {
+		return errSessionRevoked
+	}
+
+	if refreshToken.UsedAt != nil {
+		return errRefreshTokenReused
+	}
+
+	return nil
+}
+
+// GetSessions returns the active sessions of the current user, most recently used first.
+func (m *Repository) GetSessions(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value("session").(models.Session)
+	if !ok {
+		_ = m.errorJSON(w, r, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	var sessions []models.Session
+	err := m.App.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", current.UserID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current.ID
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  sessions,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// RevokeSession revokes a session of the current user. Revoking the current session logs the user out.
+func (m *Repository) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value("session").(models.Session)
+	if !ok {
+		_ = m.errorJSON(w, r, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(chi.URLParam(r, "session_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("session_id"), http.StatusBadRequest)
+		return
+	}
+
+	var session models.Session
+	err = m.App.DB.First(&session, "id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, current.UserID).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("session not found"), http.StatusNotFound)
+		return
+	}
+
+	err = revokeSession(m.App.DB, session.ID, revokedByUser)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if session.ID == current.ID {
+		clearAuthCookies(w)
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "session revoked",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// RevokeOtherSessions revokes all sessions of the current user except the current one.
+func (m *Repository) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	current, ok := r.Context().Value("session").(models.Session)
+	if !ok {
+		_ = m.errorJSON(w, r, errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+
+	count, err := revokeUserSessions(m.App.DB, current.UserID, current.ID, revokedByUser)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d sessions revoked", count),
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// RevokeUserSessions lets an admin terminate all sessions of a user.
+func (m *Repository) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "user_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("user_id"), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := m.App.DB.First(&user, "id = ?", userID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("user not found"), http.StatusNotFound)
+		return
+	}
+
+	count, err := revokeUserSessions(m.App.DB, user.ID, 0, revokedByAdmin)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("%d sessions revoked", count),
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// startSession creates a session for the user on the device of the request and sets
+// the access and refresh token cookies.
+func (m *Repository) startSession(w http.ResponseWriter, r *http.Request, userID uint) (models.Session, error) {
+	client := sessionClient(r, time.Now())
+	session := models.Session{
+		UserID:     userID,
+		Device:     client.Device,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		LastSeenAt: client.LastSeenAt,
+	}
+
+	var cookies []*http.Cookie
+	err := m.App.DB.Transaction(func(tx *gorm.DB) error {
+		session.ExpiresAt = time.Now().Add(refreshTokenTTL)
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		cookies, err = m.issueTokens(tx, &session)
+		return err
+	})
+	if err != nil {
+		return session, err
+	}
+
+	for _, cookie := range cookies {
+		http.SetCookie(w, cookie)
+	}
+
+	return session, nil
+}
+
+// issueTokens stores a new refresh token of the session, extends the session and returns
+// the access and refresh token cookies, which are set once the transaction commits.
+func (m *Repository) issueTokens(tx *gorm.DB, session *models.Session) ([]*http.Cookie, error) {
+	now := time.Now()
+
+	value, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(value),
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}
+	if err := tx.Create(&refreshToken).Error; err != nil {
+		return nil, err
+	}
+
+	session.ExpiresAt = refreshToken.ExpiresAt
+	if err := tx.Model(session).Update("expires_at", session.ExpiresAt).Error; err != nil {
+		return nil, err
+	}
+
+	tokenString, err := m.signAccessToken(*session, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*http.Cookie{{
+		Name:     accessTokenCookie,
+		Path:     "/",
+		Value:    tokenString,
+		MaxAge:   int(accessTokenTTL.Seconds()),
+		Secure:   false,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}, {
+		Name:     refreshTokenCookie,
+		Path:     refreshTokenPath,
+		Value:    value,
+		MaxAge:   int(refreshTokenTTL.Seconds()),
+		Secure:   false,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}}, nil
+}
+
+// signAccessToken returns an access token of the session issued at now.
+func (m *Repository) signAccessToken(session models.Session, now time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": session.UserID,
+		"sid": session.ID,
+		"iat": now.Unix(),
+		"exp": now.Add(accessTokenTTL).Unix(),
+	})
+
+	tokenString, err := token.SignedString([]byte(m.App.Env.JWTSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to create JWT token: %v", err)
+	}
+
+	return tokenString, nil
+}
+
+// authenticate validates the access token of the request, from the Authorization header or
+// the user_jwt cookie, and returns its session,
+// which must belong to the token subject and be neither revoked nor expired.
+func (m *Repository) authenticate(r *http.Request) (models.Session, error) {
+	var session models.Session
+
+	tokenString, ok := accessToken(r)
+	if !ok {
+		return session, errors.New("no token found")
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(m.App.Env.JWTSecret), nil
+	}, jwt.WithExpirationRequired())
+	if err != nil {
+		return session, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return session, errors.New("invalid token")
+	}
+
+	userID, okSub := claims["sub"].(float64)
+	sessionID, okSid := claims["sid"].(float64)
+	if !okSub || !okSid {
+		return session, errors.New("invalid token claims")
+	}
+
+	err = m.App.DB.First(&session, "id = ? AND user_id = ?", uint(sessionID), uint(userID)).Error
+	if err != nil || !session.Active(time.Now()) {
+		return session, errSessionRevoked
+	}
+
+	return session, nil
+}
+
+// touchSession records that the session was used now, at most once per lastSeenInterval.
+func (m *Repository) touchSession(r *http.Request, session *models.Session) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < lastSeenInterval {
+		return
+	}
+
+	client := sessionClient(r, now)
+	if err := m.App.DB.Model(session).Updates(client).Error; err != nil {
+		log.Printf("error updating session %d: %v", session.ID, err)
+	}
+}
+
+// sessionClient returns the device, IP, user agent and last-seen time of a session used by the request.
+func sessionClient(r *http.Request, now time.Time) models.Session {
+	// Cut the user agent to the column size without splitting a multi-byte character
+	userAgent := strings.ToValidUTF8(r.UserAgent(), "")
+	if len(userAgent) > 512 {
+		userAgent = strings.ToValidUTF8(userAgent[:512], "")
+	}
+
+	return models.Session{
+		Device:     deviceName(userAgent),
+		IP:         clientIP(r),
+		UserAgent:  userAgent,
+		LastSeenAt: now,
+	}
+}
+
+// clientIP returns the IP address of the client of the request. Behind a trusted proxy,
+// RealIP has already set the remote address to the forwarded one.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
+// deviceName returns a readable "browser on platform" name from a user agent.
+func deviceName(userAgent string) string {
+	browser := "Unknown browser"
+	for _, candidate := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	platform := "unknown platform"
+	for _, candidate := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			platform = candidate.name
+			break
+		}
+	}
+
+	return browser + " on " + platform
+}
+
+// revokeSession revokes the session with all of its refresh and access tokens.
+func revokeSession(db *gorm.DB, sessionID uint, reason string) error {
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]any{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// revokeUserSessions revokes all active sessions of the user except the one with exceptID
+// and returns how many were revoked.
+func revokeUserSessions(db *gorm.DB, userID, exceptID uint, reason string) (int64, error) {
+	result := db.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Updates(map[string]any{"revoked_at": time.Now(), "revoked_reason": reason})
+
+	return result.RowsAffected, result.Error
+}
+
+// clearAuthCookies removes the access and refresh token cookies.
+func clearAuthCookies(w http.ResponseWriter) {
+	for _, cookie := range []http.Cookie{
+		{Name: accessTokenCookie, Path: "/"},
+		{Name: refreshTokenCookie, Path: refreshTokenPath},
+	} {
+		cookie.MaxAge = -1
+		cookie.HttpOnly = true
+		cookie.SameSite = http.SameSiteLaxMode
+		http.SetCookie(w, &cookie)
+	}
+}
+
+// accessToken returns the access JWT of the request. A bearer token in the Authorization
+// header takes precedence over the user_jwt cookie; API keys are not access tokens.
+func accessToken(r *http.Request) (string, bool) {
+	if token, ok := bearerToken(r); ok {
+		return token, !isAPIKey(token)
+	}
+
+	cookie, err := r.Cookie(accessTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+
+	return cookie.Value, true
+}
+
+// bearerToken returns the token of the Authorization header with the Bearer scheme.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// hashToken returns the hex-encoded SHA-256 hash of a token, which is what gets stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	now := time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Minute), now.Add(time.Hour)
+
+	activeSession := models.Session{ExpiresAt: after}
+
+	tests := []struct {
+		name  string
+		token models.RefreshToken
+		want  error
+	}{
+		{name: "fresh token", token: models.RefreshToken{Session: activeSession, ExpiresAt: after}},
+		{name: "reused token", token: models.RefreshToken{Session: activeSession, ExpiresAt: after, UsedAt: &before}, want: errRefreshTokenReused},
+		{name: "expired token", token: models.RefreshToken{Session: activeSession, ExpiresAt: before}, want: errSessionRevoked},
+		{name: "expired session", token: models.RefreshToken{Session: models.Session{ExpiresAt: before}, ExpiresAt: after}, want: errSessionRevoked},
+		{name: "revoked session", token: models.RefreshToken{Session: models.Session{ExpiresAt: after, RevokedAt: &before}, ExpiresAt: after}, want: errSessionRevoked},
+		{
+			// The session is already revoked, so reusing its token has nothing left to revoke
+			name:  "reused token of a revoked session",
+			token: models.RefreshToken{Session: models.Session{ExpiresAt: after, RevokedAt: &before}, ExpiresAt: after, UsedAt: &before},
+			want:  errSessionRevoked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkRefreshToken(tt.token, now); err != tt.want {
+				t.Errorf("checkRefreshToken = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceName(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0",
+			want:      "Edge on Windows",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want:      "Chrome on macOS",
+		},
+		{
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			want:      "Safari on iOS",
+		},
+		{
+			userAgent: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			want:      "Chrome on Android",
+		},
+		{
+			userAgent: "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			want:      "Firefox on Linux",
+		},
+		{userAgent: "curl/8.7.1", want: "curl on unknown platform"},
+		{userAgent: "", want: "Unknown browser on unknown platform"},
+	}
+
+	for _, tt := range tests {
+		if got := deviceName(tt.userAgent); got != tt.want {
+			t.Errorf("deviceName(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
+
+func TestSessionClient(t *testing.T) {
+	now := time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	r.Header.Set("User-Agent", "curl/8.7.1")
+
+	session := sessionClient(r, now)
+	if session.IP != "203.0.113.7" || session.Device != "curl on unknown platform" || session.UserAgent != "curl/8.7.1" || !session.LastSeenAt.Equal(now) {
+		t.Errorf("sessionClient = %+v", session)
+	}
+
+	// A long user agent is cut to the column size on a character boundary
+	r.Header.Set("User-Agent", strings.Repeat("a", 511)+"ї"+strings.Repeat("b", 100))
+	session = sessionClient(r, now)
+	if session.UserAgent != strings.Repeat("a", 511) {
+		t.Errorf("user agent of %d bytes = %q..., want it cut before the split character", len(session.UserAgent), session.UserAgent[500:])
+	}
+	if !utf8.ValidString(session.UserAgent) {
+		t.Error("user agent is not valid UTF-8")
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		wantOK bool
+	}{
+		{header: "Bearer abc", want: "abc", wantOK: true},
+		{header: "bearer  abc ", want: "abc", wantOK: true},
+		{header: "Basic abc"},
+		{header: "Bearer "},
+		{header: "abc"},
+		{header: ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+
+		got, ok := bearerToken(r)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("bearerToken(%q) = %q, %v, want %q, %v", tt.header, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestAccessToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		cookie string
+		want   string
+		wantOK bool
+	}{
+		{name: "bearer token", header: "Bearer jwt", want: "jwt", wantOK: true},
+		{name: "bearer token over the cookie", header: "Bearer jwt", cookie: "cookie-jwt", want: "jwt", wantOK: true},
+		{name: "cookie", cookie: "cookie-jwt", want: "cookie-jwt", wantOK: true},
+		{name: "API key is not an access token", header: "Bearer " + apiKeyPrefix + "key", want: apiKeyPrefix + "key"},
+		{name: "nothing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: tt.cookie})
+			}
+
+			got, ok := accessToken(r)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("accessToken = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// SHA-256 of "abc"
+	if got := hashToken("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("hashToken(abc) = %s", got)
+	}
+}
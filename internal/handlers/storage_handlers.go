@@ -8,6 +8,12 @@ import (
 	"strings"
 )
 
+const (
+	imagesDir              = "storage/images"
+	imagesPath             = "/api/v1/storage/images/"
+	defaultMenuItemPicture = "menuitem-default.jpeg"
+)
+
 // GetImage returns the image from the application storage.
 func (m *Repository) GetImage(w http.ResponseWriter, r *http.Request) {
 	basePath := "storage/images"
@@ -25,6 +31,9 @@ func (m *Repository) GetImage(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate") // HTTP 1.1.
 		w.Header().Set("Pragma", "no-cache")                                   // HTTP 1.0.
 		w.Header().Set("Expires", "0")                                         // Proxies.
+		// Only ever render the files as the images their extension says
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
 
 		http.ServeFile(w, r, fullPath)
 	} else {
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+// tableBody is the table request body structure.
+type tableBody struct {
+	Title string `json:"title"`
+	Seats uint   `json:"seats"`
+}
+
+// openingHoursBody is a single day of the opening hours request body.
+type openingHoursBody struct {
+	Weekday  uint `json:"weekday"`
+	OpensAt  uint `json:"opensAt"`
+	ClosesAt uint `json:"closesAt"`
+}
+
+// GetTables returns the tables of a restaurant.
+func (m *Repository) GetTables(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	var tables []models.Table
+	err = m.App.DB.Where("restaurant_id = ?", restaurantID).Order("id").Find(&tables).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  tables,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateTable handles the table creation request.
+func (m *Repository) CreateTable(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	if !m.canManageRestaurant(userID, restaurantID) {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+		return
+	}
+
+	var body tableBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding table data"), http.StatusBadRequest)
+		return
+	}
+
+	if body.Title == "" || body.Seats == 0 {
+		_ = m.errorJSON(w, r, errors.New("title and seats are required"), http.StatusBadRequest)
+		return
+	}
+
+	token, err := randomToken(24)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	table := models.Table{
+		RestaurantID: uint(restaurantID),
+		Title:        body.Title,
+		Seats:        body.Seats,
+		Token:        token,
+	}
+
+	if err := m.App.DB.Create(&table).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  table,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// UpdateTable handles the table update request.
+func (m *Repository) UpdateTable(w http.ResponseWriter, r *http.Request) {
+	table, ok := m.managedTable(w, r)
+	if !ok {
+		return
+	}
+
+	var body tableBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding table data"), http.StatusBadRequest)
+		return
+	}
+
+	if body.Title == "" || body.Seats == 0 {
+		_ = m.errorJSON(w, r, errors.New("title and seats are required"), http.StatusBadRequest)
+		return
+	}
+
+	table.Title = body.Title
+	table.Seats = body.Seats
+
+	if err := m.App.DB.Save(&table).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  table,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteTable handles the table deletion request.
+func (m *Repository) DeleteTable(w http.ResponseWriter, r *http.Request) {
+	table, ok := m.managedTable(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.App.DB.Delete(&table).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "table deleted successfully",
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetOpeningHours returns the weekly opening hours of a restaurant.
+func (m *Repository) GetOpeningHours(w http.ResponseWriter, r *http.Request) {
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	var hours []models.OpeningHours
+	err = m.App.DB.Where("restaurant_id = ?", restaurantID).Order("weekday").Find(&hours).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  hours,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// UpdateOpeningHours replaces the weekly opening hours of a restaurant.
+// Days missing from the request body are considered closed.
+func (m *Repository) UpdateOpeningHours(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"))
+		return
+	}
+
+	if !m.canManageRestaurant(userID, restaurantID) {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+		return
+	}
+
+	var body []openingHoursBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding opening hours data"), http.StatusBadRequest)
+		return
+	}
+
+	seen := make(map[uint]bool)
+	hours := make([]models.OpeningHours, 0, len(body))
+	for _, day := range body {
+		if day.Weekday > 6 || day.OpensAt >= day.ClosesAt || day.ClosesAt > 24*60 || seen[day.Weekday] {
+			_ = m.errorJSON(w, r, errors.New("invalid opening hours"), http.StatusBadRequest)
+			return
+		}
+		seen[day.Weekday] = true
+
+		hours = append(hours, models.OpeningHours{
+			RestaurantID: uint(restaurantID),
+			Weekday:      day.Weekday,
+			OpensAt:      day.OpensAt,
+			ClosesAt:     day.ClosesAt,
+		})
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("restaurant_id = ?", restaurantID).Delete(&models.OpeningHours{}).Error; err != nil {
+			return err
+		}
+
+		if len(hours) == 0 {
+			return nil
+		}
+
+		return tx.Create(&hours).Error
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  hours,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// managedTable loads the table from the URL if the current user can manage its restaurant.
+// It writes the error response and returns false if the table cannot be used.
+func (m *Repository) managedTable(w http.ResponseWriter, r *http.Request) (models.Table, bool) {
+	var table models.Table
+
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return table, false
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
+		return table, false
+	}
+
+	tableID, err := strconv.Atoi(chi.URLParam(r, "table_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("table_id"), http.StatusBadRequest)
+		return table, false
+	}
+
+	if !m.canManageRestaurant(userID, restaurantID) {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+		return table, false
+	}
+
+	if err := m.App.DB.First(&table, "id = ? AND restaurant_id = ?", tableID, restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("table not found"), http.StatusNotFound)
+		return table, false
+	}
+
+	return table, true
+}
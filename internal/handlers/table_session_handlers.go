@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// tableSessionIdleTimeout is how long a table session stays open without guest activity.
+	tableSessionIdleTimeout = 30 * time.Minute
+	// tableRequestsPollInterval is how often the staff stream checks for request changes.
+	tableRequestsPollInterval = 2 * time.Second
+	// maxTableRequestNoteLength is the maximum length of a guest request note in characters.
+	maxTableRequestNoteLength = 500
+)
+
+// openTableSessionBody is the open table session request body structure.
+type openTableSessionBody struct {
+	TableToken string `json:"tableToken"`
+}
+
+// tableRequestBody is the guest request body structure.
+type tableRequestBody struct {
+	Kind models.TableRequestKind `json:"kind"`
+	Note string                  `json:"note"`
+}
+
+// validate checks the kind and the note length of a guest request.
+func (b tableRequestBody) validate() error {
+	if b.Kind != models.TableRequestCallWaiter && b.Kind != models.TableRequestRequestBill {
+		return apierror.New(apierror.InvalidParameter, "invalid kind, expected 'call_waiter' or 'request_bill'", apierror.FieldError{Field: "kind", Reason: apierror.Invalid})
+	}
+
+	if utf8.RuneCountInString(b.Note) > maxTableRequestNoteLength {
+		return apierror.Field("note", apierror.TooLong, fmt.Sprintf("note must be at most %d characters", maxTableRequestNoteLength))
+	}
+
+	return nil
+}
+
+// OpenTableSession opens a session for the table identified by the token from its QR code.
+// Guests scanning the same table while its session is active join that session.
+func (m *Repository) OpenTableSession(w http.ResponseWriter, r *http.Request) {
+	var body openTableSessionBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding table session data"), http.StatusBadRequest)
+		return
+	}
+
+	var table models.Table
+	if err := m.App.DB.First(&table, "token = ? AND token <> ''", body.TableToken).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("table not found"), http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+
+	var session models.TableSession
+	err = m.App.DB.Preload("Table").Where("table_id = ? AND expires_at > ?", table.ID, now).
+		Order("expires_at DESC").First(&session).Error
+	if err != nil {
+		token, err := randomToken(24)
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		session = models.TableSession{
+			Token:        token,
+			RestaurantID: table.RestaurantID,
+			TableID:      table.ID,
+			Table:        table,
+			CreatedAt:    now,
+		}
+	}
+
+	session.LastActivityAt = now
+	session.ExpiresAt = now.Add(tableSessionIdleTimeout)
+
+	if err := m.App.DB.Omit("Table").Save(&session).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  session,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// GetTableSession returns an active table session with its restaurant and requests and extends it.
+func (m *Repository) GetTableSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := m.activeTableSession(w, r)
+	if !ok {
+		return
+	}
+
+	var restaurant models.Restaurant
+	if err := m.App.DB.First(&restaurant, "id = ?", session.RestaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
+		return
+	}
+
+	restaurants := []models.Restaurant{restaurant}
+	m.translateRestaurants(r, restaurants)
+
+	var requests []models.TableRequest
+	err := m.App.DB.Where("table_session_id = ?", session.ID).Order("created_at DESC").Find(&requests).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: map[string]any{
+			"session":    session,
+			"restaurant": restaurants[0],
+			"requests":   requests,
+		},
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// CreateTableRequest handles a guest action from a table session, like calling a waiter or requesting the bill.
+func (m *Repository) CreateTableRequest(w http.ResponseWriter, r *http.Request) {
+	session, ok := m.activeTableSession(w, r)
+	if !ok {
+		return
+	}
+
+	var body tableRequestBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding table request data"), http.StatusBadRequest)
+		return
+	}
+
+	if err := body.validate(); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	var existingRequest models.TableRequest
+	err = m.App.DB.First(&existingRequest, "table_session_id = ? AND kind = ? AND status <> ?",
+		session.ID, body.Kind, models.TableRequestResolved).Error
+	if err == nil {
+		_ = m.errorJSON(w, r, errors.New("this request is already being handled"), http.StatusConflict)
+		return
+	}
+
+	request := models.TableRequest{
+		TableSessionID: session.ID,
+		RestaurantID:   session.RestaurantID,
+		TableID:        session.TableID,
+		Kind:           body.Kind,
+		Status:         models.TableRequestPending,
+		Note:           body.Note,
+	}
+
+	if err := m.App.DB.Omit("Table").Create(&request).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  request,
+	}
+	_ = m.writeJSON(w, http.StatusCreated, payload)
+}
+
+// GetTableRequests returns the table requests of a restaurant for its staff.
+// The `status` query parameter narrows the result and defaults to pending and acknowledged requests.
+func (m *Repository) GetTableRequests(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	requests, err := m.openTableRequests(restaurantID, r.URL.Query().Get("status"))
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  requests,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// StreamTableRequests streams the open table requests of a restaurant as server-sent events.
+// A `requests` event with the full list is sent on connect and whenever the list changes.
+func (m *Repository) StreamTableRequests(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		_ = m.errorJSON(w, r, errors.New("streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(tableRequestsPollInterval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		requests, err := m.openTableRequests(restaurantID, "")
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+			flusher.Flush()
+			return
+		}
+
+		out, err := json.Marshal(requests)
+		if err != nil {
+			return
+		}
+
+		if string(out) != last {
+			last = string(out)
+			_, _ = fmt.Fprintf(w, "event: requests\ndata: %s\n\n", out)
+			flusher.Flush()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// UpdateTableRequest handles the staff actions on a table request: acknowledge and resolve.
+func (m *Repository) UpdateTableRequest(w http.ResponseWriter, r *http.Request) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return
+	}
+
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	requestID, err := strconv.Atoi(chi.URLParam(r, "request_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("request_id"), http.StatusBadRequest)
+		return
+	}
+
+	var request models.TableRequest
+	if err := m.App.DB.First(&request, "id = ? AND restaurant_id = ?", requestID, restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("table request not found"), http.StatusNotFound)
+		return
+	}
+
+	if err := applyTableRequestAction(&request, chi.URLParam(r, "action"), time.Now()); err != nil {
+		if errors.Is(err, errInvalidTransition) {
+			_ = m.errorJSON(w, r, err, http.StatusConflict)
+			return
+		}
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	request.HandledByID = &userID
+
+	if err := m.App.DB.Omit("Table", "HandledBy").Save(&request).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  request,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// applyTableRequestAction moves the request to the status of the staff action and stamps the time of it.
+// Only pending requests can be acknowledged, and any request that is not resolved yet can be resolved.
+func applyTableRequestAction(request *models.TableRequest, action string, now time.Time) error {
+	switch action {
+	case "acknowledge":
+		if request.Status != models.TableRequestPending {
+			return fmt.Errorf("%w: %s -> %s", errInvalidTransition, request.Status, models.TableRequestAcknowledged)
+		}
+		request.Status = models.TableRequestAcknowledged
+		request.AcknowledgedAt = &now
+	case "resolve":
+		if request.Status == models.TableRequestResolved {
+			return fmt.Errorf("%w: %s -> %s", errInvalidTransition, request.Status, models.TableRequestResolved)
+		}
+		request.Status = models.TableRequestResolved
+		request.ResolvedAt = &now
+	default:
+		return apierror.New(apierror.InvalidParameter, "invalid action, expected 'acknowledge' or 'resolve'", apierror.FieldError{Field: "action", Reason: apierror.Invalid})
+	}
+
+	return nil
+}
+
+// activeTableSession loads the unexpired table session from the URL and records the guest activity.
+// It writes the error response and returns false if the session cannot be used.
+func (m *Repository) activeTableSession(w http.ResponseWriter, r *http.Request) (models.TableSession, bool) {
+	var session models.TableSession
+
+	now := time.Now()
+	err := m.App.DB.Preload("Table").
+		First(&session, "token = ? AND expires_at > ?", chi.URLParam(r, "session_token"), now).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, errors.New("table session not found or expired"), http.StatusNotFound)
+		return session, false
+	}
+
+	session.LastActivityAt = now
+	session.ExpiresAt = now.Add(tableSessionIdleTimeout)
+
+	err = m.App.DB.Model(&session).Updates(map[string]any{
+		"last_activity_at": session.LastActivityAt,
+		"expires_at":       session.ExpiresAt,
+	}).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return session, false
+	}
+
+	return session, true
+}
+
+// managedRestaurantID parses the restaurant ID from the URL and checks that the current user can manage it.
+// It writes the error response and returns false otherwise.
+func (m *Repository) managedRestaurantID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return 0, false
+	}
+
+	restaurantID, err := strconv.Atoi(chi.URLParam(r, "restaurant_id"))
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.InvalidParam("restaurant_id"), http.StatusBadRequest)
+		return 0, false
+	}
+
+	if !m.canManageRestaurant(userID, restaurantID) {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found or not owned by the user"), http.StatusNotFound)
+		return 0, false
+	}
+
+	return uint(restaurantID), true
+}
+
+// openTableRequests returns the table requests of a restaurant, oldest first.
+// Without a status, pending and acknowledged requests are returned.
+func (m *Repository) openTableRequests(restaurantID uint, status string) ([]models.TableRequest, error) {
+	query := m.App.DB.Preload("Table").Where("restaurant_id = ?", restaurantID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	} else {
+		query = query.Where("status IN ?", []models.TableRequestStatus{models.TableRequestPending, models.TableRequestAcknowledged})
+	}
+
+	var requests []models.TableRequest
+	err := query.Order("created_at").Find(&requests).Error
+
+	return requests, err
+}
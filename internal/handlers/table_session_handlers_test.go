@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTableRequestBodyValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      tableRequestBody
+		wantField string
+	}{
+		{name: "call waiter", body: tableRequestBody{Kind: models.TableRequestCallWaiter}},
+		{name: "request bill with note", body: tableRequestBody{Kind: models.TableRequestRequestBill, Note: "Карткою, будь ласка"}},
+		{name: "no kind", body: tableRequestBody{}, wantField: "kind"},
+		{name: "unknown kind", body: tableRequestBody{Kind: "order_food"}, wantField: "kind"},
+		{name: "longest note in Cyrillic", body: tableRequestBody{Kind: models.TableRequestCallWaiter, Note: strings.Repeat("ї", maxTableRequestNoteLength)}},
+		{name: "too long note", body: tableRequestBody{Kind: models.TableRequestCallWaiter, Note: strings.Repeat("a", maxTableRequestNoteLength+1)}, wantField: "note"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.body.validate()
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("validate = %v, want nil", err)
+				}
+				return
+			}
+
+			var apiErr *apierror.Error
+			if !errors.As(err, &apiErr) || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != tt.wantField {
+				t.Fatalf("validate = %v, want an error of %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestApplyTableRequestAction(t *testing.T) {
+	now := time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		status         models.TableRequestStatus
+		action         string
+		wantStatus     models.TableRequestStatus
+		wantTransition bool
+		wantInvalid    bool
+	}{
+		{name: "acknowledge pending", status: models.TableRequestPending, action: "acknowledge", wantStatus: models.TableRequestAcknowledged},
+		{name: "acknowledge twice", status: models.TableRequestAcknowledged, action: "acknowledge", wantTransition: true},
+		{name: "acknowledge resolved", status: models.TableRequestResolved, action: "acknowledge", wantTransition: true},
+		{name: "resolve pending", status: models.TableRequestPending, action: "resolve", wantStatus: models.TableRequestResolved},
+		{name: "resolve acknowledged", status: models.TableRequestAcknowledged, action: "resolve", wantStatus: models.TableRequestResolved},
+		{name: "resolve twice", status: models.TableRequestResolved, action: "resolve", wantTransition: true},
+		{name: "unknown action", status: models.TableRequestPending, action: "cancel", wantInvalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := models.TableRequest{Status: tt.status}
+			err := applyTableRequestAction(&request, tt.action, now)
+
+			switch {
+			case tt.wantTransition:
+				if !errors.Is(err, errInvalidTransition) {
+					t.Fatalf("applyTableRequestAction = %v, want an invalid transition", err)
+				}
+			case tt.wantInvalid:
+				var apiErr *apierror.Error
+				if !errors.As(err, &apiErr) || apiErr.Code != apierror.InvalidParameter {
+					t.Fatalf("applyTableRequestAction = %v, want an invalid parameter error", err)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("applyTableRequestAction = %v, want nil", err)
+				}
+			}
+
+			if tt.wantStatus == "" {
+				if request.Status != tt.status || request.AcknowledgedAt != nil || request.ResolvedAt != nil {
+					t.Errorf("a rejected action changed the request: %+v", request)
+				}
+				return
+			}
+
+			if request.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", request.Status, tt.wantStatus)
+			}
+
+			stamped := request.AcknowledgedAt
+			if tt.wantStatus == models.TableRequestResolved {
+				stamped = request.ResolvedAt
+			}
+			if stamped == nil || !stamped.Equal(now) {
+				t.Errorf("the %s time is not stamped", tt.action)
+			}
+		})
+	}
+}
@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// maxRequestLanguages limits the number of Accept-Language entries taken into account.
+const maxRequestLanguages = 8
+
+// translationText is the translated title and description of a restaurant.
+type translationText struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// menuTranslationBody is the translated title of a menu.
+type menuTranslationBody struct {
+	MenuID uint   `json:"menuId"`
+	Title  string `json:"title"`
+}
+
+// menuItemTranslationBody is the translated title and description of a menu item.
+type menuItemTranslationBody struct {
+	MenuItemID  uint   `json:"menuItemId"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// translationsBody is the update translations request body structure.
+// Entries with an empty title and description remove the translation.
+type translationsBody struct {
+	Restaurant *translationText          `json:"restaurant"`
+	Menus      []menuTranslationBody     `json:"menus"`
+	MenuItems  []menuItemTranslationBody `json:"menuItems"`
+}
+
+// GetTranslations returns the translations of a restaurant and its menus and menu items.
+// The `lang` query parameter narrows the result to one language.
+func (m *Repository) GetTranslations(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	query := m.App.DB.Where("restaurant_id = ?", restaurantID)
+	if value := r.URL.Query().Get("lang"); value != "" {
+		lang, err := normalizeLanguage(value)
+		if err != nil {
+			_ = m.errorJSON(w, r, err)
+			return
+		}
+		query = query.Where("language = ?", lang)
+	}
+
+	var translations []models.Translation
+	if err := query.Order("language").Order("id").Find(&translations).Error; err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  translations,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// UpdateTranslations creates, updates and removes the translations of a restaurant in one language.
+func (m *Repository) UpdateTranslations(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	lang, err := normalizeLanguage(chi.URLParam(r, "language"))
+	if err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	var restaurant models.Restaurant
+	if err := m.App.DB.First(&restaurant, "id = ?", restaurantID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("restaurant not found"), http.StatusNotFound)
+		return
+	}
+
+	if lang == restaurant.DefaultLanguage {
+		_ = m.errorJSON(w, r, fmt.Errorf("%q is the default language of the restaurant, update the restaurant instead", lang))
+		return
+	}
+
+	var body translationsBody
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding translations data"), http.StatusBadRequest)
+		return
+	}
+
+	menuIDs := make([]uint, 0, len(body.Menus))
+	for _, menu := range body.Menus {
+		menuIDs = append(menuIDs, menu.MenuID)
+	}
+
+	if len(menuIDs) > 0 {
+		var menuCount int64
+		err = m.App.DB.Model(&models.Menu{}).Where("id IN ? AND restaurant_id = ?", uniqueIDs(menuIDs), restaurantID).Count(&menuCount).Error
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+		if int(menuCount) != len(uniqueIDs(menuIDs)) {
+			_ = m.errorJSON(w, r, errors.New("referenced menus not found in this restaurant"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	menuItemIDs := make([]uint, 0, len(body.MenuItems))
+	for _, menuItem := range body.MenuItems {
+		menuItemIDs = append(menuItemIDs, menuItem.MenuItemID)
+	}
+
+	if _, err := m.findRestaurantMenuItems(restaurantID, menuItemIDs); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if body.Restaurant != nil {
+			translation := models.Translation{RestaurantID: restaurantID, Title: body.Restaurant.Title, Description: body.Restaurant.Description}
+			if err := saveTranslation(tx, lang, translation, "menu_id IS NULL AND menu_item_id IS NULL"); err != nil {
+				return err
+			}
+		}
+
+		for _, menu := range body.Menus {
+			menuID := menu.MenuID
+			translation := models.Translation{RestaurantID: restaurantID, MenuID: &menuID, Title: menu.Title}
+			if err := saveTranslation(tx, lang, translation, "menu_id = ?", menuID); err != nil {
+				return err
+			}
+		}
+
+		for _, menuItem := range body.MenuItems {
+			menuItemID := menuItem.MenuItemID
+			translation := models.Translation{RestaurantID: restaurantID, MenuItemID: &menuItemID, Title: menuItem.Title, Description: menuItem.Description}
+			if err := saveTranslation(tx, lang, translation, "menu_item_id = ?", menuItemID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	var translations []models.Translation
+	err = m.App.DB.Where("restaurant_id = ? AND language = ?", restaurantID, lang).Order("id").Find(&translations).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  translations,
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// DeleteTranslations removes all translations of a restaurant in one language.
+func (m *Repository) DeleteTranslations(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := m.managedRestaurantID(w, r)
+	if !ok {
+		return
+	}
+
+	lang, err := normalizeLanguage(chi.URLParam(r, "language"))
+	if err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	err = m.App.DB.Where("restaurant_id = ? AND language = ?", restaurantID, lang).Delete(&models.Translation{}).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "translations deleted successfully",
+	}
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// saveTranslation creates or updates the translation matched by the condition,
+// or removes it if both its title and description are empty.
+func saveTranslation(tx *gorm.DB, lang string, translation models.Translation, condition string, args ...any) error {
+	query := tx.Where("restaurant_id = ? AND language = ?", translation.RestaurantID, lang).Where(condition, args...)
+
+	if translation.Title == "" && translation.Description == "" {
+		return query.Delete(&models.Translation{}).Error
+	}
+
+	var existing models.Translation
+	err := query.First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	translation.ID = existing.ID
+	translation.Language = lang
+
+	return tx.Omit("Restaurant", "Menu", "MenuItem").Save(&translation).Error
+}
+
+// normalizeLanguage parses a BCP 47 language tag and returns its base language, like "en" for "en-GB".
+func normalizeLanguage(value string) (string, error) {
+	tag, err := language.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid language %q", value)
+	}
+
+	base, confidence := tag.Base()
+	if confidence == language.No {
+		return "", fmt.Errorf("invalid language %q", value)
+	}
+
+	return base.String(), nil
+}
+
+// requestLanguages returns the languages the client asked for in order of preference:
+// the `lang` query parameter first, then the Accept-Language header.
+func requestLanguages(r *http.Request) []string {
+	var langs []string
+	seen := make(map[string]bool)
+
+	add := func(value string) {
+		lang, err := normalizeLanguage(value)
+		if err == nil && !seen[lang] && len(langs) < maxRequestLanguages {
+			seen[lang] = true
+			langs = append(langs, lang)
+		}
+	}
+
+	if value := r.URL.Query().Get("lang"); value != "" {
+		add(value)
+	}
+
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err == nil {
+		for _, tag := range tags {
+			add(tag.String())
+		}
+	}
+
+	return langs
+}
+
+// pickTranslation returns the translation in the most preferred language, or nil if the default
+// language comes first or no translation in the requested languages exists.
+func pickTranslation(langs []string, defaultLanguage string, translations map[string]models.Translation) *models.Translation {
+	for _, lang := range langs {
+		if lang == defaultLanguage {
+			return nil
+		}
+
+		if translation, ok := translations[lang]; ok {
+			return &translation
+		}
+	}
+
+	return nil
+}
+
+// applyTranslation replaces the texts with the non-empty fields of the translation.
+func applyTranslation(translation *models.Translation, title, description *string) {
+	if translation == nil {
+		return
+	}
+
+	if translation.Title != "" {
+		*title = translation.Title
+	}
+
+	if translation.Description != "" && description != nil {
+		*description = translation.Description
+	}
+}
+
+// restaurantLanguages returns the default languages of the restaurants by their IDs.
+func (m *Repository) restaurantLanguages(restaurantIDs []uint) map[uint]string {
+	var restaurants []models.Restaurant
+	m.App.DB.Select("id", "default_language").Where("id IN ?", uniqueIDs(restaurantIDs)).Find(&restaurants)
+
+	langs := make(map[uint]string, len(restaurants))
+	for _, restaurant := range restaurants {
+		langs[restaurant.ID] = restaurant.DefaultLanguage
+	}
+
+	return langs
+}
+
+// translateRestaurants translates the restaurants into the languages of the request.
+func (m *Repository) translateRestaurants(r *http.Request, restaurants []models.Restaurant) {
+	langs := requestLanguages(r)
+	if len(langs) == 0 || len(restaurants) == 0 {
+		return
+	}
+
+	ids := make([]uint, 0, len(restaurants))
+	for _, restaurant := range restaurants {
+		ids = append(ids, restaurant.ID)
+	}
+
+	var translations []models.Translation
+	m.App.DB.Where("restaurant_id IN ? AND menu_id IS NULL AND menu_item_id IS NULL AND language IN ?", ids, langs).Find(&translations)
+	if len(translations) == 0 {
+		return
+	}
+
+	byRestaurant := make(map[uint]map[string]models.Translation)
+	for _, translation := range translations {
+		if byRestaurant[translation.RestaurantID] == nil {
+			byRestaurant[translation.RestaurantID] = make(map[string]models.Translation)
+		}
+		byRestaurant[translation.RestaurantID][translation.Language] = translation
+	}
+
+	for i := range restaurants {
+		translation := pickTranslation(langs, restaurants[i].DefaultLanguage, byRestaurant[restaurants[i].ID])
+		applyTranslation(translation, &restaurants[i].Title, &restaurants[i].Description)
+	}
+}
+
+// translateMenus translates the menus into the languages of the request.
+func (m *Repository) translateMenus(r *http.Request, menus []models.Menu) {
+	langs := requestLanguages(r)
+	if len(langs) == 0 || len(menus) == 0 {
+		return
+	}
+
+	ids := make([]uint, 0, len(menus))
+	restaurantIDs := make([]uint, 0, len(menus))
+	for _, menu := range menus {
+		ids = append(ids, menu.ID)
+		restaurantIDs = append(restaurantIDs, menu.RestaurantID)
+	}
+
+	var translations []models.Translation
+	m.App.DB.Where("menu_id IN ? AND language IN ?", ids, langs).Find(&translations)
+	if len(translations) == 0 {
+		return
+	}
+
+	byMenu := make(map[uint]map[string]models.Translation)
+	for _, translation := range translations {
+		if byMenu[*translation.MenuID] == nil {
+			byMenu[*translation.MenuID] = make(map[string]models.Translation)
+		}
+		byMenu[*translation.MenuID][translation.Language] = translation
+	}
+
+	defaults := m.restaurantLanguages(restaurantIDs)
+	for i := range menus {
+		translation := pickTranslation(langs, defaults[menus[i].RestaurantID], byMenu[menus[i].ID])
+		applyTranslation(translation, &menus[i].Title, nil)
+	}
+}
+
+// translateMenuItems translates the menu items into the languages of the request.
+func (m *Repository) translateMenuItems(r *http.Request, menuItems []models.MenuItem) {
+	langs := requestLanguages(r)
+	if len(langs) == 0 || len(menuItems) == 0 {
+		return
+	}
+
+	ids := make([]uint, 0, len(menuItems))
+	for _, menuItem := range menuItems {
+		ids = append(ids, menuItem.ID)
+	}
+
+	var translations []models.Translation
+	m.App.DB.Where("menu_item_id IN ? AND language IN ?", ids, langs).Find(&translations)
+	if len(translations) == 0 {
+		return
+	}
+
+	byMenuItem := make(map[uint]map[string]models.Translation)
+	restaurantIDs := make([]uint, 0, len(translations))
+	restaurantOf := make(map[uint]uint)
+	for _, translation := range translations {
+		if byMenuItem[*translation.MenuItemID] == nil {
+			byMenuItem[*translation.MenuItemID] = make(map[string]models.Translation)
+		}
+		byMenuItem[*translation.MenuItemID][translation.Language] = translation
+		restaurantIDs = append(restaurantIDs, translation.RestaurantID)
+		restaurantOf[*translation.MenuItemID] = translation.RestaurantID
+	}
+
+	defaults := m.restaurantLanguages(restaurantIDs)
+	for i := range menuItems {
+		id := menuItems[i].ID
+		translation := pickTranslation(langs, defaults[restaurantOf[id]], byMenuItem[id])
+		applyTranslation(translation, &menuItems[i].Title, &menuItems[i].Description)
+	}
+}
+
+// translateMenuRefs translates menus held by other records, like the menus a promotion targets.
+func (m *Repository) translateMenuRefs(r *http.Request, menus []*models.Menu) {
+	translated := make([]models.Menu, len(menus))
+	for i, menu := range menus {
+		translated[i] = *menu
+	}
+
+	m.translateMenus(r, translated)
+
+	for i, menu := range menus {
+		menu.Title = translated[i].Title
+	}
+}
+
+// translateMenuItemRefs translates menu items held by other records, like cart items or reviews.
+func (m *Repository) translateMenuItemRefs(r *http.Request, menuItems []*models.MenuItem) {
+	translated := make([]models.MenuItem, len(menuItems))
+	for i, menuItem := range menuItems {
+		translated[i] = *menuItem
+	}
+
+	m.translateMenuItems(r, translated)
+
+	for i, menuItem := range menuItems {
+		menuItem.Title = translated[i].Title
+		menuItem.Description = translated[i].Description
+	}
+}
+
+// translateOrders translates the item titles of the orders. Items whose menu item no longer
+// exists keep the title they were ordered under.
+func (m *Repository) translateOrders(r *http.Request, orders []models.Order) {
+	var items []*models.OrderItem
+	var menuItems []models.MenuItem
+
+	for i := range orders {
+		for j := range orders[i].Items {
+			item := &orders[i].Items[j]
+			if item.MenuItemID == nil {
+				continue
+			}
+
+			items = append(items, item)
+			menuItems = append(menuItems, models.MenuItem{ID: *item.MenuItemID, Title: item.Title})
+		}
+	}
+
+	m.translateMenuItems(r, menuItems)
+
+	for i, item := range items {
+		item.Title = menuItems[i].Title
+	}
+}
+
+// translateFavouriteLists translates the restaurants and menu items of the favourite list entries.
+func (m *Repository) translateFavouriteLists(r *http.Request, lists []models.FavouriteList) {
+	var restaurants []models.Restaurant
+	var menuItems []models.MenuItem
+
+	for _, list := range lists {
+		for _, entry := range list.Entries {
+			if entry.Restaurant != nil {
+				restaurants = append(restaurants, *entry.Restaurant)
+			}
+			if entry.MenuItem != nil {
+				menuItems = append(menuItems, *entry.MenuItem)
+			}
+		}
+	}
+
+	m.translateRestaurants(r, restaurants)
+	m.translateMenuItems(r, menuItems)
+
+	for i := range lists {
+		for j := range lists[i].Entries {
+			entry := &lists[i].Entries[j]
+			if entry.Restaurant != nil {
+				*entry.Restaurant, restaurants = restaurants[0], restaurants[1:]
+			}
+			if entry.MenuItem != nil {
+				*entry.MenuItem, menuItems = menuItems[0], menuItems[1:]
+			}
+		}
+	}
+}
+
+// defaultLanguage normalizes the default language of a restaurant, which is Ukrainian unless given.
+func defaultLanguage(value string) (string, error) {
+	if value == "" {
+		return "uk", nil
+	}
+
+	return normalizeLanguage(value)
+}
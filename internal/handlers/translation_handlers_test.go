@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "uk", want: "uk"},
+		{value: "en-GB", want: "en"},
+		{value: "EN", want: "en"},
+		{value: "pt-BR", want: "pt"},
+		{value: "not a language", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeLanguage(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("normalizeLanguage(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestDefaultLanguage(t *testing.T) {
+	if got, err := defaultLanguage(""); err != nil || got != "uk" {
+		t.Errorf("defaultLanguage(\"\") = %q, %v, want uk", got, err)
+	}
+	if got, err := defaultLanguage("de-AT"); err != nil || got != "de" {
+		t.Errorf("defaultLanguage(de-AT) = %q, %v, want de", got, err)
+	}
+}
+
+func TestRequestLanguages(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		acceptLanguage string
+		want           []string
+	}{
+		{name: "none", target: "/"},
+		{name: "query parameter", target: "/?lang=en", want: []string{"en"}},
+		{name: "header by quality", target: "/", acceptLanguage: "de;q=0.5, en-GB, en;q=0.9, pl;q=0.7", want: []string{"en", "pl", "de"}},
+		{name: "query parameter first", target: "/?lang=pl", acceptLanguage: "en, pl;q=0.8", want: []string{"pl", "en"}},
+		{name: "invalid query parameter", target: "/?lang=xx-invalid-", acceptLanguage: "en", want: []string{"en"}},
+		{
+			name:           "limited",
+			target:         "/",
+			acceptLanguage: "en, de, pl, fr, es, it, cs, sk, hu, ro, bg, lt, lv",
+			want:           []string{"en", "de", "pl", "fr", "es", "it", "cs", "sk", "hu", "ro", "bg", "lt", "lv"}[:maxRequestLanguages],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			if tt.acceptLanguage != "" {
+				r.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+
+			if got := requestLanguages(r); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requestLanguages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickTranslation(t *testing.T) {
+	translations := map[string]models.Translation{
+		"en": {Language: "en", Title: "Borscht"},
+		"pl": {Language: "pl", Title: "Barszcz"},
+	}
+
+	tests := []struct {
+		name  string
+		langs []string
+		want  string
+	}{
+		{name: "no languages"},
+		{name: "first language", langs: []string{"pl", "en"}, want: "pl"},
+		{name: "first translated language", langs: []string{"de", "en"}, want: "en"},
+		{name: "default language first", langs: []string{"uk", "en"}},
+		{name: "no translation", langs: []string{"de", "fr"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pickTranslation(tt.langs, "uk", translations)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("pickTranslation = %+v, want nil", got)
+				}
+				return
+			}
+
+			if got == nil || got.Language != tt.want {
+				t.Errorf("pickTranslation = %+v, want the %s translation", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTranslation(t *testing.T) {
+	title, description := "Борщ", "З пампушками"
+
+	applyTranslation(nil, &title, &description)
+	if title != "Борщ" || description != "З пампушками" {
+		t.Errorf("nil translation changed the texts to %q, %q", title, description)
+	}
+
+	applyTranslation(&models.Translation{Title: "Borscht"}, &title, &description)
+	if title != "Borscht" || description != "З пампушками" {
+		t.Errorf("texts = %q, %q, want the description to fall back", title, description)
+	}
+
+	applyTranslation(&models.Translation{Description: "With garlic buns"}, &title, &description)
+	if title != "Borscht" || description != "With garlic buns" {
+		t.Errorf("texts = %q, %q, want the title to fall back", title, description)
+	}
+
+	menuTitle := "Обід"
+	applyTranslation(&models.Translation{Title: "Lunch", Description: "ignored"}, &menuTitle, nil)
+	if menuTitle != "Lunch" {
+		t.Errorf("menu title = %q, want Lunch", menuTitle)
+	}
+}
@@ -0,0 +1,468 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/qr"
+	"github.com/vladyslavpavlenko/peparesu/internal/totp"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// totpIssuer is the account issuer shown by authenticator apps.
+	totpIssuer = "Peparesu"
+	// recoveryCodeCount is the number of recovery codes generated at once.
+	recoveryCodeCount = 10
+	// twoFactorLoginTTL is how long the user has to enter the code after the password.
+	twoFactorLoginTTL = 5 * time.Minute
+
+	purposeTwoFactorLogin = "two_factor_login"
+)
+
+// twoFactorCodeBody is the request body structure of the requests confirmed with a second factor.
+// Either a TOTP code or a recovery code is expected.
+type twoFactorCodeBody struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// twoFactorLoginBody is the second login step request body structure.
+type twoFactorLoginBody struct {
+	Challenge string `json:"challenge"`
+	twoFactorCodeBody
+}
+
+// disableTwoFactorBody is the disable two-factor authentication request body structure.
+type disableTwoFactorBody struct {
+	Password string `json:"password"`
+	twoFactorCodeBody
+}
+
+// twoFactorSetup is the response of the two-factor authentication setup.
+type twoFactorSetup struct {
+	Secret string
+	URI    string
+	// QRCode is a PNG data URL of the QR code of URI.
+	QRCode string
+}
+
+// twoFactorChallenge is the response of a login that needs the second step.
+type twoFactorChallenge struct {
+	TwoFactorRequired bool
+	Challenge         string
+}
+
+// SetupTwoFactor generates a TOTP secret for the current user and returns its provisioning URI
+// and QR code. Two-factor authentication is on once the first code is confirmed with EnableTwoFactor.
+func (m *Repository) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		_ = m.errorJSON(w, r, errors.New("two-factor authentication is already enabled"), http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	err = m.App.DB.Model(&user).Updates(map[string]any{"totp_secret": secret, "totp_last_step": 0}).Error
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	uri := totp.URI(totpIssuer, user.Email, secret)
+	png, err := qr.PNG(uri, 256)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data: twoFactorSetup{
+			Secret: secret,
+			URI:    uri,
+			QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+		},
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// EnableTwoFactor turns on two-factor authentication with the first code of the authenticator app
+// and returns the recovery codes. They are shown only in this response.
+func (m *Repository) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body twoFactorCodeBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding two-factor data"), http.StatusBadRequest)
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		_ = m.errorJSON(w, r, errors.New("two-factor authentication is already enabled"), http.StatusConflict)
+		return
+	}
+
+	if user.TOTPSecret == "" {
+		_ = m.errorJSON(w, r, errors.New("set up two-factor authentication first"), http.StatusConflict)
+		return
+	}
+
+	var codes []string
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the authenticator code proves the app is set up, so recovery codes are not accepted
+		if err := verifySecondFactor(tx, user, twoFactorCodeBody{Code: body.Code}); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Update("totp_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "two-factor authentication enabled, keep the recovery codes in a safe place",
+		Data:    codes,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// DisableTwoFactor turns off two-factor authentication of the current user, who must confirm it with
+// the password and a code, or just the code without a password. It cannot be turned off where it
+// is mandatory.
+func (m *Repository) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body disableTwoFactorBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding two-factor data"), http.StatusBadRequest)
+		return
+	}
+
+	if user.TOTPEnabledAt == nil {
+		_ = m.errorJSON(w, r, errors.New("two-factor authentication is not enabled"), http.StatusConflict)
+		return
+	}
+
+	if m.twoFactorRequired(user) {
+		_ = m.errorJSON(w, r, errors.New("two-factor authentication is mandatory for this account"), http.StatusForbidden)
+		return
+	}
+
+	if err := confirmPassword(user, body.Password); err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, user, body.twoFactorCodeBody); err != nil {
+			return err
+		}
+
+		err := tx.Model(&user).Updates(map[string]any{"totp_secret": "", "totp_enabled_at": nil, "totp_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "two-factor authentication disabled",
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user, confirmed with a TOTP code.
+func (m *Repository) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var body twoFactorCodeBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding two-factor data"), http.StatusBadRequest)
+		return
+	}
+
+	if user.TOTPEnabledAt == nil {
+		_ = m.errorJSON(w, r, errors.New("two-factor authentication is not enabled"), http.StatusConflict)
+		return
+	}
+
+	var codes []string
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, user, twoFactorCodeBody{Code: body.Code}); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  codes,
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// LoginTwoFactor is the second login step of the users with two-factor authentication.
+// It takes the challenge returned by the first step and a TOTP or recovery code.
+func (m *Repository) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var body twoFactorLoginBody
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "error decoding two-factor data"), http.StatusBadRequest)
+		return
+	}
+
+	user, _, err := m.parseLinkToken(body.Challenge, purposeTwoFactorLogin)
+	if err != nil || user.TOTPEnabledAt == nil {
+		_ = m.errorJSON(w, r, apierror.New(apierror.Unauthorized, "the login has expired, log in again"))
+		return
+	}
+
+	if !m.requireActiveAccount(w, r, user) {
+		return
+	}
+
+	// Codes are guessed against the same counters as passwords
+	keys := loginLockKeys(r, user.Email)
+	until, err := m.loginLockedUntil(keys)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !until.IsZero() {
+		m.writeLoginLocked(w, r, until)
+		return
+	}
+
+	err = m.App.DB.Transaction(func(tx *gorm.DB) error {
+		return verifySecondFactor(tx, user, body.twoFactorCodeBody)
+	})
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) && apiErr.Code == apierror.ValidationFailed {
+		if err := m.recordLoginFailure(keys); err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidCredentials, "invalid two-factor code"))
+		return
+	}
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := m.clearLoginFailures(user.Email); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = m.startSession(w, r, user.ID)
+	if err != nil {
+		_ = m.errorJSON(w, r, fmt.Errorf("failed to start session: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: fmt.Sprintf("logged in as %s %s", user.FirstName, user.LastName),
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// writeTwoFactorChallenge answers the first login step of a user with two-factor authentication
+// with the challenge for LoginTwoFactor instead of starting a session.
+func (m *Repository) writeTwoFactorChallenge(w http.ResponseWriter, r *http.Request, user models.User) {
+	challenge, err := m.signLinkToken(user, purposeTwoFactorLogin, user.Email, twoFactorLoginTTL)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "enter the code of your authenticator app",
+		Data:    twoFactorChallenge{TwoFactorRequired: true, Challenge: challenge},
+	}
+
+	_ = m.writeJSON(w, http.StatusOK, payload)
+}
+
+// twoFactorRequired reports whether two-factor authentication is mandatory for the user.
+func (m *Repository) twoFactorRequired(user models.User) bool {
+	if m.App.Env.TwoFactorForAdmins && user.UserTypeID == 2 {
+		return true
+	}
+
+	if m.App.Env.TwoFactorForOwners {
+		var count int64
+		m.App.DB.Model(&models.Restaurant{}).Where("owner_id = ?", user.ID).Count(&count)
+		return count > 0
+	}
+
+	return false
+}
+
+// twoFactorEnrolmentPath reports whether the request is allowed to users who have to enrol
+// in two-factor authentication before anything else.
+func twoFactorEnrolmentPath(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/v1/me/2fa/") || r.URL.Path == "/api/v1/logout"
+}
+
+// currentUser loads the user of the request. API keys act for a restaurant rather than as its owner,
+// so they cannot make the account requests that use it, and neither can impersonating admins.
+func (m *Repository) currentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	var user models.User
+
+	if token, ok := bearerToken(r); ok && isAPIKey(token) {
+		_ = m.errorJSON(w, r, errors.New("API keys cannot manage the account"), http.StatusForbidden)
+		return user, false
+	}
+
+	if session, ok := r.Context().Value("session").(models.Session); ok && session.ImpersonatorID != nil {
+		_ = m.errorJSON(w, r, errors.New("the account cannot be managed while impersonating"), http.StatusForbidden)
+		return user, false
+	}
+
+	userID, err := m.getUserFromToken(r)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusUnauthorized)
+		return user, false
+	}
+
+	if err := m.App.DB.First(&user, "id = ?", userID).Error; err != nil {
+		_ = m.errorJSON(w, r, errors.New("user not found"), http.StatusNotFound)
+		return user, false
+	}
+
+	return user, true
+}
+
+// verifySecondFactor checks the TOTP or recovery code of the user within the transaction and uses it up.
+// A wrong code is a validation error of its field; LoginTwoFactor answers it as invalid credentials.
+func verifySecondFactor(tx *gorm.DB, user models.User, body twoFactorCodeBody) error {
+	if body.RecoveryCode != "" {
+		invalid := apierror.Field("recoveryCode", apierror.Invalid, "invalid recovery code")
+
+		result := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(body.RecoveryCode))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return invalid
+		}
+
+		return nil
+	}
+
+	invalid := apierror.Field("code", apierror.Invalid, "invalid two-factor code")
+
+	step, ok := totp.Validate(user.TOTPSecret, body.Code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return invalid
+	}
+
+	// Only move the last step forward, so a code used by a concurrent request is rejected
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return invalid
+	}
+
+	return nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of the user and returns new ones.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		// 10 base32 characters read as two groups of five
+		value := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		code := value[:5] + "-" + value[5:]
+
+		err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: hashToken(value)}).Error
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode lowercases the code and drops the separators users may type or leave out.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(code))
+}
@@ -2,13 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/vladyslavpavlenko/peparesu/internal/apierror"
 	"github.com/vladyslavpavlenko/peparesu/internal/models"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
-	"time"
 )
 
 // signupBody is the signup request body structure.
@@ -19,6 +17,15 @@ type signupBody struct {
 	Password  string `json:"password"`
 }
 
+// validate checks that the names, the email and a password of at least 8 characters are given.
+func (b signupBody) validate() error {
+	if b.FirstName == "" || b.LastName == "" || !validateEmail(b.Email) || len(b.Password) < 8 {
+		return apierror.New(apierror.InvalidCredentials, "bad credentials provided")
+	}
+
+	return nil
+}
+
 // loginBody is the login request body structure.
 type loginBody struct {
 	Email    string `json:"email"`
@@ -33,19 +40,32 @@ func (m *Repository) SignUp(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&body)
 	defer r.Body.Close()
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("failed to read body"))
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "failed to read body"))
 		return
 	}
 
-	if body.FirstName == "" || body.LastName == "" || !validateEmail(body.Email) || len(body.Password) < 8 {
-		_ = m.errorJSON(w, errors.New("bad credentials provided"))
+	body.Email = normalizeEmail(body.Email)
+
+	if err := body.validate(); err != nil {
+		_ = m.errorJSON(w, r, err)
+		return
+	}
+
+	// Refuse taken emails with a field error instead of letting the unique index fail the insert
+	taken, err := m.emailTaken(body.Email)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		_ = m.errorJSON(w, r, apierror.Field("email", apierror.Taken, "an account with this email already exists"))
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.Password), 10)
 	if err != nil {
-		_ = m.errorJSON(w, fmt.Errorf("error hashing password: %v", err))
+		_ = m.errorJSON(w, r, fmt.Errorf("error hashing password: %v", err), http.StatusInternalServerError)
 		return
 	}
 
@@ -61,13 +81,16 @@ func (m *Repository) SignUp(w http.ResponseWriter, r *http.Request) {
 	// Add user to the database
 	result := m.App.DB.Create(&user)
 	if result.Error != nil {
-		_ = m.errorJSON(w, fmt.Errorf("error creating user: %v", result.Error))
+		_ = m.errorJSON(w, r, fmt.Errorf("error creating user: %w", result.Error), http.StatusInternalServerError)
 		return
 	}
 
+	// The account is usable right away; only creating restaurants waits for the verification
+	logMailError(m.sendVerificationEmail(user), user)
+
 	payload := jsonResponse{
 		Error:   false,
-		Message: "user created",
+		Message: "user created, check your email to verify the address",
 	}
 
 	_ = m.writeJSON(w, http.StatusCreated, payload)
@@ -81,50 +104,64 @@ func (m *Repository) Login(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&body)
 	defer r.Body.Close()
 	if err != nil {
-		_ = m.errorJSON(w, errors.New("failed to read body"))
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidBody, "failed to read body"))
 		return
 	}
 
-	// Look up the requested user
-	var user models.User
-	m.App.DB.First(&user, "email = ?", body.Email)
+	// Refuse logins while the account or the client is locked after failed attempts
+	keys := loginLockKeys(r, body.Email)
+	until, err := m.loginLockedUntil(keys)
+	if err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if !until.IsZero() {
+		m.writeLoginLocked(w, r, until)
+		return
+	}
 
-	if user.ID == 0 {
-		_ = m.errorJSON(w, errors.New("user not found"), http.StatusUnauthorized)
+	// Look up the requested user; an ambiguous email logs in to none of its accounts
+	user, _ := userByEmail(m.App.DB, body.Email)
+
+	// Unknown emails and wrong passwords get the same response in about the same time,
+	// so that it does not tell which addresses have accounts
+	passwordHash := user.Password
+	if user.ID == 0 || passwordHash == "" {
+		passwordHash = dummyPasswordHash
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(body.Password))
+	if err != nil || user.ID == 0 || user.Password == "" {
+		if err := m.recordLoginFailure(keys); err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+
+		_ = m.errorJSON(w, r, apierror.New(apierror.InvalidCredentials, "invalid email or password"))
 		return
 	}
 
-	// Compare sent in password with saved user password hash
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.Password))
-	if err != nil {
-		_ = m.errorJSON(w, errors.New("invalid password"), http.StatusUnauthorized)
+	if !m.requireActiveAccount(w, r, user) {
 		return
 	}
 
-	// Generate a JWT Token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(time.Hour * 24 * 14).Unix(),
-	})
+	// Users with two-factor authentication continue with LoginTwoFactor
+	if user.TOTPEnabledAt != nil {
+		m.writeTwoFactorChallenge(w, r, user)
+		return
+	}
 
-	// Sign in and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString([]byte(m.App.Env.JWTSecret))
-	if err != nil {
-		_ = m.errorJSON(w, errors.New("failed to create JWT token"))
+	if err := m.clearLoginFailures(user.Email); err != nil {
+		_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	// create and set a cookie
-	cookie := http.Cookie{
-		Name:     "user_jwt",
-		Path:     "/",
-		Value:    tokenString,
-		MaxAge:   3600 * 24 * 30,
-		Secure:   false,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+	// Start a session with a short-lived access token and a refresh token
+	_, err = m.startSession(w, r, user.ID)
+	if err != nil {
+		_ = m.errorJSON(w, r, fmt.Errorf("failed to start session: %v", err), http.StatusInternalServerError)
+		return
 	}
-	http.SetCookie(w, &cookie)
 
 	payload := jsonResponse{
 		Error:   false,
@@ -134,18 +171,18 @@ func (m *Repository) Login(w http.ResponseWriter, r *http.Request) {
 	_ = m.writeJSON(w, http.StatusOK, payload)
 }
 
-// Logout handles the logout request by invalidating the user's session cookie.
+// Logout handles the logout request by revoking the current session and clearing its cookies.
 func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
-	cookie := http.Cookie{
-		Name:     "user_jwt",
-		Path:     "/",
-		Value:    "",
-		MaxAge:   -1,
-		Secure:   false,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	}
-	http.SetCookie(w, &cookie)
+	session, err := m.authenticate(r)
+	if err == nil {
+		err = revokeSession(m.App.DB, session.ID, revokedLogout)
+		if err != nil {
+			_ = m.errorJSON(w, r, err, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	clearAuthCookies(w)
 
 	payload := jsonResponse{
 		Error:   false,
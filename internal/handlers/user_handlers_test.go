@@ -0,0 +1,50 @@
+package handlers
+
+import "testing"
+
+func TestSignupBodyValidate(t *testing.T) {
+	valid := signupBody{FirstName: "Олена", LastName: "Коваль", Email: "olena@example.com", Password: "correct horse"}
+
+	tests := []struct {
+		name    string
+		change  func(b *signupBody)
+		wantErr bool
+	}{
+		{name: "valid", change: func(*signupBody) {}},
+		{name: "email with a display name", change: func(b *signupBody) { b.Email = "Olena <olena@example.com>" }, wantErr: true},
+		{name: "no first name", change: func(b *signupBody) { b.FirstName = "" }, wantErr: true},
+		{name: "no last name", change: func(b *signupBody) { b.LastName = "" }, wantErr: true},
+		{name: "invalid email", change: func(b *signupBody) { b.Email = "olena.example.com" }, wantErr: true},
+		{name: "short password", change: func(b *signupBody) { b.Password = "1234567" }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := valid
+			tt.change(&body)
+
+			if err := body.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{email: "olena@example.com", want: "olena@example.com"},
+		{email: "Olena@Example.COM", want: "olena@example.com"},
+		{email: "  olena@example.com\n", want: "olena@example.com"},
+		{email: "ОЛЕНА@приклад.укр", want: "олена@приклад.укр"},
+		{email: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeEmail(tt.email); got != tt.want {
+			t.Errorf("normalizeEmail(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package mailer sends transactional emails, such as email verification links.
+//
+// SMTP delivers the emails; Log writes them to the log or to .eml files for development.
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTP sends emails through an SMTP server. The connection is upgraded with STARTTLS
+// when the server supports it, and authentication is used when Username is set.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From is the sender address, optionally with a name, such as "Peparesu <no-reply@peparesu.com>".
+	From string
+}
+
+// Send sends the message.
+func (s SMTP) Send(msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %v", s.From, err)
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	if err := smtp.SendMail(addr, auth, from.Address, []string{msg.To}, compose(s.From, msg)); err != nil {
+		return fmt.Errorf("error sending email to %s: %v", msg.To, err)
+	}
+
+	return nil
+}
+
+// Log is a development mailer that does not deliver emails. It writes every email to Dir
+// as an .eml file, or to the log when Dir is empty.
+type Log struct {
+	From string
+	Dir  string
+}
+
+// Send writes the message.
+func (l Log) Send(msg Message) error {
+	data := compose(l.From, msg)
+
+	if l.Dir == "" {
+		log.Printf("email to %s:\n%s", msg.To, data)
+		return nil
+	}
+
+	if err := os.MkdirAll(l.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	return os.WriteFile(filepath.Join(l.Dir, name), data, 0o644)
+}
+
+// compose returns the message in the Internet Message Format.
+func compose(from string, msg Message) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+
+	return b.Bytes()
+}
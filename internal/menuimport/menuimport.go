@@ -0,0 +1,338 @@
+// Package menuimport imports restaurant menus and menu items from CSV and XLSX sheets.
+//
+// A sheet starts with a header row naming its columns: menu, title, description, price
+// and picture. Column names are case-insensitive and can come in any order; description
+// and picture are optional. A picture is either an absolute URL or the name of a file
+// in the images directory.
+package menuimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"github.com/vladyslavpavlenko/peparesu/internal/pricehistory"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format is the format of an import sheet.
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+// ErrInvalidRows is returned by Import when some rows do not pass validation.
+var ErrInvalidRows = errors.New("import contains invalid rows")
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+// Row is a single menu item row of an import sheet.
+type Row struct {
+	Line        int
+	Menu        string
+	Title       string
+	Description string
+	PriceUAH    uint
+	Picture     string
+}
+
+// RowError is a validation error of a single row.
+type RowError struct {
+	Line    int
+	Field   string
+	Message string
+}
+
+// Report is the outcome of an import.
+type Report struct {
+	DryRun       bool
+	Rows         int
+	MenusCreated []string
+	ItemsCreated int
+	Errors       []RowError
+}
+
+// Options configures an import.
+type Options struct {
+	// ImagesDir is the directory picture file names are resolved in.
+	ImagesDir string
+	// ImagesURL is the public URL of ImagesDir.
+	ImagesURL string
+	// DefaultPicture is used for rows without a picture.
+	DefaultPicture string
+	// ActorID is the user recorded as the author of the initial prices.
+	ActorID uint
+	// DryRun validates and reports the import without saving anything.
+	DryRun bool
+}
+
+// FormatFromFilename detects the sheet format from the file extension.
+func FormatFromFilename(name string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return CSV, nil
+	case ".xlsx":
+		return XLSX, nil
+	default:
+		return "", fmt.Errorf("unsupported file type %q, expected .csv or .xlsx", filepath.Ext(name))
+	}
+}
+
+// Parse reads the rows of the sheet. Rows that cannot be parsed are reported as row errors.
+func Parse(r io.Reader, format Format) ([]Row, []RowError, error) {
+	var records [][]string
+
+	switch format {
+	case CSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+
+		var err error
+		records, err = reader.ReadAll()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading CSV: %v", err)
+		}
+	case XLSX:
+		file, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading XLSX: %v", err)
+		}
+		defer file.Close()
+
+		sheets := file.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, nil, errors.New("the XLSX file has no sheets")
+		}
+
+		records, err = file.GetRows(sheets[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading XLSX: %v", err)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unsupported format %q", format)
+	}
+
+	if len(records) == 0 {
+		return nil, nil, errors.New("the sheet is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range []string{"menu", "title", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, fmt.Errorf("missing %q column", name)
+		}
+	}
+
+	cell := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []Row
+	var rowErrors []RowError
+
+	for i, record := range records[1:] {
+		line := i + 2
+
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		row := Row{
+			Line:        line,
+			Menu:        cell(record, "menu"),
+			Title:       cell(record, "title"),
+			Description: cell(record, "description"),
+			Picture:     cell(record, "picture"),
+		}
+
+		price, err := strconv.ParseUint(cell(record, "price"), 10, 32)
+		if err != nil {
+			rowErrors = append(rowErrors, RowError{Line: line, Field: "price", Message: "price must be a whole non-negative number of UAH"})
+		}
+		row.PriceUAH = uint(price)
+
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+// Validate checks the rows and returns the errors found in them.
+func Validate(rows []Row, opts Options) []RowError {
+	var rowErrors []RowError
+	seen := make(map[string]int)
+
+	for _, row := range rows {
+		if row.Menu == "" {
+			rowErrors = append(rowErrors, RowError{Line: row.Line, Field: "menu", Message: "menu cannot be empty"})
+		} else if utf8.RuneCountInString(row.Menu) > 255 {
+			rowErrors = append(rowErrors, RowError{Line: row.Line, Field: "menu", Message: "menu is longer than 255 characters"})
+		}
+
+		if row.Title == "" {
+			rowErrors = append(rowErrors, RowError{Line: row.Line, Field: "title", Message: "title cannot be empty"})
+		} else if utf8.RuneCountInString(row.Title) > 255 {
+			rowErrors = append(rowErrors, RowError{Line: row.Line, Field: "title", Message: "title is longer than 255 characters"})
+		}
+
+		if utf8.RuneCountInString(row.Description) > 1000 {
+			rowErrors = append(rowErrors, RowError{Line: row.Line, Field: "description", Message: "description is longer than 1000 characters"})
+		}
+
+		if row.Picture != "" {
+			if _, err := resolvePicture(row.Picture, opts); err != nil {
+				rowErrors = append(rowErrors, RowError{Line: row.Line, Field: "picture", Message: err.Error()})
+			}
+		}
+
+		key := strings.ToLower(row.Menu) + "\x00" + strings.ToLower(row.Title)
+		if line, ok := seen[key]; ok && row.Title != "" {
+			rowErrors = append(rowErrors, RowError{Line: row.Line, Field: "title", Message: fmt.Sprintf("duplicates the item on line %d", line)})
+		} else {
+			seen[key] = row.Line
+		}
+	}
+
+	return rowErrors
+}
+
+// Import parses, validates and applies the sheet to the restaurant in a single transaction.
+// Menus are matched by title and created when missing. If any row is invalid, nothing is
+// saved and ErrInvalidRows is returned along with the report listing the row errors.
+func Import(db *gorm.DB, restaurantID uint, r io.Reader, format Format, opts Options) (Report, error) {
+	report := Report{DryRun: opts.DryRun, MenusCreated: []string{}, Errors: []RowError{}}
+
+	rows, rowErrors, err := Parse(r, format)
+	if err != nil {
+		return report, err
+	}
+
+	report.Rows = len(rows)
+	report.Errors = append(report.Errors, rowErrors...)
+	report.Errors = append(report.Errors, Validate(rows, opts)...)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		menus := make(map[string]models.Menu)
+
+		var existingMenus []models.Menu
+		if err := tx.Where("restaurant_id = ?", restaurantID).Find(&existingMenus).Error; err != nil {
+			return err
+		}
+		for _, menu := range existingMenus {
+			menus[strings.ToLower(menu.Title)] = menu
+		}
+
+		for _, row := range rows {
+			if row.Menu == "" || row.Title == "" {
+				continue
+			}
+
+			menu, ok := menus[strings.ToLower(row.Menu)]
+			if !ok {
+				menu = models.Menu{RestaurantID: restaurantID, Title: row.Menu}
+				if err := tx.Create(&menu).Error; err != nil {
+					return err
+				}
+
+				menus[strings.ToLower(row.Menu)] = menu
+				report.MenusCreated = append(report.MenusCreated, row.Menu)
+			} else {
+				var count int64
+				err := tx.Model(&models.MenuItem{}).Where("menu_id = ? AND LOWER(title) = LOWER(?)", menu.ID, row.Title).Count(&count).Error
+				if err != nil {
+					return err
+				}
+
+				if count > 0 {
+					report.Errors = append(report.Errors, RowError{Line: row.Line, Field: "title", Message: "an item with this title already exists in the menu"})
+					continue
+				}
+			}
+
+			picture := opts.DefaultPicture
+			if row.Picture != "" {
+				picture, _ = resolvePicture(row.Picture, opts)
+			}
+
+			menuItem := models.MenuItem{
+				MenuID:      menu.ID,
+				Picture:     picture,
+				Title:       row.Title,
+				Description: row.Description,
+				PriceUAH:    row.PriceUAH,
+			}
+			if err := tx.Create(&menuItem).Error; err != nil {
+				return err
+			}
+
+			if err := pricehistory.Record(tx, menuItem, restaurantID, 0, opts.ActorID); err != nil {
+				return err
+			}
+
+			report.ItemsCreated++
+		}
+
+		if len(report.Errors) > 0 {
+			return ErrInvalidRows
+		}
+
+		if opts.DryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+
+	if errors.Is(err, errDryRun) {
+		return report, nil
+	}
+	if errors.Is(err, ErrInvalidRows) {
+		report.MenusCreated = []string{}
+		report.ItemsCreated = 0
+	}
+
+	return report, err
+}
+
+// resolvePicture returns the URL of the row picture.
+func resolvePicture(picture string, opts Options) (string, error) {
+	if u, err := url.Parse(picture); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return picture, nil
+	}
+
+	name := filepath.Base(picture)
+	if name != picture || strings.HasPrefix(name, ".") {
+		return "", errors.New("picture must be a URL or a file name in the images directory")
+	}
+
+	if _, err := os.Stat(filepath.Join(opts.ImagesDir, name)); err != nil {
+		return "", fmt.Errorf("picture file %q not found", name)
+	}
+
+	return strings.TrimSuffix(opts.ImagesURL, "/") + "/" + url.PathEscape(name), nil
+}
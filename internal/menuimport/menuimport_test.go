@@ -0,0 +1,118 @@
+package menuimport
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	sheet := "Price,Title,Menu,Picture\n" +
+		"120, Борщ ,Обід,\n" +
+		",,,\n" +
+		"abc,Вареники,Обід,vareniki.jpeg\n"
+
+	rows, rowErrors, err := Parse(strings.NewReader(sheet), CSV)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	wantRows := []Row{
+		{Line: 2, Menu: "Обід", Title: "Борщ", PriceUAH: 120},
+		{Line: 4, Menu: "Обід", Title: "Вареники", Picture: "vareniki.jpeg"},
+	}
+	if !reflect.DeepEqual(rows, wantRows) {
+		t.Errorf("rows = %+v, want %+v", rows, wantRows)
+	}
+
+	wantErrors := []RowError{{Line: 4, Field: "price", Message: "price must be a whole non-negative number of UAH"}}
+	if !reflect.DeepEqual(rowErrors, wantErrors) {
+		t.Errorf("row errors = %+v, want %+v", rowErrors, wantErrors)
+	}
+}
+
+func TestParseMissingColumn(t *testing.T) {
+	if _, _, err := Parse(strings.NewReader("menu,title\nОбід,Борщ\n"), CSV); err == nil {
+		t.Fatal("Parse of a sheet without a price column succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	imagesDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(imagesDir, "borshch.jpeg"), []byte("jpeg"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{ImagesDir: imagesDir, ImagesURL: "http://app.test/images/"}
+
+	tests := []struct {
+		name       string
+		rows       []Row
+		wantFields []string
+	}{
+		{
+			name: "valid rows",
+			rows: []Row{
+				{Line: 2, Menu: "Обід", Title: "Борщ", Picture: "borshch.jpeg"},
+				{Line: 3, Menu: "Обід", Title: "Вареники", Picture: "https://cdn.test/vareniki.jpeg"},
+				{Line: 4, Menu: "Вечеря", Title: "Борщ"},
+			},
+		},
+		{
+			name: "longest values in Cyrillic",
+			rows: []Row{{
+				Line:        2,
+				Menu:        strings.Repeat("м", 255),
+				Title:       strings.Repeat("т", 255),
+				Description: strings.Repeat("о", 1000),
+			}},
+		},
+		{
+			name: "too long values",
+			rows: []Row{{
+				Line:        2,
+				Menu:        strings.Repeat("m", 256),
+				Title:       strings.Repeat("t", 256),
+				Description: strings.Repeat("d", 1001),
+			}},
+			wantFields: []string{"menu", "title", "description"},
+		},
+		{
+			name:       "empty menu and title",
+			rows:       []Row{{Line: 2}},
+			wantFields: []string{"menu", "title"},
+		},
+		{
+			name:       "missing picture file",
+			rows:       []Row{{Line: 2, Menu: "Обід", Title: "Борщ", Picture: "missing.jpeg"}},
+			wantFields: []string{"picture"},
+		},
+		{
+			name:       "picture outside the images directory",
+			rows:       []Row{{Line: 2, Menu: "Обід", Title: "Борщ", Picture: "../borshch.jpeg"}},
+			wantFields: []string{"picture"},
+		},
+		{
+			name: "duplicate item in a different case",
+			rows: []Row{
+				{Line: 2, Menu: "Обід", Title: "Борщ"},
+				{Line: 3, Menu: "обід", Title: "БОРЩ"},
+			},
+			wantFields: []string{"title"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, rowError := range Validate(tt.rows, opts) {
+				fields = append(fields, rowError.Field)
+			}
+
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("error fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
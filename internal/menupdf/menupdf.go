@@ -0,0 +1,432 @@
+// Package menupdf renders restaurant menus into printable PDF documents.
+//
+// Text is set in the Go fonts, which cover Latin and Cyrillic. Item photos are optional;
+// they are re-encoded as JPEG before embedding, so any JPEG, PNG or GIF picture works.
+package menupdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-pdf/fpdf"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+)
+
+// Layout is the arrangement of the menu items on the page.
+type Layout string
+
+const (
+	// Classic puts the items in a single column with large photos.
+	Classic Layout = "classic"
+	// Compact puts the items in two columns with small photos and type.
+	Compact Layout = "compact"
+)
+
+// PageSize is the paper size of the document.
+type PageSize string
+
+const (
+	A4 PageSize = "A4"
+	A5 PageSize = "A5"
+)
+
+const fontFamily = "Go"
+
+// Options configures the rendering.
+type Options struct {
+	Layout   Layout
+	PageSize PageSize
+	// Photos adds the menu item pictures next to the items.
+	Photos bool
+	// Image loads a menu item picture. Pictures it fails to load are left out.
+	Image func(picture string) ([]byte, error)
+}
+
+// ParseLayout returns the layout with the given name, defaulting to Classic.
+func ParseLayout(name string) (Layout, error) {
+	switch Layout(strings.ToLower(name)) {
+	case "", Classic:
+		return Classic, nil
+	case Compact:
+		return Compact, nil
+	default:
+		return "", fmt.Errorf("invalid layout %q, expected 'classic' or 'compact'", name)
+	}
+}
+
+// ParsePageSize returns the page size with the given name, defaulting to A4.
+func ParsePageSize(name string) (PageSize, error) {
+	switch PageSize(strings.ToUpper(name)) {
+	case "", A4:
+		return A4, nil
+	case A5:
+		return A5, nil
+	default:
+		return "", fmt.Errorf("invalid page size %q, expected 'A4' or 'A5'", name)
+	}
+}
+
+// style holds the measurements of a layout on a page size, in millimetres and points.
+type style struct {
+	columns   int
+	margin    float64
+	gutter    float64
+	photoSize float64
+	titleSize float64
+	menuSize  float64
+	itemSize  float64
+	textSize  float64
+}
+
+// styleFor returns the measurements of the layout scaled to the page size.
+func styleFor(layout Layout, size PageSize) style {
+	s := style{columns: 1, margin: 18, gutter: 8, photoSize: 28, titleSize: 26, menuSize: 17, itemSize: 12, textSize: 9.5}
+	if layout == Compact {
+		s = style{columns: 2, margin: 14, gutter: 8, photoSize: 14, titleSize: 22, menuSize: 14, itemSize: 10, textSize: 8}
+	}
+
+	if size == A5 {
+		const scale = 0.75
+		s.margin *= scale
+		s.gutter *= scale
+		s.photoSize *= scale
+		s.titleSize *= scale
+		s.menuSize *= scale
+		s.itemSize *= scale
+		s.textSize *= scale
+	}
+
+	return s
+}
+
+// renderer lays the menus out in columns, moving to the next column or page when one is full.
+type renderer struct {
+	pdf      *fpdf.Fpdf
+	opts     Options
+	style    style
+	colWidth float64
+	column   int
+	// top is where the columns start on the current page.
+	top float64
+}
+
+// Render writes the PDF with the menus of the restaurant to w.
+// The menus are expected to have their menu items loaded.
+func Render(w io.Writer, restaurant models.Restaurant, menus []models.Menu, opts Options) error {
+	if opts.Layout == "" {
+		opts.Layout = Classic
+	}
+	if opts.PageSize == "" {
+		opts.PageSize = A4
+	}
+
+	pdf := fpdf.New("P", "mm", string(opts.PageSize), "")
+	pdf.AddUTF8FontFromBytes(fontFamily, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(fontFamily, "B", gobold.TTF)
+	pdf.AddUTF8FontFromBytes(fontFamily, "I", goitalic.TTF)
+	pdf.SetTitle(restaurant.Title, true)
+	pdf.SetCreator("peparesu", true)
+
+	s := styleFor(opts.Layout, opts.PageSize)
+	pageWidth, _ := pdf.GetPageSize()
+
+	r := &renderer{
+		pdf:      pdf,
+		opts:     opts,
+		style:    s,
+		colWidth: (pageWidth - 2*s.margin - float64(s.columns-1)*s.gutter) / float64(s.columns),
+	}
+
+	pdf.SetMargins(s.margin, s.margin, s.margin)
+	pdf.SetAutoPageBreak(true, s.margin+4)
+	pdf.SetAcceptPageBreakFunc(r.acceptPageBreak)
+	pdf.SetHeaderFunc(func() {
+		r.top = pdf.GetY()
+	})
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-s.margin)
+		pdf.SetLeftMargin(s.margin)
+		pdf.SetX(s.margin)
+		pdf.SetFont(fontFamily, "", s.textSize)
+		pdf.SetTextColor(128, 128, 128)
+		pdf.CellFormat(pageWidth-2*s.margin, 4, fmt.Sprintf("%s · %d/{nb}", restaurant.Title, pdf.PageNo()), "", 0, "C", false, 0, "")
+		r.setColumn(r.column)
+	})
+
+	pdf.AddPage()
+	r.header(restaurant)
+
+	for _, menu := range menus {
+		if len(menu.MenuItems) == 0 {
+			continue
+		}
+
+		r.menu(menu)
+	}
+
+	if err := pdf.Error(); err != nil {
+		return err
+	}
+
+	return pdf.Output(w)
+}
+
+// header writes the restaurant details at the top of the first page.
+func (r *renderer) header(restaurant models.Restaurant) {
+	pdf, s := r.pdf, r.style
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - 2*s.margin
+
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont(fontFamily, "B", s.titleSize)
+	pdf.MultiCell(width, s.titleSize*0.45, restaurant.Title, "", "C", false)
+
+	var details []string
+	for _, detail := range []string{restaurant.Type, restaurant.Address, restaurant.Phone} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+
+	if len(details) > 0 {
+		pdf.Ln(1)
+		pdf.SetFont(fontFamily, "", s.textSize)
+		pdf.SetTextColor(90, 90, 90)
+		pdf.MultiCell(width, s.textSize*0.5, strings.Join(details, " · "), "", "C", false)
+	}
+
+	pdf.Ln(2)
+	pdf.SetDrawColor(180, 180, 180)
+	pdf.Line(s.margin, pdf.GetY(), pageWidth-s.margin, pdf.GetY())
+	pdf.Ln(s.itemSize * 0.5)
+
+	r.top = pdf.GetY()
+	r.setColumn(0)
+}
+
+// menu writes the section heading of the menu followed by its items.
+func (r *renderer) menu(menu models.Menu) {
+	pdf, s := r.pdf, r.style
+	headingHeight := s.menuSize * 0.6
+
+	// keep the heading together with the first item
+	r.ensureSpace(headingHeight + r.itemHeight(menu.MenuItems[0]))
+
+	if pdf.GetY() > r.top {
+		pdf.Ln(s.itemSize * 0.3)
+	}
+
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont(fontFamily, "B", s.menuSize)
+	pdf.CellFormat(r.colWidth, headingHeight, menu.Title, "B", 1, "L", false, 0, "")
+	pdf.Ln(s.itemSize * 0.3)
+
+	for _, menuItem := range menu.MenuItems {
+		r.item(menuItem)
+	}
+}
+
+// item writes a single menu item with its price, description and photo.
+func (r *renderer) item(menuItem models.MenuItem) {
+	pdf, s := r.pdf, r.style
+
+	r.ensureSpace(r.itemHeight(menuItem))
+
+	x, y := pdf.GetX(), pdf.GetY()
+	photo := r.photo(menuItem)
+	if photo != "" {
+		pdf.ImageOptions(photo, x, y, s.photoSize, s.photoSize, false, fpdf.ImageOptions{ImageType: "JPG"}, 0, "")
+		x += s.photoSize + s.gutter/2
+	}
+
+	textWidth, priceWidth := r.textWidths(photo != "")
+
+	pdf.SetXY(x, y)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont(fontFamily, "B", s.itemSize)
+	lineHeight := s.itemSize * 0.45
+	titleLines := pdf.SplitText(menuItem.Title, textWidth)
+	for _, line := range titleLines {
+		pdf.SetX(x)
+		pdf.CellFormat(textWidth, lineHeight, line, "", 2, "L", false, 0, "")
+	}
+
+	pdf.SetXY(x+textWidth, y)
+	pdf.CellFormat(priceWidth, lineHeight, formatPrice(menuItem.PriceUAH), "", 0, "R", false, 0, "")
+	pdf.SetXY(x, y+float64(len(titleLines))*lineHeight)
+
+	if menuItem.Description != "" {
+		pdf.SetFont(fontFamily, "I", s.textSize)
+		pdf.SetTextColor(90, 90, 90)
+		pdf.SetLeftMargin(x)
+		pdf.MultiCell(textWidth, s.textSize*0.45, menuItem.Description, "", "L", false)
+		r.setColumn(r.column)
+	}
+
+	bottom := pdf.GetY()
+	if photo != "" && y+s.photoSize > bottom {
+		bottom = y + s.photoSize
+	}
+
+	pdf.SetXY(r.columnX(r.column), bottom+s.itemSize*0.4)
+}
+
+// itemHeight estimates the height the menu item takes on the page.
+func (r *renderer) itemHeight(menuItem models.MenuItem) float64 {
+	pdf, s := r.pdf, r.style
+	withPhoto := r.opts.Photos && menuItem.Picture != "" && r.opts.Image != nil
+	textWidth, _ := r.textWidths(withPhoto)
+
+	pdf.SetFont(fontFamily, "B", s.itemSize)
+	height := float64(len(pdf.SplitText(menuItem.Title, textWidth))) * s.itemSize * 0.45
+
+	if menuItem.Description != "" {
+		pdf.SetFont(fontFamily, "I", s.textSize)
+		height += float64(len(pdf.SplitText(menuItem.Description, textWidth))) * s.textSize * 0.45
+	}
+
+	if withPhoto && s.photoSize > height {
+		height = s.photoSize
+	}
+
+	return height + s.itemSize*0.4
+}
+
+// textWidths returns the widths of the item text and of its price.
+func (r *renderer) textWidths(withPhoto bool) (float64, float64) {
+	s := r.style
+	priceWidth := s.itemSize * 2.2
+
+	width := r.colWidth - priceWidth
+	if withPhoto {
+		width -= s.photoSize + s.gutter/2
+	}
+
+	return width, priceWidth
+}
+
+// photo registers the menu item picture and returns its image name,
+// or an empty string if photos are off or the picture cannot be used.
+func (r *renderer) photo(menuItem models.MenuItem) string {
+	if !r.opts.Photos || menuItem.Picture == "" || r.opts.Image == nil {
+		return ""
+	}
+
+	name := fmt.Sprintf("menuitem-%d", menuItem.ID)
+	if info := r.pdf.GetImageInfo(name); info != nil {
+		return name
+	}
+
+	data, err := r.opts.Image(menuItem.Picture)
+	if err != nil {
+		return ""
+	}
+
+	converted, err := toJPEG(data)
+	if err != nil {
+		return ""
+	}
+
+	r.pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "JPG"}, bytes.NewReader(converted))
+	if r.pdf.Err() {
+		return ""
+	}
+
+	return name
+}
+
+// acceptPageBreak moves to the next column, or to the first column of a new page
+// when the last column is full.
+func (r *renderer) acceptPageBreak() bool {
+	if r.column < r.style.columns-1 {
+		r.setColumn(r.column + 1)
+		r.pdf.SetY(r.top)
+		return false
+	}
+
+	r.setColumn(0)
+	return true
+}
+
+// ensureSpace breaks the column if the content of the given height does not fit in it.
+func (r *renderer) ensureSpace(height float64) {
+	_, pageHeight := r.pdf.GetPageSize()
+	_, _, _, bottom := r.pdf.GetMargins()
+
+	if r.pdf.GetY()+height <= pageHeight-bottom || r.pdf.GetY() <= r.top {
+		return
+	}
+
+	if r.acceptPageBreak() {
+		r.pdf.AddPage()
+		r.setColumn(0)
+	}
+}
+
+// setColumn makes the column the current one.
+func (r *renderer) setColumn(column int) {
+	r.column = column
+	x := r.columnX(column)
+	r.pdf.SetLeftMargin(x)
+	r.pdf.SetX(x)
+}
+
+// columnX returns the left edge of the column.
+func (r *renderer) columnX(column int) float64 {
+	return r.style.margin + float64(column)*(r.colWidth+r.style.gutter)
+}
+
+// formatPrice formats the price in UAH with the thousands separated by spaces.
+func formatPrice(priceUAH uint) string {
+	digits := fmt.Sprint(priceUAH)
+
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(digit)
+	}
+
+	return b.String() + " грн"
+}
+
+// toJPEG decodes a JPEG, PNG or GIF image, crops it to a centred square and encodes
+// it as a JPEG on a white background.
+func toJPEG(data []byte) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, errors.New("empty image")
+	}
+
+	side := min(bounds.Dx(), bounds.Dy())
+	offset := image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2)
+
+	canvas := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(canvas, canvas.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(canvas, canvas.Bounds(), img, bounds.Min.Add(offset), draw.Over)
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, canvas, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
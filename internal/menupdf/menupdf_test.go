@@ -0,0 +1,146 @@
+package menupdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestParseLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Layout
+		wantErr bool
+	}{
+		{name: "", want: Classic},
+		{name: "classic", want: Classic},
+		{name: "Compact", want: Compact},
+		{name: "grid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLayout(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLayout(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestParsePageSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    PageSize
+		wantErr bool
+	}{
+		{name: "", want: A4},
+		{name: "a4", want: A4},
+		{name: "A5", want: A5},
+		{name: "letter", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePageSize(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePageSize(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestFormatPrice(t *testing.T) {
+	tests := []struct {
+		price uint
+		want  string
+	}{
+		{price: 0, want: "0 грн"},
+		{price: 999, want: "999 грн"},
+		{price: 1000, want: "1 000 грн"},
+		{price: 1234567, want: "1 234 567 грн"},
+	}
+
+	for _, tt := range tests {
+		if got := formatPrice(tt.price); got != tt.want {
+			t.Errorf("formatPrice(%d) = %q, want %q", tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestToJPEG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			img.Set(x, y, color.NRGBA{R: 200, A: 128})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := toJPEG(buf.Bytes())
+	if err != nil {
+		t.Fatalf("toJPEG: %v", err)
+	}
+
+	converted, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decoding the JPEG: %v", err)
+	}
+
+	if bounds := converted.Bounds(); bounds.Dx() != 20 || bounds.Dy() != 20 {
+		t.Errorf("JPEG size = %dx%d, want a 20x20 square", bounds.Dx(), bounds.Dy())
+	}
+
+	if _, err := toJPEG([]byte("not an image")); err == nil {
+		t.Error("toJPEG of garbage succeeded")
+	}
+}
+
+func TestRender(t *testing.T) {
+	restaurant := models.Restaurant{Title: "Пузата хата"}
+	menus := []models.Menu{
+		{Title: "Порожнє"},
+		{Title: "Обід", MenuItems: []models.MenuItem{
+			{ID: 1, Title: "Борщ", Description: "З пампушками", PriceUAH: 120, Picture: "borshch.png"},
+			{ID: 2, Title: "Вареники", PriceUAH: 1500, Picture: "missing.png"},
+		}},
+	}
+
+	photo := new(bytes.Buffer)
+	if err := png.Encode(photo, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, layout := range []Layout{Classic, Compact} {
+		for _, size := range []PageSize{A4, A5} {
+			t.Run(fmt.Sprintf("%s %s", layout, size), func(t *testing.T) {
+				opts := Options{
+					Layout:   layout,
+					PageSize: size,
+					Photos:   true,
+					Image: func(picture string) ([]byte, error) {
+						if picture == "borshch.png" {
+							return photo.Bytes(), nil
+						}
+						return nil, errors.New("not found")
+					},
+				}
+
+				out := new(bytes.Buffer)
+				if err := Render(out, restaurant, menus, opts); err != nil {
+					t.Fatalf("Render: %v", err)
+				}
+
+				if !bytes.HasPrefix(out.Bytes(), []byte("%PDF-")) {
+					t.Errorf("output is not a PDF: %.20q", out.Bytes())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package mockoidc is a minimal OpenID Connect provider for local development and testing
+// of the OIDC login. It signs in anyone with any email address, so it must never be exposed.
+//
+// It implements discovery, the authorization endpoint with a login form, the token endpoint
+// of the authorization code flow with PKCE (S256 only) and the JWKS endpoint.
+package mockoidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	keyID   = "mockoidc"
+	codeTTL = time.Minute
+)
+
+// authorization is an issued authorization code.
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	email         string
+	emailVerified bool
+	givenName     string
+	familyName    string
+	expiresAt     time.Time
+}
+
+// Server is a mock OIDC provider.
+type Server struct {
+	issuer string
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// New returns a provider with the issuer URL it is served at and a fresh signing key.
+func New(issuer string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		key:    key,
+		codes:  make(map[string]authorization),
+	}, nil
+}
+
+// ServeHTTP routes the provider endpoints.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		s.discovery(w)
+	case "/authorize":
+		s.authorize(w, r)
+	case "/token":
+		s.token(w, r)
+	case "/jwks":
+		writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+			Key:       &s.key.PublicKey,
+			KeyID:     keyID,
+			Algorithm: string(jose.RS256),
+			Use:       "sig",
+		}}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{string(jose.RS256)},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<title>Mock OIDC login</title>
+<form method="post">
+	{{range $name, $values := .}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">{{end}}{{end}}
+	<p><label>Email <input name="email" type="email" required></label></p>
+	<p><label>First name <input name="given_name"></label></p>
+	<p><label>Last name <input name="family_name"></label></p>
+	<p><label><input name="email_verified" type="checkbox" value="false"> Email is not verified</label></p>
+	<p><button>Log in</button></p>
+</form>`))
+
+// authorize shows the login form and, once it is submitted, redirects back with a code.
+// A login_hint skips the form and logs in with that email address. With email_verified=false,
+// the ID token says that the address is not verified.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	email := r.Form.Get("email")
+	if email == "" {
+		email = r.Form.Get("login_hint")
+	}
+	if email == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = loginPage.Execute(w, r.URL.Query())
+		return
+	}
+
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" || r.Form.Get("response_type") != "code" {
+		http.Error(w, "invalid redirect_uri or response_type", http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("code_challenge") == "" || r.Form.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+
+	s.mu.Lock()
+	s.codes[code] = authorization{
+		clientID:      r.Form.Get("client_id"),
+		redirectURI:   redirectURI.String(),
+		nonce:         r.Form.Get("nonce"),
+		codeChallenge: r.Form.Get("code_challenge"),
+		email:         email,
+		emailVerified: r.Form.Get("email_verified") != "false",
+		givenName:     r.Form.Get("given_name"),
+		familyName:    r.Form.Get("family_name"),
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	s.mu.Unlock()
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token redeems an authorization code for an ID token.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		writeError(w, "unsupported_grant_type")
+		return
+	}
+
+	clientID, _, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.Form.Get("client_id")
+	}
+
+	code := r.Form.Get("code")
+
+	s.mu.Lock()
+	auth, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(auth.expiresAt) || auth.clientID != clientID || auth.redirectURI != r.Form.Get("redirect_uri") {
+		writeError(w, "invalid_grant")
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != auth.codeChallenge {
+		writeError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            s.issuer,
+		"sub":            "mock-" + strings.ToLower(auth.email),
+		"aud":            clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.email,
+		"email_verified": auth.emailVerified,
+		"given_name":     auth.givenName,
+		"family_name":    auth.familyName,
+	})
+	idToken.Header["kid"] = keyID
+
+	signed, err := idToken.SignedString(s.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
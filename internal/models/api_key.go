@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// APIKeyScope is what an API key is allowed to do.
+type APIKeyScope string
+
+const (
+	// APIKeyScopeRead allows only reading requests.
+	APIKeyScopeRead APIKeyScope = "read"
+	// APIKeyScopeWrite allows all requests.
+	APIKeyScopeWrite APIKeyScope = "write"
+)
+
+// APIKey authenticates integrations, such as POS systems, on behalf of the owner of a single restaurant.
+// Only the SHA-256 hash of the key is stored; Prefix is kept to tell the keys apart.
+type APIKey struct {
+	ID           uint        `gorm:"primaryKey"`
+	RestaurantID uint        `gorm:"not null;index"`
+	Restaurant   Restaurant  `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	CreatedByID  *uint       `json:"-"`
+	CreatedBy    *User       `gorm:"foreignKey:CreatedByID;constraint:OnDelete:SET NULL;" json:"-"`
+	Name         string      `gorm:"size:255;not null"`
+	Prefix       string      `gorm:"size:16;not null"`
+	KeyHash      string      `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scope        APIKeyScope `gorm:"size:16;not null"`
+	ExpiresAt    *time.Time
+	LastUsedAt   *time.Time
+	RevokedAt    *time.Time
+	CreatedAt    time.Time
+}
+
+// Active reports whether the key can still be used at the given time.
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
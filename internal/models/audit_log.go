@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// AuditLog records an admin action on a user or a restaurant, and the requests an admin makes
+// while impersonating a user.
+type AuditLog struct {
+	ID           uint        `gorm:"primaryKey"`
+	ActorID      *uint       `gorm:"index"`
+	Actor        *User       `gorm:"foreignKey:ActorID;constraint:OnDelete:SET NULL;" json:"-"`
+	Action       string      `gorm:"size:64;not null;index"`
+	TargetUserID *uint       `gorm:"index"`
+	TargetUser   *User       `gorm:"foreignKey:TargetUserID;constraint:OnDelete:SET NULL;" json:"-"`
+	RestaurantID *uint       `gorm:"index"`
+	Restaurant   *Restaurant `gorm:"foreignKey:RestaurantID;constraint:OnDelete:SET NULL;" json:"-"`
+	Details      string      `gorm:"size:1000"`
+	IP           string      `gorm:"size:64"`
+	CreatedAt    time.Time   `gorm:"index"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Cart is the shopping cart of a user in a restaurant.
+type Cart struct {
+	ID           uint       `gorm:"primaryKey"`
+	UserID       uint       `gorm:"not null;uniqueIndex:idx_carts_user_restaurant"`
+	User         User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	RestaurantID uint       `gorm:"not null;uniqueIndex:idx_carts_user_restaurant"`
+	Restaurant   Restaurant `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	Items        []CartItem `gorm:"constraint:OnDelete:CASCADE;"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// CartItem is a menu item put into a cart.
+type CartItem struct {
+	ID         uint     `gorm:"primaryKey"`
+	CartID     uint     `gorm:"not null;index"`
+	MenuItemID uint     `gorm:"not null;index"`
+	MenuItem   MenuItem `gorm:"foreignKey:MenuItemID;constraint:OnDelete:CASCADE;"`
+	Quantity   uint     `gorm:"not null"`
+}
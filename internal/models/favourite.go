@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// FavouriteList is the named list of favourite restaurants and dishes of a user.
+type FavouriteList struct {
+	ID         uint                 `gorm:"primaryKey"`
+	UserID     uint                 `gorm:"not null;index"`
+	User       User                 `gorm:"foreignKey:UserID" json:"-"`
+	Title      string               `gorm:"size:255;not null"`
+	ShareToken *string              `gorm:"size:64;uniqueIndex"`
+	Entries    []FavouriteListEntry `gorm:"constraint:OnDelete:CASCADE;"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// FavouriteListEntry is a single bookmarked restaurant or menu item in a favourite list.
+// Exactly one of RestaurantID and MenuItemID is set.
+type FavouriteListEntry struct {
+	ID              uint        `gorm:"primaryKey"`
+	FavouriteListID uint        `gorm:"not null;index"`
+	RestaurantID    *uint       `gorm:"index"`
+	Restaurant      *Restaurant `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;"`
+	MenuItemID      *uint       `gorm:"index"`
+	MenuItem        *MenuItem   `gorm:"foreignKey:MenuItemID;constraint:OnDelete:CASCADE;"`
+	CreatedAt       time.Time
+}
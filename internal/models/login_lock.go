@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// LoginLockKind is what the failed logins of a LoginLock are counted by.
+type LoginLockKind string
+
+const (
+	// LoginLockAccount counts the failed logins with an email address, whether or not it has an account.
+	LoginLockAccount LoginLockKind = "account"
+	// LoginLockIP counts the failed logins from a client IP address.
+	LoginLockIP LoginLockKind = "ip"
+	// LoginLockResetEmail counts the password reset requests for an email address.
+	LoginLockResetEmail LoginLockKind = "reset_email"
+	// LoginLockResetIP counts the password reset requests from a client IP address.
+	LoginLockResetIP LoginLockKind = "reset_ip"
+)
+
+// LoginLock counts the consecutive failed logins of an account or an IP address, or their password
+// reset requests. Past a threshold they are locked until LockedUntil, for a time that doubles with
+// every further failure.
+type LoginLock struct {
+	ID            uint          `gorm:"primaryKey"`
+	Kind          LoginLockKind `gorm:"size:16;not null;uniqueIndex:idx_login_locks_kind_key"`
+	Key           string        `gorm:"size:255;not null;uniqueIndex:idx_login_locks_kind_key"`
+	Failures      int           `gorm:"not null;default:0"`
+	LastFailureAt time.Time     `gorm:"not null"`
+	LockedUntil   *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Locked reports whether logins are locked at the given time.
+func (l LoginLock) Locked(now time.Time) bool {
+	return l.LockedUntil != nil && now.Before(*l.LockedUntil)
+}
@@ -10,4 +10,9 @@ type MenuItem struct {
 	Description string `gorm:"size:1000"`
 	LikesCount  uint
 	PriceUAH    uint
+	// EffectivePriceUAH is PriceUAH with the best promotion active at the time of the request.
+	// It is nil, and left out of responses, where the prices have not been worked out.
+	EffectivePriceUAH *uint `gorm:"-" json:",omitempty"`
+	PromotionID       *uint `gorm:"-"`
+	IsFavourite       bool  `gorm:"-"`
 }
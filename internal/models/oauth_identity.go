@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// OAuthIdentity links a user to an account at an OpenID Connect provider, such as Google.
+type OAuthIdentity struct {
+	ID       uint   `gorm:"primaryKey"`
+	UserID   uint   `gorm:"not null;index"`
+	User     User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Provider string `gorm:"size:32;not null;uniqueIndex:idx_oauth_identity_subject"`
+	// Subject is the ID of the user at the provider.
+	Subject   string `gorm:"size:255;not null;uniqueIndex:idx_oauth_identity_subject"`
+	Email     string `gorm:"size:255"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
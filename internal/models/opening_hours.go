@@ -0,0 +1,12 @@
+package models
+
+// OpeningHours is the opening time of a restaurant on a day of the week.
+// Times are minutes since midnight; a closing time before the opening time is not allowed.
+type OpeningHours struct {
+	ID           uint       `gorm:"primaryKey"`
+	RestaurantID uint       `gorm:"not null;uniqueIndex:idx_opening_hours_restaurant_weekday"`
+	Restaurant   Restaurant `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	Weekday      uint       `gorm:"not null;uniqueIndex:idx_opening_hours_restaurant_weekday"`
+	OpensAt      uint       `gorm:"not null"`
+	ClosesAt     uint       `gorm:"not null"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// OrderStatus is the status of an order.
+type OrderStatus string
+
+const (
+	OrderStatusPlaced    OrderStatus = "placed"
+	OrderStatusAccepted  OrderStatus = "accepted"
+	OrderStatusPreparing OrderStatus = "preparing"
+	OrderStatusReady     OrderStatus = "ready"
+	OrderStatusCompleted OrderStatus = "completed"
+	OrderStatusCancelled OrderStatus = "cancelled"
+)
+
+// orderTransitions lists the statuses an order can move to from each status.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPlaced:    {OrderStatusAccepted, OrderStatusCancelled},
+	OrderStatusAccepted:  {OrderStatusPreparing, OrderStatusCancelled},
+	OrderStatusPreparing: {OrderStatusReady, OrderStatusCancelled},
+	OrderStatusReady:     {OrderStatusCompleted},
+}
+
+// CanTransitionTo reports whether an order in status s can move to the next status.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, status := range orderTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Order is the order model. Items keep a snapshot of the menu item titles and prices at checkout.
+type Order struct {
+	ID            uint        `gorm:"primaryKey"`
+	RestaurantID  uint        `gorm:"not null;index"`
+	Restaurant    Restaurant  `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	UserID        uint        `gorm:"not null;index"`
+	User          User        `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	TrackingToken string      `gorm:"size:64;not null;uniqueIndex"`
+	Status        OrderStatus `gorm:"size:32;not null;index"`
+	Comment       string      `gorm:"size:1000"`
+	TotalUAH      uint        `gorm:"not null"`
+	Items         []OrderItem `gorm:"constraint:OnDelete:CASCADE;"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// OrderItem is a snapshot of an ordered menu item.
+type OrderItem struct {
+	ID         uint      `gorm:"primaryKey"`
+	OrderID    uint      `gorm:"not null;index"`
+	MenuItemID *uint     `gorm:"index"`
+	MenuItem   *MenuItem `gorm:"foreignKey:MenuItemID;constraint:OnDelete:SET NULL;" json:"-"`
+	Title      string    `gorm:"size:255;not null"`
+	PriceUAH   uint      `gorm:"not null"`
+	Quantity   uint      `gorm:"not null"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestOrderStatusCanTransitionTo(t *testing.T) {
+	statuses := []OrderStatus{
+		OrderStatusPlaced,
+		OrderStatusAccepted,
+		OrderStatusPreparing,
+		OrderStatusReady,
+		OrderStatusCompleted,
+		OrderStatusCancelled,
+	}
+
+	allowed := map[[2]OrderStatus]bool{
+		{OrderStatusPlaced, OrderStatusAccepted}:     true,
+		{OrderStatusPlaced, OrderStatusCancelled}:    true,
+		{OrderStatusAccepted, OrderStatusPreparing}:  true,
+		{OrderStatusAccepted, OrderStatusCancelled}:  true,
+		{OrderStatusPreparing, OrderStatusReady}:     true,
+		{OrderStatusPreparing, OrderStatusCancelled}: true,
+		{OrderStatusReady, OrderStatusCompleted}:     true,
+	}
+
+	// Every pair of statuses, so that a transition added by mistake is caught too
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]OrderStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	if OrderStatus("unknown").CanTransitionTo(OrderStatusAccepted) {
+		t.Error("an unknown status can transition")
+	}
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PasswordResetToken is a single-use token of a forgot-password link. Only the SHA-256 hash of the token is stored.
+type PasswordResetToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
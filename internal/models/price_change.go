@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// PriceChange is a recorded change of the price of a menu item.
+type PriceChange struct {
+	ID           uint       `gorm:"primaryKey"`
+	MenuItemID   uint       `gorm:"not null;index"`
+	MenuItem     MenuItem   `gorm:"foreignKey:MenuItemID;constraint:OnDelete:CASCADE;" json:"-"`
+	RestaurantID uint       `gorm:"not null;index"`
+	Restaurant   Restaurant `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	OldPriceUAH  uint       `gorm:"not null"`
+	NewPriceUAH  uint       `gorm:"not null"`
+	ChangedByID  *uint
+	ChangedBy    *User     `gorm:"foreignKey:ChangedByID;constraint:OnDelete:SET NULL;" json:"-"`
+	CreatedAt    time.Time `gorm:"index"`
+}
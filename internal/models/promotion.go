@@ -0,0 +1,115 @@
+package models
+
+import "time"
+
+// PromotionKind is the kind of discount a promotion gives.
+type PromotionKind string
+
+const (
+	PromotionPercentage PromotionKind = "percentage"
+	PromotionFixed      PromotionKind = "fixed"
+)
+
+// Promotion is a discount rule of a restaurant. It targets the given menus and menu items,
+// or the whole restaurant if none are given, and is active within its date range, on its
+// days of the week and between its daily start and end times.
+type Promotion struct {
+	ID           uint          `gorm:"primaryKey"`
+	RestaurantID uint          `gorm:"not null;index"`
+	Restaurant   Restaurant    `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	Title        string        `gorm:"size:255;not null"`
+	Kind         PromotionKind `gorm:"size:32;not null"`
+	// Value is a percentage for percentage promotions and an amount in UAH for fixed ones.
+	Value     uint       `gorm:"not null"`
+	Menus     []Menu     `gorm:"many2many:promotion_menus;constraint:OnDelete:CASCADE;"`
+	MenuItems []MenuItem `gorm:"many2many:promotion_menu_items;constraint:OnDelete:CASCADE;"`
+	StartsOn  *time.Time `gorm:"type:date"`
+	EndsOn    *time.Time `gorm:"type:date"`
+	// Weekdays is a bit mask of time.Weekday values; zero means every day.
+	Weekdays uint `gorm:"not null;default:0"`
+	// TimeFrom and TimeTo are minutes since midnight; equal values mean all day.
+	// A TimeTo before TimeFrom makes the window run past midnight.
+	TimeFrom  uint `gorm:"not null;default:0"`
+	TimeTo    uint `gorm:"not null;default:0"`
+	Active    bool `gorm:"not null;default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ActiveAt reports whether the promotion is in effect at the given time.
+func (p Promotion) ActiveAt(t time.Time) bool {
+	if !p.Active {
+		return false
+	}
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if p.StartsOn != nil && day.Before(dateIn(*p.StartsOn, t.Location())) {
+		return false
+	}
+	if p.EndsOn != nil && day.After(dateIn(*p.EndsOn, t.Location())) {
+		return false
+	}
+
+	minute := uint(t.Hour()*60 + t.Minute())
+	weekday := t.Weekday()
+
+	if p.TimeFrom != p.TimeTo {
+		switch {
+		case p.TimeFrom < p.TimeTo:
+			if minute < p.TimeFrom || minute >= p.TimeTo {
+				return false
+			}
+		case minute < p.TimeTo:
+			// the window started on the previous day
+			weekday = (weekday + 6) % 7
+		case minute < p.TimeFrom:
+			return false
+		}
+	}
+
+	return p.Weekdays == 0 || p.Weekdays&(1<<uint(weekday)) != 0
+}
+
+// AppliesTo reports whether the promotion targets the menu item.
+func (p Promotion) AppliesTo(menuItem MenuItem) bool {
+	if len(p.Menus) == 0 && len(p.MenuItems) == 0 {
+		return true
+	}
+
+	for _, menu := range p.Menus {
+		if menu.ID == menuItem.MenuID {
+			return true
+		}
+	}
+
+	for _, item := range p.MenuItems {
+		if item.ID == menuItem.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Apply returns the price after the promotion discount, never below zero.
+func (p Promotion) Apply(priceUAH uint) uint {
+	var discount uint
+
+	switch p.Kind {
+	case PromotionPercentage:
+		discount = priceUAH * p.Value / 100
+	case PromotionFixed:
+		discount = p.Value
+	}
+
+	if discount > priceUAH {
+		return 0
+	}
+
+	return priceUAH - discount
+}
+
+// dateIn returns the calendar date of t at midnight in the given location.
+func dateIn(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPromotionActiveAt(t *testing.T) {
+	// 2024-05-10 is a Friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 5, day, hour, minute, 0, 0, time.UTC)
+	}
+	date := func(day int) *time.Time {
+		d := time.Date(2024, 5, day, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+	weekdays := func(days ...time.Weekday) uint {
+		var mask uint
+		for _, day := range days {
+			mask |= 1 << uint(day)
+		}
+		return mask
+	}
+
+	tests := []struct {
+		name      string
+		promotion Promotion
+		at        time.Time
+		want      bool
+	}{
+		{name: "always", promotion: Promotion{Active: true}, at: at(10, 12, 0), want: true},
+		{name: "disabled", promotion: Promotion{}, at: at(10, 12, 0)},
+		{name: "before the start date", promotion: Promotion{Active: true, StartsOn: date(11)}, at: at(10, 23, 59)},
+		{name: "on the start date", promotion: Promotion{Active: true, StartsOn: date(10)}, at: at(10, 0, 0), want: true},
+		{name: "on the end date", promotion: Promotion{Active: true, EndsOn: date(10)}, at: at(10, 23, 59), want: true},
+		{name: "after the end date", promotion: Promotion{Active: true, EndsOn: date(9)}, at: at(10, 0, 0)},
+		{name: "on a chosen weekday", promotion: Promotion{Active: true, Weekdays: weekdays(time.Friday)}, at: at(10, 12, 0), want: true},
+		{name: "on another weekday", promotion: Promotion{Active: true, Weekdays: weekdays(time.Saturday, time.Sunday)}, at: at(10, 12, 0)},
+		{name: "inside the time window", promotion: Promotion{Active: true, TimeFrom: 12 * 60, TimeTo: 15 * 60}, at: at(10, 12, 0), want: true},
+		{name: "at the end of the time window", promotion: Promotion{Active: true, TimeFrom: 12 * 60, TimeTo: 15 * 60}, at: at(10, 15, 0)},
+		{name: "before the time window", promotion: Promotion{Active: true, TimeFrom: 12 * 60, TimeTo: 15 * 60}, at: at(10, 11, 59)},
+		{name: "overnight window before midnight", promotion: Promotion{Active: true, TimeFrom: 22 * 60, TimeTo: 2 * 60}, at: at(10, 23, 0), want: true},
+		{name: "overnight window after midnight", promotion: Promotion{Active: true, TimeFrom: 22 * 60, TimeTo: 2 * 60}, at: at(11, 1, 0), want: true},
+		{name: "outside the overnight window", promotion: Promotion{Active: true, TimeFrom: 22 * 60, TimeTo: 2 * 60}, at: at(10, 12, 0)},
+		{
+			name:      "overnight window counts the day it started",
+			promotion: Promotion{Active: true, Weekdays: weekdays(time.Friday), TimeFrom: 22 * 60, TimeTo: 2 * 60},
+			at:        at(11, 1, 0),
+			want:      true,
+		},
+		{
+			name:      "overnight window of another day",
+			promotion: Promotion{Active: true, Weekdays: weekdays(time.Saturday), TimeFrom: 22 * 60, TimeTo: 2 * 60},
+			at:        at(11, 1, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.promotion.ActiveAt(tt.at); got != tt.want {
+				t.Errorf("ActiveAt(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromotionAppliesTo(t *testing.T) {
+	menuItem := MenuItem{ID: 10, MenuID: 1}
+
+	tests := []struct {
+		name      string
+		promotion Promotion
+		want      bool
+	}{
+		{name: "whole restaurant", promotion: Promotion{}, want: true},
+		{name: "menu of the item", promotion: Promotion{Menus: []Menu{{ID: 2}, {ID: 1}}}, want: true},
+		{name: "another menu", promotion: Promotion{Menus: []Menu{{ID: 2}}}},
+		{name: "the item", promotion: Promotion{MenuItems: []MenuItem{{ID: 10}}}, want: true},
+		{name: "another item", promotion: Promotion{MenuItems: []MenuItem{{ID: 11}}}},
+		{name: "another menu or the item", promotion: Promotion{Menus: []Menu{{ID: 2}}, MenuItems: []MenuItem{{ID: 10}}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.promotion.AppliesTo(menuItem); got != tt.want {
+				t.Errorf("AppliesTo = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromotionApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		promotion Promotion
+		price     uint
+		want      uint
+	}{
+		{name: "percentage", promotion: Promotion{Kind: PromotionPercentage, Value: 20}, price: 250, want: 200},
+		{name: "percentage rounds the discount down", promotion: Promotion{Kind: PromotionPercentage, Value: 15}, price: 99, want: 85},
+		{name: "full percentage", promotion: Promotion{Kind: PromotionPercentage, Value: 100}, price: 250, want: 0},
+		{name: "fixed", promotion: Promotion{Kind: PromotionFixed, Value: 30}, price: 250, want: 220},
+		{name: "fixed above the price", promotion: Promotion{Kind: PromotionFixed, Value: 300}, price: 250, want: 0},
+		{name: "unknown kind", promotion: Promotion{Kind: "bogus", Value: 30}, price: 250, want: 250},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.promotion.Apply(tt.price); got != tt.want {
+				t.Errorf("Apply(%d) = %d, want %d", tt.price, got, tt.want)
+			}
+		})
+	}
+}
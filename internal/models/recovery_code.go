@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the user has no access
+// to the authenticator app. Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	User      User   `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	CodeHash  string `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// ReservationStatus is the status of a reservation.
+type ReservationStatus string
+
+const (
+	ReservationStatusPending   ReservationStatus = "pending"
+	ReservationStatusConfirmed ReservationStatus = "confirmed"
+	ReservationStatusCancelled ReservationStatus = "cancelled"
+	ReservationStatusNoShow    ReservationStatus = "no_show"
+)
+
+// Reservation is a booking of a restaurant table for a time slot.
+type Reservation struct {
+	ID           uint              `gorm:"primaryKey"`
+	RestaurantID uint              `gorm:"not null;index"`
+	Restaurant   Restaurant        `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	TableID      uint              `gorm:"not null;index"`
+	Table        Table             `gorm:"foreignKey:TableID;constraint:OnDelete:CASCADE;" json:"-"`
+	UserID       uint              `gorm:"not null;index"`
+	User         User              `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	GuestName    string            `gorm:"size:255;not null"`
+	Phone        string            `gorm:"size:255"`
+	PartySize    uint              `gorm:"not null"`
+	StartsAt     time.Time         `gorm:"not null;index"`
+	EndsAt       time.Time         `gorm:"not null"`
+	Status       ReservationStatus `gorm:"size:32;not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// reservationTransitions lists the statuses a reservation can move to from each status.
+var reservationTransitions = map[ReservationStatus][]ReservationStatus{
+	ReservationStatusPending:   {ReservationStatusConfirmed, ReservationStatusCancelled},
+	ReservationStatusConfirmed: {ReservationStatusCancelled, ReservationStatusNoShow},
+}
+
+// CanTransitionTo reports whether a reservation in status s can move to the next status.
+func (s ReservationStatus) CanTransitionTo(next ReservationStatus) bool {
+	for _, status := range reservationTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+
+	return false
+}
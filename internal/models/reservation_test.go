@@ -0,0 +1,28 @@
+package models
+
+import "testing"
+
+func TestReservationStatusCanTransitionTo(t *testing.T) {
+	statuses := []ReservationStatus{
+		ReservationStatusPending,
+		ReservationStatusConfirmed,
+		ReservationStatusCancelled,
+		ReservationStatusNoShow,
+	}
+
+	allowed := map[[2]ReservationStatus]bool{
+		{ReservationStatusPending, ReservationStatusConfirmed}:   true,
+		{ReservationStatusPending, ReservationStatusCancelled}:   true,
+		{ReservationStatusConfirmed, ReservationStatusCancelled}: true,
+		{ReservationStatusConfirmed, ReservationStatusNoShow}:    true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]ReservationStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
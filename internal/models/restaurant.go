@@ -10,5 +10,11 @@ type Restaurant struct {
 	Description string `gorm:"size:1000;"`
 	Address     string `gorm:"size:255;"`
 	Phone       string `gorm:"size:255;"`
-	Menus       []Menu `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	// DefaultLanguage is the language of the restaurant, menu and menu item texts.
+	DefaultLanguage string   `gorm:"size:8;not null;default:uk"`
+	Rating          float64  `gorm:"not null;default:0"`
+	ReviewsCount    uint     `gorm:"not null;default:0"`
+	IsFavourite     bool     `gorm:"-"`
+	Menus           []Menu   `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Reviews         []Review `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Review is the restaurant review model.
+type Review struct {
+	ID             uint       `gorm:"primaryKey"`
+	RestaurantID   uint       `gorm:"not null;uniqueIndex:idx_reviews_restaurant_user"`
+	Restaurant     Restaurant `gorm:"foreignKey:RestaurantID" json:"-"`
+	UserID         uint       `gorm:"not null;uniqueIndex:idx_reviews_restaurant_user;index"`
+	User           User       `gorm:"foreignKey:UserID" json:"-"`
+	AuthorName     string     `gorm:"-"`
+	Rating         uint       `gorm:"not null"`
+	Text           string     `gorm:"size:2000"`
+	MenuItems      []MenuItem `gorm:"many2many:review_menu_items;constraint:OnDelete:CASCADE;"`
+	OwnerReply     string     `gorm:"size:2000"`
+	OwnerRepliedAt *time.Time
+	Hidden         bool `gorm:"not null;default:false"`
+	Flagged        bool `gorm:"not null;default:false"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Session is a login of a user. It is the family of the refresh tokens issued by rotation
+// since the login, so revoking the session invalidates all of them and its access tokens.
+type Session struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"not null;index"`
+	User   User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	// Device is a readable name of the browser and platform parsed from UserAgent.
+	Device     string    `gorm:"size:128"`
+	IP         string    `gorm:"size:64"`
+	UserAgent  string    `gorm:"size:512"`
+	LastSeenAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	RevokedAt  *time.Time
+	// RevokedReason tells why the session was revoked, such as logout or refresh_token_reuse.
+	RevokedReason string `gorm:"size:64"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	// ImpersonatorID is the admin who acts as the user in the session, which is nil for logins of the user.
+	ImpersonatorID *uint
+	Impersonator   *User `gorm:"foreignKey:ImpersonatorID;constraint:OnDelete:SET NULL;" json:"-"`
+	// Current marks the session of the request in session lists.
+	Current bool `gorm:"-"`
+}
+
+// Active reports whether the session can still be used at the given time.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// RefreshToken is a single-use refresh token of a session. Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	SessionID uint      `gorm:"not null;index"`
+	Session   Session   `gorm:"foreignKey:SessionID;constraint:OnDelete:CASCADE;" json:"-"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+// Table is a table of a restaurant that guests can book.
+type Table struct {
+	ID           uint       `gorm:"primaryKey"`
+	RestaurantID uint       `gorm:"not null;index"`
+	Restaurant   Restaurant `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	Title        string     `gorm:"size:255;not null"`
+	Seats        uint       `gorm:"not null"`
+	Token        string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+}
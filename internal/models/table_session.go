@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// TableSession is a guest session at a table, opened by scanning the table QR code.
+type TableSession struct {
+	ID             uint       `gorm:"primaryKey"`
+	Token          string     `gorm:"size:64;not null;uniqueIndex"`
+	RestaurantID   uint       `gorm:"not null;index"`
+	Restaurant     Restaurant `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	TableID        uint       `gorm:"not null;index"`
+	Table          Table      `gorm:"foreignKey:TableID;constraint:OnDelete:CASCADE;"`
+	LastActivityAt time.Time  `gorm:"not null"`
+	ExpiresAt      time.Time  `gorm:"not null"`
+	CreatedAt      time.Time
+}
+
+// TableRequestKind is the kind of action a guest requests from the staff.
+type TableRequestKind string
+
+const (
+	TableRequestCallWaiter  TableRequestKind = "call_waiter"
+	TableRequestRequestBill TableRequestKind = "request_bill"
+)
+
+// TableRequestStatus is the status of a guest request.
+type TableRequestStatus string
+
+const (
+	TableRequestPending      TableRequestStatus = "pending"
+	TableRequestAcknowledged TableRequestStatus = "acknowledged"
+	TableRequestResolved     TableRequestStatus = "resolved"
+)
+
+// TableRequest is a guest request from a table session, such as calling a waiter.
+type TableRequest struct {
+	ID             uint               `gorm:"primaryKey"`
+	TableSessionID uint               `gorm:"not null;index"`
+	TableSession   TableSession       `gorm:"foreignKey:TableSessionID;constraint:OnDelete:CASCADE;" json:"-"`
+	RestaurantID   uint               `gorm:"not null;index"`
+	TableID        uint               `gorm:"not null"`
+	Table          Table              `gorm:"foreignKey:TableID;constraint:OnDelete:CASCADE;"`
+	Kind           TableRequestKind   `gorm:"size:32;not null"`
+	Status         TableRequestStatus `gorm:"size:32;not null;index"`
+	Note           string             `gorm:"size:500"`
+	HandledByID    *uint
+	HandledBy      *User `gorm:"foreignKey:HandledByID;constraint:OnDelete:SET NULL;" json:"-"`
+	AcknowledgedAt *time.Time
+	ResolvedAt     *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
@@ -0,0 +1,17 @@
+package models
+
+// Translation holds the title and description of a restaurant, menu or menu item in another language.
+// RestaurantID is always set; MenuID or MenuItemID is set for menu and menu item translations.
+// Empty fields fall back to the text in the restaurant default language.
+type Translation struct {
+	ID           uint       `gorm:"primaryKey"`
+	RestaurantID uint       `gorm:"not null;index"`
+	Restaurant   Restaurant `gorm:"foreignKey:RestaurantID;constraint:OnDelete:CASCADE;" json:"-"`
+	MenuID       *uint      `gorm:"index"`
+	Menu         *Menu      `gorm:"foreignKey:MenuID;constraint:OnDelete:CASCADE;" json:"-"`
+	MenuItemID   *uint      `gorm:"index"`
+	MenuItem     *MenuItem  `gorm:"foreignKey:MenuItemID;constraint:OnDelete:CASCADE;" json:"-"`
+	Language     string     `gorm:"size:8;not null;index"`
+	Title        string     `gorm:"size:255"`
+	Description  string     `gorm:"size:1000"`
+}
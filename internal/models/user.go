@@ -13,5 +13,21 @@ type User struct {
 	UserType    UserType `json:"-"`
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
-	Restaurants []Restaurant `gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE;" json:"-"`
+	Restaurants []Restaurant    `gorm:"foreignKey:OwnerID;constraint:OnDelete:CASCADE;" json:"-"`
+	Reviews     []Review        `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Favourites  []FavouriteList `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+
+	// EmailVerifiedAt is when the user confirmed the email address; nil until then.
+	EmailVerifiedAt *time.Time `json:"-"`
+
+	// TOTPSecret is the base32 secret of the authenticator app. It is set on enrolment,
+	// but two-factor authentication is only on once TOTPEnabledAt is set.
+	TOTPSecret    string     `gorm:"size:64" json:"-"`
+	TOTPEnabledAt *time.Time `json:"-"`
+	// TOTPLastStep is the time step of the last accepted code, which cannot be used again.
+	TOTPLastStep int64 `gorm:"not null;default:0" json:"-"`
+
+	// SuspendedAt is when an admin suspended the user, who cannot log in or use the API until unsuspended.
+	SuspendedAt     *time.Time `json:"-"`
+	SuspendedReason string     `gorm:"size:1000" json:"-"`
 }
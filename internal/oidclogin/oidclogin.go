@@ -0,0 +1,177 @@
+// Package oidclogin signs users in with OpenID Connect providers, such as Google or Apple,
+// using the authorization code flow with PKCE.
+//
+// Providers are discovered lazily on first use, so an unreachable provider does not keep
+// the application from starting.
+package oidclogin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"sort"
+	"sync"
+)
+
+// Config configures a provider.
+type Config struct {
+	// Name identifies the provider in the URLs, such as "google".
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL registered with the provider.
+	RedirectURL string
+	// Scopes are requested in addition to openid, email and profile.
+	Scopes []string
+}
+
+// Identity is the user as told by the ID token of a provider.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// ErrUnknownProvider is returned for providers that are not configured.
+var ErrUnknownProvider = errors.New("unknown OIDC provider")
+
+// Providers is the set of the configured providers.
+type Providers struct {
+	providers map[string]*Provider
+}
+
+// New returns the providers of the configs.
+func New(configs []Config) *Providers {
+	providers := &Providers{providers: make(map[string]*Provider, len(configs))}
+	for _, config := range configs {
+		providers.providers[config.Name] = &Provider{config: config}
+	}
+
+	return providers
+}
+
+// Names returns the names of the providers in alphabetical order.
+func (p *Providers) Names() []string {
+	names := make([]string, 0, len(p.providers))
+	for name := range p.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Get returns the provider with the name.
+func (p *Providers) Get(name string) (*Provider, error) {
+	if p == nil {
+		return nil, ErrUnknownProvider
+	}
+
+	provider, ok := p.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	return provider, nil
+}
+
+// Provider is a configured OIDC provider.
+type Provider struct {
+	config Config
+
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// discover loads the provider metadata once it is first needed.
+func (p *Provider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth2 != nil {
+		return p.oauth2, p.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error discovering OIDC provider %s: %v", p.config.Name, err)
+	}
+
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       append([]string{oidc.ScopeOpenID, "email", "profile"}, p.config.Scopes...),
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+
+	return p.oauth2, p.verifier, nil
+}
+
+// AuthCodeURL returns the URL of the provider login page. The state, nonce and PKCE verifier
+// must be kept by the caller and passed to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	config, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems the authorization code and returns the identity of the verified ID token.
+func (p *Provider) Exchange(ctx context.Context, code, nonce, verifier string) (Identity, error) {
+	var identity Identity
+
+	config, idTokenVerifier, err := p.discover(ctx)
+	if err != nil {
+		return identity, err
+	}
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return identity, fmt.Errorf("error exchanging authorization code: %v", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return identity, errors.New("the provider returned no ID token")
+	}
+
+	idToken, err := idTokenVerifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return identity, fmt.Errorf("error verifying ID token: %v", err)
+	}
+
+	if idToken.Nonce != nonce {
+		return identity, errors.New("ID token nonce does not match")
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"`
+		GivenName     string `json:"given_name"`
+		FamilyName    string `json:"family_name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return identity, fmt.Errorf("error decoding ID token claims: %v", err)
+	}
+
+	return Identity{
+		Provider: p.config.Name,
+		Subject:  idToken.Subject,
+		Email:    claims.Email,
+		// Apple sends email_verified as a string
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+	}, nil
+}
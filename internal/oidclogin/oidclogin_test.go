@@ -0,0 +1,167 @@
+package oidclogin
+
+import (
+	"context"
+	"github.com/vladyslavpavlenko/peparesu/internal/mockoidc"
+	"golang.org/x/oauth2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testRedirectURL = "http://app.test/callback"
+
+// newTestProvider returns a provider of a mock OIDC server.
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	var server *mockoidc.Server
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	var err error
+	server, err = mockoidc.New(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider, err := New([]Config{{
+		Name:        "mock",
+		Issuer:      ts.URL,
+		ClientID:    "peparesu",
+		RedirectURL: testRedirectURL,
+	}}).Get("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return provider
+}
+
+// authorize logs in at the provider with the extra login parameters and returns the authorization code.
+func authorize(t *testing.T, provider *Provider, nonce, verifier string, params url.Values) string {
+	t.Helper()
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loginURL, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := loginURL.Query()
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization URL has no S256 code challenge: %s", authURL)
+	}
+	if query.Get("nonce") != nonce {
+		t.Fatalf("authorization URL nonce = %q, want %q", query.Get("nonce"), nonce)
+	}
+
+	for name, values := range params {
+		query[name] = values
+	}
+	loginURL.RawQuery = query.Encode()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(loginURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("provider did not redirect back: %v", err)
+	}
+
+	return location.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name         string
+		params       url.Values
+		nonce        string
+		verifier     string
+		wantErr      bool
+		wantVerified bool
+	}{
+		{
+			name:         "verified email",
+			params:       url.Values{"login_hint": {"jane@example.com"}},
+			wantVerified: true,
+		},
+		{
+			name:   "unverified email",
+			params: url.Values{"login_hint": {"jane@example.com"}, "email_verified": {"false"}},
+		},
+		{
+			name:     "wrong PKCE verifier",
+			params:   url.Values{"login_hint": {"jane@example.com"}},
+			verifier: oauth2.GenerateVerifier(),
+			wantErr:  true,
+		},
+		{
+			name:    "wrong nonce",
+			params:  url.Values{"login_hint": {"jane@example.com"}},
+			nonce:   "other-nonce",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestProvider(t)
+
+			nonce, verifier := "nonce", oauth2.GenerateVerifier()
+			code := authorize(t, provider, nonce, verifier, tt.params)
+
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+
+			identity, err := provider.Exchange(context.Background(), code, nonce, verifier)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Exchange succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+
+			if identity.Provider != "mock" || identity.Subject == "" || identity.Email != "jane@example.com" {
+				t.Errorf("identity = %+v", identity)
+			}
+			if identity.EmailVerified != tt.wantVerified {
+				t.Errorf("EmailVerified = %v, want %v", identity.EmailVerified, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeIsSingleUse(t *testing.T) {
+	provider := newTestProvider(t)
+
+	verifier := oauth2.GenerateVerifier()
+	code := authorize(t, provider, "nonce", verifier, url.Values{"login_hint": {"jane@example.com"}})
+
+	if _, err := provider.Exchange(context.Background(), code, "nonce", verifier); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, "nonce", verifier); err == nil {
+		t.Fatal("second Exchange of the code succeeded, want an error")
+	}
+}
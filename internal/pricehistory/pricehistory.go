@@ -0,0 +1,41 @@
+// Package pricehistory records the price changes of menu items.
+//
+// Every place that creates a menu item or changes its price records the change here,
+// so that the price history and the restaurant report see the same rows.
+package pricehistory
+
+import (
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"gorm.io/gorm"
+)
+
+// Change returns the price change of the restaurant menu item from the old price to its current one,
+// and false if the price did not change. A new menu item has an old price of zero.
+// A zero changedByID records no author.
+func Change(menuItem models.MenuItem, restaurantID, oldPriceUAH, changedByID uint) (models.PriceChange, bool) {
+	if menuItem.PriceUAH == oldPriceUAH {
+		return models.PriceChange{}, false
+	}
+
+	change := models.PriceChange{
+		MenuItemID:   menuItem.ID,
+		RestaurantID: restaurantID,
+		OldPriceUAH:  oldPriceUAH,
+		NewPriceUAH:  menuItem.PriceUAH,
+	}
+	if changedByID != 0 {
+		change.ChangedByID = &changedByID
+	}
+
+	return change, true
+}
+
+// Record stores the price change of the restaurant menu item, if the price changed.
+func Record(tx *gorm.DB, menuItem models.MenuItem, restaurantID, oldPriceUAH, changedByID uint) error {
+	change, ok := Change(menuItem, restaurantID, oldPriceUAH, changedByID)
+	if !ok {
+		return nil
+	}
+
+	return tx.Create(&change).Error
+}
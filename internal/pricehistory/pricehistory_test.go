@@ -0,0 +1,47 @@
+package pricehistory
+
+import (
+	"github.com/vladyslavpavlenko/peparesu/internal/models"
+	"testing"
+)
+
+func TestChange(t *testing.T) {
+	menuItem := models.MenuItem{ID: 10, MenuID: 3, PriceUAH: 250}
+
+	tests := []struct {
+		name        string
+		oldPriceUAH uint
+		changedByID uint
+		wantChange  bool
+		wantAuthor  bool
+	}{
+		{name: "new item", oldPriceUAH: 0, changedByID: 5, wantChange: true, wantAuthor: true},
+		{name: "price raised", oldPriceUAH: 200, changedByID: 5, wantChange: true, wantAuthor: true},
+		{name: "price unchanged", oldPriceUAH: 250, changedByID: 5},
+		{name: "no author", oldPriceUAH: 300, wantChange: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change, ok := Change(menuItem, 7, tt.oldPriceUAH, tt.changedByID)
+			if ok != tt.wantChange {
+				t.Fatalf("Change = %v, want %v", ok, tt.wantChange)
+			}
+			if !ok {
+				return
+			}
+
+			if change.MenuItemID != 10 || change.RestaurantID != 7 || change.OldPriceUAH != tt.oldPriceUAH || change.NewPriceUAH != 250 {
+				t.Errorf("change = %+v", change)
+			}
+
+			if tt.wantAuthor {
+				if change.ChangedByID == nil || *change.ChangedByID != tt.changedByID {
+					t.Errorf("ChangedByID = %v, want %d", change.ChangedByID, tt.changedByID)
+				}
+			} else if change.ChangedByID != nil {
+				t.Errorf("ChangedByID = %d, want none", *change.ChangedByID)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+)
+
+// PNG encodes the content into a square PNG QR code of the given size in pixels.
+func PNG(content string, size int) ([]byte, error) {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+
+	return code.PNG(size)
+}
+
+// SVG encodes the content into a square SVG QR code of the given size in pixels.
+func SVG(content string, size int) ([]byte, error) {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+
+	bitmap := code.Bitmap()
+	modules := len(bitmap)
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, modules, modules)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" fill="#ffffff"/><path fill="#000000" d="`, modules, modules)
+
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	buf.WriteString(`"/></svg>`)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,44 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+const testContent = "https://peparesu.test/restaurants/1?table=token"
+
+func TestPNG(t *testing.T) {
+	out, err := PNG(testContent, 256)
+	if err != nil {
+		t.Fatalf("PNG: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("decoding the PNG: %v", err)
+	}
+
+	if bounds := img.Bounds(); bounds.Dx() != 256 || bounds.Dy() != 256 {
+		t.Errorf("PNG size = %dx%d, want 256x256", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func TestSVG(t *testing.T) {
+	out, err := SVG(testContent, 256)
+	if err != nil {
+		t.Fatalf("SVG: %v", err)
+	}
+
+	svg := string(out)
+	if !strings.HasPrefix(svg, "<svg ") || !strings.HasSuffix(svg, "</svg>") {
+		t.Fatalf("SVG is not a single svg element: %.60s...", svg)
+	}
+	if !strings.Contains(svg, `width="256" height="256"`) {
+		t.Error("SVG does not have the requested size")
+	}
+	if !strings.Contains(svg, "h1v1h-1z") {
+		t.Error("SVG has no dark modules")
+	}
+}
@@ -0,0 +1,26 @@
+// Package storage resolves the pictures served from the application image storage.
+package storage
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ImageName returns the file name of a picture whose URL points into the storage served at imagesPath.
+// Only plain file names directly in the storage are accepted, so the name is safe to join to the storage directory.
+func ImageName(picture, imagesPath string) (string, bool) {
+	prefix := strings.TrimSuffix(imagesPath, "/") + "/"
+
+	u, err := url.Parse(picture)
+	if err != nil || !strings.HasPrefix(u.Path, prefix) {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(u.Path, prefix)
+	if name == "" || path.Base(name) != name || strings.HasPrefix(name, ".") {
+		return "", false
+	}
+
+	return name, true
+}
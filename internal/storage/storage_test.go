@@ -0,0 +1,37 @@
+package storage
+
+import "testing"
+
+func TestImageName(t *testing.T) {
+	const imagesPath = "/api/v1/storage/images/"
+
+	tests := []struct {
+		name    string
+		picture string
+		want    string
+		wantOK  bool
+	}{
+		{name: "absolute URL", picture: "http://localhost:8080/api/v1/storage/images/menuitem-1.jpeg", want: "menuitem-1.jpeg", wantOK: true},
+		{name: "path only", picture: "/api/v1/storage/images/menuitem-1.png", want: "menuitem-1.png", wantOK: true},
+		{name: "query is ignored", picture: "https://app.test/api/v1/storage/images/menuitem-1.jpeg?v=2", want: "menuitem-1.jpeg", wantOK: true},
+		{name: "hosted elsewhere", picture: "https://cdn.test/images/menuitem-1.jpeg"},
+		{name: "storage directory", picture: "https://app.test/api/v1/storage/images/"},
+		{name: "nested file", picture: "https://app.test/api/v1/storage/images/nested/menuitem-1.jpeg"},
+		{name: "dot file", picture: "https://app.test/api/v1/storage/images/.env"},
+		{name: "escaped traversal", picture: "https://app.test/api/v1/storage/images/..%2F..%2Fgo.mod"},
+		{name: "empty", picture: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ImageName(tt.picture, imagesPath)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("ImageName(%q) = %q, %v, want %q, %v", tt.picture, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	if got, ok := ImageName("https://app.test/images/menuitem-1.jpeg", "/images"); !ok || got != "menuitem-1.jpeg" {
+		t.Errorf("ImageName with a storage path without a trailing slash = %q, %v", got, ok)
+	}
+}
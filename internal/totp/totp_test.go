@@ -0,0 +1,76 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// testSecret is the base32 secret "12345678901234567890" of the RFC 6238 test vectors.
+const testSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The last 6 digits of the SHA1 codes of RFC 6238, Appendix B
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(testSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	current := Step(now)
+
+	code := func(step int64) string {
+		c, err := Code(testSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: code(current), wantStep: current, wantOK: true},
+		{name: "previous step within skew", code: code(current - 1), wantStep: current - 1, wantOK: true},
+		{name: "next step within skew", code: code(current + 1), wantStep: current + 1, wantOK: true},
+		{name: "two steps behind", code: code(current - 2)},
+		{name: "two steps ahead", code: code(current + 2)},
+		{name: "spaces are ignored", code: code(current)[:3] + " " + code(current)[3:], wantStep: current, wantOK: true},
+		{name: "replay of the current step", code: code(current), lastStep: current},
+		{name: "replay of an earlier step", code: code(current - 1), lastStep: current - 1},
+		{name: "later step after an earlier one", code: code(current), lastStep: current - 1, wantStep: current, wantOK: true},
+		{name: "too short", code: code(current)[:5]},
+		{name: "too long", code: code(current) + "0"},
+		{name: "wrong code", code: "000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(testSecret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate(%q, lastStep %d) = %d, %v, want %d, %v", tt.code, tt.lastStep, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}